@@ -1,10 +1,13 @@
 package main
 
 import (
+	"HermInvest/pkg/config"
 	"HermInvest/pkg/model"
 	"HermInvest/pkg/service"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -24,57 +27,126 @@ var addCmd = &cobra.Command{
 		"    hermInvestCli stock add 2023-12-01 09:00:00 0050 1 1500 23.5\n\n" +
 
 		"  - Sale on a specific date:\n" +
-		"    hermInvestCli stock add -- 2023-12-01 09:00:10 0050 -1 1500 23.5",
-	Long: `Add stock by transaction date time stockNo type quantity unitPrice`,
+		"    hermInvestCli stock add -- 2023-12-01 09:00:10 0050 -1 1500 23.5\n\n" +
+
+		"  - Sale writing off the latest lots first:\n" +
+		"    hermInvestCli stock add --costBasis lifo -- 2023-12-01 09:00:10 0050 -1 1500 23.5\n\n" +
+
+		"  - Sale writing off the inventory lots 3 and 5:\n" +
+		"    hermInvestCli stock add --lots 3,5 -- 2023-12-01 09:00:10 0050 -1 1500 23.5\n\n" +
+
+		"  - Short sale, selling more than held:\n" +
+		"    hermInvestCli stock add --allow-short -- 2023-12-01 09:00:10 0050 -1 1500 23.5",
+	Long: "" +
+		"Add stock by transaction date time stockNo type quantity unitPrice.\n" +
+		"The transaction is added to the ledger tblTransactionRecord with source cli, and to the\n" +
+		"inventory. A transaction before the last one of the stock, or before its ex-dividend or\n" +
+		"capital reduction date, rebuilds the records and the inventory from the ledger.",
 	Args: cobra.RangeArgs(6, 6),
-	Run:  addRun,
+	RunE: addRun,
 }
 
 func init() {
 	stockCmd.AddCommand(addCmd)
+
+	addCostBasisFlag(addCmd)
+	addAllowShortFlag(addCmd)
+	addCmd.Flags().String("lots", "", "IDs of the inventory lots a sale writes off, e.g. 3,5 (implies --costBasis specific)")
 }
 
-func addRun(cmd *cobra.Command, args []string) {
+func addRun(cmd *cobra.Command, args []string) error {
 	tranDate, tranTime, stockNo, tranType, quantity, unitPrice, err := ParseTransactionForAddCmd(args)
 	if err != nil {
-		fmt.Println("Error parsing transaction data:", err)
-		return
+		return fmt.Errorf("error parsing transaction data: %w", err)
 	}
 
-	serv := service.InitializeService()
+	lots, _ := cmd.Flags().GetString("lots")
+	lotIDs, err := parseLotIDs(lots)
+	if err != nil {
+		return fmt.Errorf("error parsing lots: %w", err)
+	}
+	if len(lotIDs) > 0 && cfg.CostBasis != config.CostBasisSpecific && cmd.Flags().Changed("costBasis") {
+		return fmt.Errorf("--lots can't be used with --costBasis %s", cfg.CostBasis)
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+	if len(lotIDs) > 0 {
+		lotMatcher, _ := service.NewLotMatcher(config.CostBasisSpecific)
+		serv = serv.WithLotMatcher(lotMatcher)
+	}
+	allowShort, _ := cmd.Flags().GetBool("allow-short")
+	serv = serv.WithAllowShort(allowShort)
 
 	// add stock in inventory
 	// 1. new transaction from input
 	// 2. find the first purchase from the inventory
 	// 3. check the transaction type of new transaction and first purchase
 
-	// TODO: service.addTransaction() AddTransactionAndUpdateInventory
-	newTransaction := model.NewTransactionFromInput(tranDate, tranTime, stockNo, tranType, quantity, unitPrice)
+	// The transaction is added to the ledger too, so a rebuild keeps it
+	newTransaction := model.NewTransactionFromInput(tranDate, tranTime, stockNo, tranType, quantity, unitPrice, serv.FeeSchedule(), serv.TaxSchedule())
+	newTransaction.LotIDs = lotIDs
 
-	t, err := serv.AddTransaction(newTransaction)
+	t, rebuilt, err := serv.AddTransaction(newTransaction, model.SourceCLI)
 	if err != nil {
-		fmt.Println("Error adding transaction: ", err)
-	} else if t != nil {
+		if errors.Is(err, model.ErrOversell) {
+			fmt.Println("* Use --allow-short to record a short position.")
+		}
+		return fmt.Errorf("error adding transaction: %w", err)
+	}
+
+	if t != nil {
 		var ts []*model.Transaction
 		ts = append(ts, t)
 		displayResults(ts)
+	} else if rebuilt {
+		ts, err := serv.QueryTransactionByDetails(stockNo, 0, "")
+		if err != nil {
+			return fmt.Errorf("error querying database: %w", err)
+		}
+		fmt.Printf("The inventory is rebuilt from the ledger, the lots of %s:\n", stockNo)
+		displayResults(ts)
+	}
+
+	return nil
+}
+
+// parseLotIDs parses a comma separated list of inventory IDs, e.g. "3,5".
+func parseLotIDs(lots string) ([]int, error) {
+	if lots == "" {
+		return nil, nil
+	}
+
+	var lotIDs []int
+	for _, idStr := range strings.Split(lots, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if err != nil {
+			return nil, fmt.Errorf("parsing lot ID '%s': %w", idStr, err)
+		}
+		lotIDs = append(lotIDs, id)
 	}
 
+	return lotIDs, nil
 }
 
-func ParseTransactionForAddCmd(args []string) (string, string, string, int, int, float64, error) {
+func ParseTransactionForAddCmd(args []string) (string, string, string, int, int, model.Decimal, error) {
 
 	var parsedTime time.Time
 	var err error
 	parsedTime, err = time.Parse(time.DateOnly, args[0])
 	if err != nil {
-		return "", "", "", 0, 0, 0, fmt.Errorf("error parsing date: %s", err)
+		return "", "", "", 0, 0, model.DecimalZero, fmt.Errorf("error parsing date: %s", err)
 	}
 	tranDate := parsedTime.Format(time.DateOnly)
 
 	parsedTime, err = time.Parse(time.TimeOnly, args[1])
 	if err != nil {
-		return "", "", "", 0, 0, 0, fmt.Errorf("error parsing time: %s", err)
+		return "", "", "", 0, 0, model.DecimalZero, fmt.Errorf("error parsing time: %s", err)
 	}
 	tranTate := parsedTime.Format(time.TimeOnly)
 
@@ -82,17 +154,17 @@ func ParseTransactionForAddCmd(args []string) (string, string, string, int, int,
 
 	tranType, err := strconv.Atoi(args[3])
 	if err != nil {
-		return "", "", "", 0, 0, 0, fmt.Errorf("error parsing integer: %s", err)
+		return "", "", "", 0, 0, model.DecimalZero, fmt.Errorf("error parsing integer: %s", err)
 	}
 
 	quantity, err := strconv.Atoi(args[4])
 	if err != nil {
-		return "", "", "", 0, 0, 0, fmt.Errorf("error parsing integer: %s", err)
+		return "", "", "", 0, 0, model.DecimalZero, fmt.Errorf("error parsing integer: %s", err)
 	}
 
-	unitPrice, err := strconv.ParseFloat(args[5], 64)
+	unitPrice, err := model.ParseDecimal(args[5])
 	if err != nil {
-		return "", "", "", 0, 0, 0, fmt.Errorf("error parsing float: %s", err)
+		return "", "", "", 0, 0, model.DecimalZero, fmt.Errorf("error parsing decimal: %s", err)
 	}
 
 	return tranDate, tranTate, stockNo, tranType, quantity, unitPrice, nil
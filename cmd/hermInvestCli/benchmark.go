@@ -0,0 +1,93 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark [--benchmark <StockNumber>] [--from <Date>] [--to <Date>] [--stockNo <StockNumber>]",
+	Short: "Compare the returns with a benchmark",
+	Example: "" +
+		"  - Compare the portfolio with 0050, YTD, 1Y and since inception:\n" +
+		"    hermInvestCli stock benchmark\n\n" +
+
+		"  - Compare the portfolio with 006208 over 2024:\n" +
+		"    hermInvestCli stock benchmark --benchmark 006208 --from 2024-01-01 --to 2024-12-31\n\n" +
+
+		"  - Compare a stock with 0050:\n" +
+		"    hermInvestCli stock benchmark --stockNo 2330",
+	Long: "" +
+		"Compare the returns of the portfolio, or of a stock, with the ones of a benchmark invested\n" +
+		"with the same cash flows: each payment buys shares of the benchmark at the close of its\n" +
+		"day, each receipt sells them, and the dividends of the benchmark are reinvested. The\n" +
+		"benchmark is valued at its prices of tblPrice, see 'hermInvestCli price', with its dividends\n" +
+		"of tblDividend. The returns and the periods are the ones of 'hermInvestCli stock performance',\n" +
+		"and the difference is the return of the portfolio less the one of the benchmark.",
+	Args: cobra.NoArgs,
+	RunE: benchmarkRun,
+}
+
+func init() {
+	stockCmd.AddCommand(benchmarkCmd)
+
+	benchmarkCmd.Flags().String("benchmark", "0050", "Stock number of the benchmark")
+	benchmarkCmd.Flags().String("from", "", "On or after the date")
+	benchmarkCmd.Flags().String("to", "", "On or before the date")
+	benchmarkCmd.Flags().String("stockNo", "", "Stock number")
+}
+
+func benchmarkRun(cmd *cobra.Command, args []string) error {
+	benchmarkNo, _ := cmd.Flags().GetString("benchmark")
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+
+	if benchmarkNo == "" {
+		return errors.New("--benchmark is required")
+	}
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	comparisons, err := serv.QueryBenchmark(benchmarkNo, from, to, stockNo)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	displayBenchmarkComparisons(comparisons)
+
+	return nil
+}
+
+func displayBenchmarkComparisons(comparisons []*model.BenchmarkComparison) {
+	fmt.Print("Stock No,\tBenchmark,\tPeriod,\tFrom,\tTo,\tXIRR %,\tBenchmark XIRR %,\tXIRR Diff,\tTWR %,\tBenchmark TWR %,\tTWR Diff\n")
+	for _, c := range comparisons {
+		stockNo := c.Portfolio.StockNo
+		if stockNo == "" {
+			stockNo = "Total"
+		}
+		fmt.Printf("%8s,\t%9s,\t%9s,\t%10s,\t%10s,\t%8s,\t%16s,\t%9s,\t%8s,\t%15s,\t%8s\n",
+			stockNo, c.Benchmark.StockNo, c.Portfolio.Period, c.Portfolio.From, c.Portfolio.To,
+			percentOrNA(c.Portfolio.XIRR), percentOrNA(c.Benchmark.XIRR), percentOrNA(c.XIRRDiff()),
+			percentOrNA(c.Portfolio.TWR), percentOrNA(c.Benchmark.TWR), percentOrNA(c.TWRDiff()))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"HermInvest/pkg/service"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report over-sells in the database",
+	Example: "" +
+		"  - Report short lots and over-sells:\n" +
+		"    hermInvestCli stock check",
+	Long: "" +
+		"Report the rows left by selling more shares than held: short lots in the inventory,\n" +
+		"and sells exceeding the holding when replaying the ledger.\n" +
+		"Run 'hermInvestCli rebuild' first to regenerate the records of the corporate actions.\n" +
+		"The command fails when an over-sell is found, so a script can check the database.",
+	Args: cobra.NoArgs,
+	RunE: checkRun,
+}
+
+func init() {
+	stockCmd.AddCommand(checkCmd)
+}
+
+func checkRun(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	inconsistencies, err := serv.CheckConsistency()
+	if err != nil {
+		return fmt.Errorf("error checking database: %w", err)
+	}
+
+	if len(inconsistencies) == 0 {
+		fmt.Println("No over-sell found.")
+		return nil
+	}
+
+	fmt.Print("Table,\tID,\tStock No,\tDate,\tTime,\tHeld,\tRequested\n")
+	for _, i := range inconsistencies {
+		fmt.Printf("%s,\t%d,\t%8s,\t%10s,\t%8s,\t%11d,\t%11d\n",
+			i.Table, i.ID, i.StockNo, i.Date, i.Time, i.Held, i.Requested)
+	}
+
+	return fmt.Errorf("%d over-sells found", len(inconsistencies))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// config
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration management",
+	Long:  `Inspect the configuration of HermInvestCli.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective settings",
+	Example: "" +
+		"  - Show the effective settings:\n" +
+		"    hermInvestCli config show\n\n" +
+
+		"  - Show the effective settings with another database:\n" +
+		"    hermInvestCli config show --db ~/invest.db",
+	Long: "" +
+		"Show the effective settings and where each value comes from.\n" +
+		"Precedence: flag > environment variable > config file > default.",
+	Args: cobra.NoArgs,
+	Run:  configShowRun,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
+
+func configShowRun(cmd *cobra.Command, args []string) {
+	fmt.Println("Config file:", cfg.File())
+	fmt.Print("Key,\tValue,\tSource\n")
+	for _, s := range cfg.Settings() {
+		fmt.Printf("%s,\t%s,\t%s\n", s.Key, s.Value, s.Source)
+	}
+}
@@ -8,25 +8,36 @@ import (
 )
 
 var controlCmd = &cobra.Command{
-	Use: "control",
-	Run: controlRun,
+	Use:        "control",
+	Short:      "Rebuild the records and the inventory",
+	Deprecated: "use 'hermInvestCli rebuild' instead.",
+	Example: "" +
+		"  - Rebuild with the cost basis method of the config:\n" +
+		"    hermInvestCli stock control\n\n" +
+
+		"  - Rebuild writing off the latest lots first:\n" +
+		"    hermInvestCli stock control --costBasis lifo",
+	Long: "" +
+		"Rebuild the records, the inventory and the cash dividends without confirmation, as\n" +
+		"'hermInvestCli rebuild --yes' does.",
+	RunE: controlRun,
 }
 
 func init() {
 	stockCmd.AddCommand(controlCmd)
+
+	addCostBasisFlag(controlCmd)
+	addAllowShortFlag(controlCmd)
 }
 
-func controlRun(cmd *cobra.Command, args []string) {
-	// capitalReductionTransactionGenerator()
-	serv := service.InitializeService()
+func controlRun(cmd *cobra.Command, args []string) error {
+	allowShort, _ := cmd.Flags().GetBool("allow-short")
+	cmd.SilenceUsage = true
 
-	err := serv.RebuildTransactionRecordSys()
-	if err != nil {
-		fmt.Println("error:", err)
+	if _, err := rebuild("", service.RebuildScope{}, allowShort, false, true); err != nil {
+		return err
 	}
+	fmt.Println("Rebuilt.")
 
-	err = serv.RebuildTransaction()
-	if err != nil {
-		fmt.Println("error:", err)
-	}
+	return nil
 }
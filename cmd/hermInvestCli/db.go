@@ -0,0 +1,172 @@
+package main
+
+import (
+	"HermInvest/pkg/repository"
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// db
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Database management",
+	Long:  `Manage the database schema via HermInvestCli.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Example: "" +
+		"  - Create or upgrade the database:\n" +
+		"    hermInvestCli db migrate",
+	Long: "" +
+		"Apply every pending schema migration in order.\n" +
+		"The database file is created if it does not exist.",
+	Args: cobra.NoArgs,
+	RunE: dbMigrateRun,
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the schema migration status",
+	Long:  "Show the status of every schema migration of an existing database.",
+	Args:  cobra.NoArgs,
+	RunE:  dbStatusRun,
+}
+
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back the latest schema migrations",
+	Example: "" +
+		"  - Roll back the latest migration:\n" +
+		"    hermInvestCli db rollback\n\n" +
+
+		"  - Roll back the latest two migrations:\n" +
+		"    hermInvestCli db rollback --steps 2\n\n" +
+
+		"  - Roll back without confirmation, e.g. in a script:\n" +
+		"    hermInvestCli db rollback --yes",
+	Long: "" +
+		"Roll back the latest applied schema migrations of an existing database.\n" +
+		"Data of dropped tables and columns is lost, so the migrations are listed and\n" +
+		"confirmed first, unless --yes.",
+	Args: cobra.NoArgs,
+	RunE: dbRollbackRun,
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbRollbackCmd)
+
+	dbRollbackCmd.Flags().Int("steps", 1, "Number of migrations to roll back")
+	dbRollbackCmd.Flags().BoolP("yes", "y", false, "Roll back without confirmation")
+}
+
+func dbMigrateRun(cmd *cobra.Command, args []string) error {
+	db, err := repository.OpenDB(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+
+	applied, err := repository.Migrate(db)
+	for _, m := range applied {
+		fmt.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("Database is up to date.")
+	}
+
+	return nil
+}
+
+func dbStatusRun(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	db, err := repository.OpenExistingDB(cfg.DBPath)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	statuses, err := repository.QueryMigrationStatus(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print("Version,\tName,\tStatus,\tApplied At\n")
+	for _, s := range statuses {
+		status := "pending"
+		if s.Modified {
+			status = "modified"
+		} else if s.Applied {
+			status = "applied"
+		}
+		fmt.Printf("%04d,\t%s,\t%s,\t%s\n", s.Migration.Version, s.Migration.Name, status, s.AppliedAt)
+	}
+
+	return nil
+}
+
+func dbRollbackRun(cmd *cobra.Command, args []string) error {
+	steps, _ := cmd.Flags().GetInt("steps")
+	yes, _ := cmd.Flags().GetBool("yes")
+	if steps < 1 {
+		return fmt.Errorf("steps must be at least 1")
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	db, err := repository.OpenExistingDB(cfg.DBPath)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	plan, err := repository.RollbackPlan(db, steps)
+	if err != nil {
+		return err
+	}
+	if len(plan) == 0 {
+		fmt.Println("No migration to roll back.")
+		return nil
+	}
+	if !yes {
+		for _, m := range plan {
+			fmt.Printf("Roll back migration %04d_%s\n", m.Version, m.Name)
+		}
+		if !confirmRollback() {
+			fmt.Println("Rollback cancelled, nothing is changed.")
+			return nil
+		}
+	}
+
+	reverted, err := repository.Rollback(db, steps)
+	for _, m := range reverted {
+		fmt.Printf("Rolled back migration %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func confirmRollback() bool {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("\nThe data of the tables and columns dropped is lost. Roll back? (yes/no): ")
+	text, _ := reader.ReadString('\n')
+
+	return strings.TrimSpace(text) == "yes"
+}
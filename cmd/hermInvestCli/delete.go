@@ -1,8 +1,10 @@
 package main
 
 import (
+	"HermInvest/pkg/model"
 	"HermInvest/pkg/service"
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -16,35 +18,55 @@ var deleteCmd = &cobra.Command{
 	Example: "" +
 		"  - Delete by ID:\n" +
 		"    hermInvestCli stock delete 11",
-	Long: `Delete stock from the inventory by providing the stock transaction ID`,
+	Long: "" +
+		"Delete stock from the inventory by providing the stock transaction ID.\n" +
+		"The trade of the ledger tblTransactionRecord that opened the lot is deleted, and the records\n" +
+		"and the inventory of the stock are rebuilt from its date, so a later rebuild keeps the deletion.\n" +
+		"The lots of a stock dividend have no trade and can't be deleted.",
 	Args: cobra.ExactArgs(1),
-	Run:  deleteRun,
+	RunE: deleteRun,
 }
 
 func init() {
 	stockCmd.AddCommand(deleteCmd)
+
+	addAllowShortFlag(deleteCmd)
 }
 
-func deleteRun(cmd *cobra.Command, args []string) {
+func deleteRun(cmd *cobra.Command, args []string) error {
 	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		fmt.Println("Invalid ID provided. Please provide a valid ID.")
-		return
+		return fmt.Errorf("invalid ID '%s', please provide a valid ID", args[0])
 	}
 
-	serv := service.InitializeService()
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
 
-	confirm := confirmDeletion()
-	if confirm {
-		err = serv.DeleteTransaction(id)
-		if err != nil {
-			fmt.Println("Error deleting transaction:", err)
-			return
-		}
-		fmt.Println("Transaction deleted successfully!")
-	} else {
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+	allowShort, _ := cmd.Flags().GetBool("allow-short")
+	serv = serv.WithAllowShort(allowShort)
+
+	if !confirmDeletion() {
 		fmt.Println("Deletion cancelled.")
+		return nil
 	}
+
+	entry, err := serv.DeleteTransaction(id)
+	if errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("transaction ID %d not found", id)
+	} else if err != nil {
+		if errors.Is(err, model.ErrOversell) {
+			fmt.Println("* Use --allow-short to record the sales after it as a short position.")
+		}
+		return fmt.Errorf("error deleting transaction, nothing is changed: %w", err)
+	}
+
+	fmt.Printf("Transaction deleted successfully! The trade of %s on %s %s is deleted from the ledger, and %s is rebuilt from it.\n",
+		entry.StockNo, entry.Date, entry.Time, entry.StockNo)
+	return nil
 }
 
 func confirmDeletion() bool {
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"HermInvest/pkg/repository"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes of hermInvestCli, so scripts can tell why a command failed.
+const (
+	exitCodeFailure       = 1
+	exitCodeDBNotFound    = 3
+	exitCodeDBUnusable    = 4
+	exitCodeSchemaCorrupt = 5
+	exitCodeSchemaVersion = 6
+)
+
+// exitCode translates an error into the exit code of the process.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrDBNotFound):
+		return exitCodeDBNotFound
+	case errors.Is(err, repository.ErrNotSQLite):
+		return exitCodeDBUnusable
+	case errors.Is(err, repository.ErrSchemaCorrupt):
+		return exitCodeSchemaCorrupt
+	case errors.Is(err, repository.ErrSchemaVersion), errors.Is(err, repository.ErrSchemaMigrate):
+		return exitCodeSchemaVersion
+	default:
+		return exitCodeFailure
+	}
+}
+
+// exitOnDBError prints the error of connecting the database with a hint of
+// how to fix it, then exits with the matching exit code.
+func exitOnDBError(err error) {
+	fmt.Println("[Error] Unable to use database:", err)
+
+	var dbErr *repository.DBError
+	if errors.As(err, &dbErr) {
+		fmt.Printf("\n* The database path is: '%s'.\n", dbErr.Path)
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrDBNotFound):
+		fmt.Println("* Please make sure the database file exists, or run 'hermInvestCli db migrate' to create it.")
+	case errors.Is(err, repository.ErrSchemaCorrupt):
+		fmt.Println("* Please check schema or consider rebuilding the database.")
+	case errors.Is(err, repository.ErrSchemaVersion):
+		fmt.Println("* Please run 'hermInvestCli db migrate' or enable autoMigrate.")
+	case errors.Is(err, repository.ErrSchemaMigrate):
+		fmt.Println("* Please check 'hermInvestCli db status'.")
+	}
+
+	os.Exit(exitCode(err))
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"HermInvest/pkg/config"
 	"fmt"
+	"os"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/spf13/cobra"
@@ -42,10 +45,22 @@ var stockCmd = &cobra.Command{
 	},
 }
 
+// cfg is the effective config, resolved before any command runs.
+var cfg *config.Config
+
 // root
 var rootCmd = &cobra.Command{
 	Use:  "hermInvestCli",
 	Long: "Operate on the stock inventory for detailed management.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		dbPath, _ := cmd.Flags().GetString("db")
+		broker, _ := cmd.Flags().GetString("broker")
+		costBasis, _ := cmd.Flags().GetString("costBasis") // only on commands matching lots
+
+		var err error
+		cfg, err = config.Load(config.Flags{DBPath: dbPath, Broker: broker, CostBasis: costBasis})
+		return err
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// if input is incorrect, show error and guide what to do
 		// else if input is empty, show help
@@ -56,8 +71,28 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(stockCmd)
 	rootCmd.AddCommand(versionCmd)
+
+	rootCmd.PersistentFlags().String("db", "",
+		"Database path (overrides $"+config.EnvDBPath+" and the config file)")
+	rootCmd.PersistentFlags().String("broker", "",
+		"Broker whose fee schedule is used (overrides $"+config.EnvBroker+" and the config file)")
+}
+
+// addAllowShortFlag adds the --allow-short flag to a command adding sells.
+func addAllowShortFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("allow-short", false, "Record a sell exceeding the shares held as a short position, rather than rejecting it")
+}
+
+// addCostBasisFlag adds the --costBasis flag to a command writing off lots.
+func addCostBasisFlag(cmd *cobra.Command) {
+	cmd.Flags().String("costBasis", "",
+		"Cost basis method: "+strings.Join(config.CostBasisMethods, ", ")+
+			" (overrides $"+config.EnvCostBasis+" and the config file)")
 }
 
 func main() {
-	rootCmd.Execute()
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
 }
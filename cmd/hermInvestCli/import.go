@@ -1,15 +1,21 @@
 package main
 
 import (
+	"HermInvest/pkg/importer"
 	"HermInvest/pkg/model"
 	"HermInvest/pkg/service"
+	"bytes"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -30,111 +36,309 @@ var importCmd = &cobra.Command{
 		"    hermInvestCli stock import stock.csv\n\n" +
 
 		"  - Import stock from file and swap new order column as 0,1,3,2,4:\n" +
-		"    hermInvestCli stock import stock.csv --swapColumn 0,1,3,2" +
+		"    hermInvestCli stock import stock.csv --swapColumn 0,1,3,2\n\n" +
 
 		"  - Import stock from file and swap new order column as 0,1,2,4,5,6:\n" +
-		"    hermInvestCli stock import stock.csv --swapColumn 0,1,2,4,5,6",
+		"    hermInvestCli stock import stock.csv --swapColumn 0,1,2,4,5,6\n\n" +
+
+		"  - Import stock from a tab separated file by the header of its columns:\n" +
+		"    hermInvestCli stock import stock.tsv --delimiter tab \\\n" +
+		"      --map date=成交日期,stockNo=代號,tranType=買賣別,quantity=成交股數,unitPrice=成交價\n\n" +
+
+		"  - Import stock from file by the column mapping saved in the config file:\n" +
+		"    hermInvestCli stock import stock.csv --profile myBroker\n\n" +
+
+		"  - Import stock from file and write off sells by moving average:\n" +
+		"    hermInvestCli stock import stock.csv --costBasis average\n\n" +
+
+		"  - Check what a file would import and how it changes the inventory:\n" +
+		"    hermInvestCli stock import stock.csv --dry-run\n\n" +
+
+		"  - Import the commission history exported by the broker into the ledger:\n" +
+		"    hermInvestCli stock import commission_history_2021-Q1.csv --format broker-commission\n\n" +
+
+		"  - Import the transactions kept in the spreadsheet into the ledger:\n" +
+		"    hermInvestCli stock import Before_2020-12_excel.csv --format manual-excel",
 
 	Long: "" +
 		"Import stock from csv file.\n" +
-		"Please check your csv file has column date time stockNo type quantity unitPrice.",
+		"Please check your csv file has column date time stockNo type quantity unitPrice.\n" +
+		"The file is imported all or nothing: any invalid row or failed transaction imports\n" +
+		"nothing. The rows imported before are skipped, so a file can be imported again. The\n" +
+		"rows are added to the ledger with source cli as an import batch, see 'hermInvestCli import'.\n\n" +
+		"Instead of the column order, --map or --profile locate the columns by the header. The\n" +
+		"fields are date, time, stockNo, tranType, quantity and unitPrice, only time is optional:\n" +
+		"the trades of a day without time are timed every 10 seconds from 09:00:00, or after the\n" +
+		"last trade of the day in the ledger. Dates may be\n" +
+		"2020-12-15, 2020/12/15 or in ROC years 109/12/15, numbers may have thousands separators\n" +
+		"and tranType may be 1, -1, buy, sell, 買進 or 賣出. A profile is saved in the config file:\n" +
+		"  \"importProfiles\": {\"myBroker\": {\"columns\": {\"date\": \"成交日期\", ...}, \"delimiter\": \";\"}}\n\n" +
+		"Formats:\n" +
+		"  csv                add the transactions to the ledger and the inventory (default)\n" +
+		"  broker-commission  add the filled orders of a Big5 commission history (委託回報) to the\n" +
+		"                     ledger tblTransactionRecord\n" +
+		"  manual-excel       add the rows of the spreadsheet with the columns stockName stockNo\n" +
+		"                     tranType quantity date unitPrice to the ledger, the trades of a day\n" +
+		"                     are timed as the ones of a csv file without time\n" +
+		"The records and the inventory of the stocks of these formats are rebuilt from the ledger,\n" +
+		"from their earliest row; --map, --profile, --swapColumn, --skipHeader and --delimiter\n" +
+		"apply to csv only.",
 	Args: cobra.ExactArgs(1),
-	Run:  importRun,
+	RunE: importRun,
 }
 
 func init() {
 	stockCmd.AddCommand(importCmd)
 
+	importCmd.Flags().String("format", importer.FormatCSV, "File format: "+importer.FormatCSV+", "+importer.FormatBrokerCommission+", "+importer.FormatManualExcel)
 	importCmd.Flags().Bool("skipHeader", false, "Ignore header")
 	importCmd.Flags().String("swapColumn", "", "Swap column")
+	importCmd.Flags().String("map", "", "Columns of the fields by header, e.g. date=成交日期,stockNo=代號")
+	importCmd.Flags().String("profile", "", "Column mapping saved in importProfiles of the config file")
+	importCmd.Flags().String("delimiter", "", "Field delimiter of the csv file, a character or 'tab' (default \",\")")
+	addCostBasisFlag(importCmd)
+	addAllowShortFlag(importCmd)
+	importCmd.Flags().Bool("dry-run", false, "Print what would be imported and the inventory change without importing")
 }
 
-func importRun(cmd *cobra.Command, args []string) {
+func importRun(cmd *cobra.Command, args []string) error {
 	filePath := args[0]
+	format, _ := cmd.Flags().GetString("format")
 	skipHeader, _ := cmd.Flags().GetBool("skipHeader")
 	indexes, _ := cmd.Flags().GetString("swapColumn")
+	allowShort, _ := cmd.Flags().GetBool("allow-short")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	if format != importer.FormatCSV && format != importer.FormatBrokerCommission && format != importer.FormatManualExcel {
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+	if format != importer.FormatCSV {
+		// The formats of the ledger have their own columns
+		for _, name := range []string{"skipHeader", "swapColumn", "map", "profile", "delimiter"} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s cannot be used with --format %s", name, format)
+			}
+		}
+	}
+	columnMap, delimiter, err := resolveColumnMap(cmd)
+	if err != nil {
+		return err
+	}
+	if columnMap != nil && (indexes != "" || skipHeader) {
+		return errors.New("--swapColumn and --skipHeader cannot be used with --map or --profile")
+	}
+	cmd.SilenceUsage = true
 
 	// need testcase check file path exist
 	// need testcase check file permission
 	file, err := os.Open(filePath)
 	if err != nil {
-		fmt.Println("Error opening the file: ", err)
-		return
+		return fmt.Errorf("error opening the file: %w", err)
 	}
 	defer file.Close()
 
 	// need testcase check it is not a dir
 	fileInfo, _ := file.Stat()
 	if fileInfo.IsDir() {
-		fmt.Println("Error filePath is not a file.")
+		return fmt.Errorf("error %s is not a file", filePath)
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("error reading the file: %w", err)
+	}
+
+	// The ledger formats are named by the file, the csv rows by the stock
+	// mapping
+	var records []*model.TransactionRecord
+	var entries []*model.LedgerEntry
+	switch {
+	case format == importer.FormatBrokerCommission:
+		entries, err = importer.ParseBrokerCommission(bytes.NewReader(content))
+	case format == importer.FormatManualExcel:
+		entries, err = importer.ParseManualExcel(bytes.NewReader(content))
+	case columnMap != nil:
+		records, err = importer.ParseMappedCSV(bytes.NewReader(content), columnMap, delimiter)
+	default:
+		records, err = parsePositionalCSV(bytes.NewReader(content), delimiter, skipHeader, indexes)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing file, nothing is imported:\n%w", err)
+	}
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+	serv = serv.WithAllowShort(allowShort)
+
+	batch := newImportBatch(file, content, format)
+	var report *service.ImportReport
+	if format == importer.FormatCSV {
+		report, err = serv.ImportTransactions(batch, records, dryRun)
+	} else {
+		report, err = serv.ImportLedgerEntries(batch, entries, dryRun)
+	}
+	if err != nil {
+		if errors.Is(err, model.ErrOversell) {
+			fmt.Println("* Use --allow-short to record the excess as a short position.")
+		}
+		return fmt.Errorf("error importing transactions, nothing is imported: %w", err)
+	}
+
+	displayImportReport(report)
+	if len(report.Added) > 0 && !report.DryRun {
+		fmt.Printf("\nImported %d records as batch %d.\n", len(report.Added), batch.ID)
+	}
+
+	// // TODO: create Transactions, bulk insert? Finally, I choose begin a db transaction
+	// ids, err := repo.CreateTransactions(transactions)
+	// if err != nil {
+	// 	fmt.Println("Error creating transaction: ", err)
+	// }
+
+	// fmt.Println("inserted ids:", ids)
+
+	// 	// Bool control show result or not
+	// 	transactions, err := repo.queryTransactionByID(id)
+	// 	if err != nil {
+	// 		fmt.Println("Error querying database:", err)
+	// 	}
+
+	// Print out result
+	// displayResults(transactions)
+
+	return nil
+}
+
+func displayImportReport(report *service.ImportReport) {
+	if report.DryRun {
+		fmt.Print("Dry run, nothing is imported.\n\n")
+	}
+
+	fmt.Print("Date,\tTime,\tStock No,\tType,\tQty(shares),\tUnit Price\n")
+	for _, r := range report.Added {
+		fmt.Printf("%10s,\t%8s,\t%8s,\t%4d,\t%11d,\t%10s\n",
+			r.Date, r.Time, r.StockNo, r.TranType, r.Quantity, r.UnitPrice.StringFixed(2))
+	}
+	fmt.Printf("\nAdded %d records, skipped %d records imported before.\n", len(report.Added), len(report.Skipped))
+	if len(report.Added) == 0 {
 		return
 	}
+	if report.Rebuilt {
+		fmt.Println("The inventory of the stocks is rebuilt from the ledger, from their earliest record imported.")
+	}
+	fmt.Println()
+
+	displayResults(report.Transactions)
+	fmt.Println()
+
+	fmt.Print("Stock No,\tQty Before,\tQty After,\tCost Before,\tCost After\n")
+	for _, c := range report.Changes {
+		fmt.Printf("%8s,\t%10d,\t%9d,\t%11s,\t%10s\n",
+			c.StockNo, c.QuantityBefore, c.QuantityAfter, c.CostBefore.StringFixed(2), c.CostAfter.StringFixed(2))
+	}
+}
+
+// resolveColumnMap returns the column map of --map or --profile, nil for the
+// positional columns, and the delimiter of --delimiter or the profile.
+func resolveColumnMap(cmd *cobra.Command) (importer.ColumnMap, rune, error) {
+	mapping, _ := cmd.Flags().GetString("map")
+	profileName, _ := cmd.Flags().GetString("profile")
+	delimiterStr, _ := cmd.Flags().GetString("delimiter")
+
+	var columnMap importer.ColumnMap
+	var err error
+	switch {
+	case mapping != "" && profileName != "":
+		return nil, 0, errors.New("--map and --profile cannot be used together")
+	case mapping != "":
+		columnMap, err = importer.ParseColumnMap(mapping)
+		if err != nil {
+			return nil, 0, err
+		}
+	case profileName != "":
+		profile, ok := cfg.ImportProfiles[profileName]
+		if !ok {
+			return nil, 0, fmt.Errorf("import profile '%s' is not defined in the config file '%s'", profileName, cfg.File())
+		}
+		columnMap = importer.ColumnMap(profile.Columns)
+		if err := columnMap.Validate(); err != nil {
+			return nil, 0, fmt.Errorf("import profile '%s': %w", profileName, err)
+		}
+		if !cmd.Flags().Changed("delimiter") {
+			delimiterStr = profile.Delimiter
+		}
+	}
+
+	delimiter, err := importer.ParseDelimiter(delimiterStr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return columnMap, delimiter, nil
+}
 
+// parsePositionalCSV parses the rows of date, time, stockNo, tranType,
+// quantity and unitPrice, reordered by swapColumn if given. The errors of all
+// the invalid rows are joined, one line each.
+func parsePositionalCSV(file io.Reader, delimiter rune, skipHeader bool, indexes string) ([]*model.TransactionRecord, error) {
 	fileReader := csv.NewReader(file)
+	fileReader.Comma = delimiter
 
 	if skipHeader {
 		_, err := fileReader.Read()
 		if err != nil {
 			if err == io.EOF {
-				fmt.Println("Error file empty.")
-			} else {
-				fmt.Println("Error reading header: ", err)
+				return nil, errors.New("file empty")
 			}
-			return
+			return nil, fmt.Errorf("reading header: %w", err)
 		}
 	}
 
 	rows, err := fileReader.ReadAll()
 	if err != nil {
-		fmt.Println("Error reading rows: ", err)
-		return
+		return nil, fmt.Errorf("reading rows: %w", err)
 	}
 
-	serv := service.InitializeService()
+	var records []*model.TransactionRecord
+	var rowErrs []error
+	for i, row := range rows {
+		line := i + 1
+		if skipHeader {
+			line++
+		}
 
-	var transactions []*model.Transaction
-	for _, row := range rows {
 		if indexes != "" {
 			row, err = swapColumn(row, indexes)
 			if err != nil {
-				fmt.Println("Error swaping column:", err)
-				return
+				return nil, fmt.Errorf("swaping column: %w", err)
 			}
 		}
 
 		tranDate, tranTime, stockNo, tranType, quantity, unitPrice, err := ParseTransactionForAddCmd(row)
 		if err != nil {
-			fmt.Println("Error parsing transaction data:", err)
-			return
-		}
-
-		newTransaction := model.NewTransactionFromInput(tranDate, tranTime, stockNo, tranType, quantity, unitPrice)
-		t, err := serv.AddTransaction(newTransaction)
-		if err != nil {
-			fmt.Println("Error adding transaction: ", err)
-		} else if t != nil {
-			transactions = append(transactions, t)
+			rowErrs = append(rowErrs, fmt.Errorf("line %d: %w", line, err))
+			continue
 		}
+		records = append(records, model.NewTransactionRecord(tranDate, tranTime, stockNo, tranType, quantity, unitPrice))
+	}
+	if len(rowErrs) > 0 {
+		return nil, errors.Join(rowErrs...)
 	}
 
-	displayResults(transactions)
-
-	// // TODO: create Transactions, bulk insert? Finally, I choose begin a db transaction
-	// ids, err := repo.CreateTransactions(transactions)
-	// if err != nil {
-	// 	fmt.Println("Error creating transaction: ", err)
-	// }
-
-	// fmt.Println("inserted ids:", ids)
-
-	// 	// Bool control show result or not
-	// 	transactions, err := repo.queryTransactionByID(id)
-	// 	if err != nil {
-	// 		fmt.Println("Error querying database:", err)
-	// 	}
+	return records, nil
+}
 
-	// Print out result
-	// displayResults(transactions)
+// newImportBatch creates the import batch of the file read as content.
+func newImportBatch(file *os.File, content []byte, format string) *model.ImportBatch {
+	hash := sha256.Sum256(content)
+	return &model.ImportBatch{
+		FileName:   filepath.Base(file.Name()),
+		FileHash:   hex.EncodeToString(hash[:]),
+		Format:     format,
+		ImportedAt: time.Now().Format(time.DateTime),
+	}
 }
 
 func swapColumn(row []string, indexes string) ([]string, error) {
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// import
+var importBatchCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import batch management",
+	Long: "" +
+		"Manage the files imported into the ledger by 'hermInvestCli stock import',\n" +
+		"e.g. with --format broker-commission or manual-excel.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var importListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the import batches",
+	Example: "" +
+		"  - List the files imported into the ledger:\n" +
+		"    hermInvestCli import list",
+	Args: cobra.NoArgs,
+	RunE: importListRun,
+}
+
+var importRevertCmd = &cobra.Command{
+	Use:   "revert batchID",
+	Short: "Remove an import batch and rebuild",
+	Example: "" +
+		"  - Remove the records imported by batch 3:\n" +
+		"    hermInvestCli import revert 3",
+	Long: "" +
+		"Remove the records of the ledger imported by the batch, then rebuild the records\n" +
+		"and the inventory without them, as 'hermInvestCli rebuild' does.",
+	Args: cobra.ExactArgs(1),
+	RunE: importRevertRun,
+}
+
+func init() {
+	rootCmd.AddCommand(importBatchCmd)
+	importBatchCmd.AddCommand(importListCmd)
+	importBatchCmd.AddCommand(importRevertCmd)
+
+	addCostBasisFlag(importRevertCmd)
+	addAllowShortFlag(importRevertCmd)
+}
+
+func importListRun(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	batches, err := serv.QueryImportBatchAll()
+	if err != nil {
+		return fmt.Errorf("error querying import batches: %w", err)
+	}
+
+	fmt.Print("ID,\tImported At,\tFormat,\tRows,\tFile Name,\tFile Hash\n")
+	for _, b := range batches {
+		fmt.Printf("%d,\t%19s,\t%17s,\t%5d,\t%s,\t%.12s\n", b.ID, b.ImportedAt, b.Format, b.RowCount, b.FileName, b.FileHash)
+	}
+
+	return nil
+}
+
+func importRevertRun(cmd *cobra.Command, args []string) error {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("error parsing batchID '%s': %v", args[0], err)
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+	allowShort, _ := cmd.Flags().GetBool("allow-short")
+	serv = serv.WithAllowShort(allowShort)
+
+	err = serv.RevertImportBatch(id)
+	if errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("import batch %d not found, run 'hermInvestCli import list'", id)
+	} else if err != nil {
+		if errors.Is(err, model.ErrOversell) {
+			fmt.Println("* Use --allow-short to record the excess as a short position.")
+		}
+		return fmt.Errorf("error reverting import batch, nothing is reverted: %w", err)
+	}
+
+	fmt.Printf("Reverted import batch %d, the records and the inventory are rebuilt.\n", id)
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ledgerCmd = &cobra.Command{
+	Use:   "ledger [--from <Date>] [--to <Date>] [--stockNo <StockNumber>] [--source <Source>]",
+	Short: "List the transaction ledger",
+	Example: "" +
+		"  - List the whole ledger:\n" +
+		"    hermInvestCli stock ledger\n\n" +
+
+		"  - List the trades of a stock in 2024:\n" +
+		"    hermInvestCli stock ledger --stockNo 0050 --from 2024-01-01 --to 2024-12-31\n\n" +
+
+		"  - List the records generated by the stock dividends:\n" +
+		"    hermInvestCli stock ledger --source corporate-action\n\n" +
+
+		"  - List the lots sold and bought again by the capital reductions:\n" +
+		"    hermInvestCli stock ledger --source capital-reduction",
+	Long: "" +
+		"List the transaction ledger in time order: the trades entered by hand, exported by the\n" +
+		"broker or added by the CLI and the web, and the records generated by the corporate\n" +
+		"actions, which the inventory is rebuilt from. The sources are manual, broker, cli, web,\n" +
+		"corporate-action for the stock dividends and capital-reduction. A capital reduction sells\n" +
+		"each lot and buys its shares left at the reduced unit price, under the new stock number if\n" +
+		"renamed; the inventory scales the lots in place instead, keeping their acquisition date.\n" +
+		"Run 'hermInvestCli rebuild' to regenerate the records of the corporate actions.",
+	Args: cobra.NoArgs,
+	RunE: ledgerRun,
+}
+
+func init() {
+	stockCmd.AddCommand(ledgerCmd)
+
+	ledgerCmd.Flags().String("from", "", "On or after the date")
+	ledgerCmd.Flags().String("to", "", "On or before the date")
+	ledgerCmd.Flags().String("stockNo", "", "Stock number")
+	ledgerCmd.Flags().String("source", "", "Source: manual, broker, cli, web, corporate-action or capital-reduction")
+}
+
+func ledgerRun(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+	sourceName, _ := cmd.Flags().GetString("source")
+
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+
+	var source model.RecordSource
+	if sourceName != "" {
+		var err error
+		source, err = model.ParseRecordSource(sourceName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	entries, err := serv.QueryLedger(from, to, stockNo)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	if source != 0 {
+		entries = filterLedgerEntries(entries, source)
+	}
+
+	displayLedgerEntries(entries)
+
+	return nil
+}
+
+// filterLedgerEntries returns the entries of the source.
+func filterLedgerEntries(entries []*model.LedgerEntry, source model.RecordSource) []*model.LedgerEntry {
+	var filtered []*model.LedgerEntry
+	for _, e := range entries {
+		if e.Source == source {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+func displayLedgerEntries(entries []*model.LedgerEntry) {
+	fmt.Print("Date,\tTime,\tStock No,\tStock Name,\tType,\tQty(shares),\tUnit Price,\tSource,\tBatch\n")
+	for _, e := range entries {
+		batch := "-"
+		if e.BatchID != nil {
+			batch = strconv.Itoa(*e.BatchID)
+		}
+		fmt.Printf("%10s,\t%12s,\t%8s,\t%s,\t%4d,\t%11d,\t%10s,\t%16s,\t%s\n",
+			e.Date, e.Time, e.StockNo, e.StockName, e.TranType, e.Quantity, e.UnitPrice.StringFixed(2), e.Source, batch)
+	}
+}
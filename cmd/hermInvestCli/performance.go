@@ -0,0 +1,93 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var performanceCmd = &cobra.Command{
+	Use:   "performance [--from <Date>] [--to <Date>] [--stockNo <StockNumber>]",
+	Short: "Report the XIRR and the time-weighted return",
+	Example: "" +
+		"  - Report the returns of the portfolio and each stock, YTD, 1Y and since inception:\n" +
+		"    hermInvestCli stock performance\n\n" +
+
+		"  - Report the returns until the close of a day:\n" +
+		"    hermInvestCli stock performance --to 2024-06-28\n\n" +
+
+		"  - Report the returns of a stock over 2024:\n" +
+		"    hermInvestCli stock performance --from 2024-01-01 --to 2024-12-31 --stockNo 0050",
+	Long: "" +
+		"Report the money-weighted return, the annual XIRR of the cash flows, and the time-weighted\n" +
+		"return of the portfolio and of each stock traded. The cash flows are the buys and the sells\n" +
+		"of the ledger with the fee and taxes recorded, and the cash received of tblTransactionCash. The\n" +
+		"holdings are valued as 'hermInvestCli stock value' does. Without --from the returns are\n" +
+		"reported over the year to date, the year and since inception until --to, the last day with\n" +
+		"a price or a transaction if not given.",
+	Args: cobra.NoArgs,
+	RunE: performanceRun,
+}
+
+func init() {
+	stockCmd.AddCommand(performanceCmd)
+
+	performanceCmd.Flags().String("from", "", "On or after the date")
+	performanceCmd.Flags().String("to", "", "On or before the date")
+	performanceCmd.Flags().String("stockNo", "", "Stock number")
+}
+
+func performanceRun(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	performances, err := serv.QueryPerformance(from, to, stockNo)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	displayPerformances(performances)
+
+	return nil
+}
+
+func displayPerformances(performances []*model.Performance) {
+	fmt.Print("Stock No,\tPeriod,\tFrom,\tTo,\tXIRR %,\tTWR %\n")
+	for _, p := range performances {
+		stockNo := p.StockNo
+		if stockNo == "" {
+			stockNo = "Total"
+		}
+		fmt.Printf("%8s,\t%9s,\t%10s,\t%10s,\t%8s,\t%8s\n",
+			stockNo, p.Period, p.From, p.To, percentOrNA(p.XIRR), percentOrNA(p.TWR))
+	}
+}
+
+// percentOrNA formats the rate as a percentage, or "N/A" if there is none.
+func percentOrNA(rate *float64) string {
+	if rate == nil {
+		return "N/A"
+	}
+	return fmt.Sprintf("%.2f", *rate*100)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var pnlCmd = &cobra.Command{
+	Use:   "pnl [--from <Date>] [--to <Date>] [--stockNo <StockNumber>]",
+	Short: "Report realized profit and loss",
+	Example: "" +
+		"  - Report all realized profit and loss:\n" +
+		"    hermInvestCli stock pnl\n\n" +
+
+		"  - Report the trades closed in 2024:\n" +
+		"    hermInvestCli stock pnl --from 2024-01-01 --to 2024-12-31\n\n" +
+
+		"  - Report the trades of a stock:\n" +
+		"    hermInvestCli stock pnl --stockNo 0050",
+	Long: "" +
+		"Report the realized profit and loss of closing trades, one row per lot written off.\n" +
+		"Trades are selected by the date they were closed.",
+	Args: cobra.NoArgs,
+	RunE: pnlRun,
+}
+
+func init() {
+	stockCmd.AddCommand(pnlCmd)
+
+	pnlCmd.Flags().String("from", "", "Closed on or after the date")
+	pnlCmd.Flags().String("to", "", "Closed on or before the date")
+	pnlCmd.Flags().String("stockNo", "", "Stock number")
+}
+
+func pnlRun(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	pnls, err := serv.QueryRealizedPnL(from, to, stockNo)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	displayRealizedPnL(pnls)
+
+	return nil
+}
+
+func displayRealizedPnL(pnls []*model.RealizedPnL) {
+	fmt.Print("Stock No,\tBuy Date,\tSell Date,\tQty(shares),\tBuy Price,\tSell Price,\tProceeds,\tCost,\tfee,\ttaxes,\tGain\n")
+	for _, pnl := range pnls {
+		fmt.Printf("%8s,\t%10s,\t%10s,\t%11d,\t%10s,\t%10s,\t%12s,\t%12s,\t%5d,\t%5d,\t%12s\n",
+			pnl.StockNo, pnl.BuyDate, pnl.SellDate, pnl.Quantity,
+			pnl.BuyUnitPrice.StringFixed(2), pnl.SellUnitPrice.StringFixed(2),
+			pnl.Proceeds.StringFixed(2), pnl.Cost.StringFixed(2), pnl.Fee, pnl.Taxes, pnl.Gain.StringFixed(2))
+	}
+
+	total := model.SumRealizedPnL(pnls)
+	fmt.Printf("%8s,\t%10s,\t%10s,\t%11d,\t%10s,\t%10s,\t%12s,\t%12s,\t%5d,\t%5d,\t%12s\n",
+		"Total", "", "", total.Quantity, "", "",
+		total.Proceeds.StringFixed(2), total.Cost.StringFixed(2), total.Fee, total.Taxes, total.Gain.StringFixed(2))
+}
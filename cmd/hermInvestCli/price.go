@@ -0,0 +1,174 @@
+package main
+
+import (
+	"HermInvest/pkg/importer"
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/quote"
+	"HermInvest/pkg/service"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// price
+var priceCmd = &cobra.Command{
+	Use:   "price",
+	Short: "Daily price management",
+	Long: "" +
+		"Manage the daily prices of the stocks in tblPrice, which value the inventory\n" +
+		"at the last close, see 'hermInvestCli stock query --summary'.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var priceImportCmd = &cobra.Command{
+	Use:   "import file... [--stockNo <StockNumber>]",
+	Short: "Import daily prices from STOCK_DAY csv files",
+	Example: "" +
+		"  - Import the prices of a month downloaded from TWSE or TPEx:\n" +
+		"    hermInvestCli price import STOCK_DAY_2330_202401.csv\n\n" +
+
+		"  - Import the prices of a year:\n" +
+		"    hermInvestCli price import STOCK_DAY_0050_2024*.csv\n\n" +
+
+		"  - Import a file without the stock number in its title:\n" +
+		"    hermInvestCli price import prices.csv --stockNo 0050",
+	Long: "" +
+		"Import the daily trading of a stock in a month (各日成交資訊), the csv file downloaded\n" +
+		"from TWSE (STOCK_DAY) or TPEx, in UTF-8 or Big5. The stock number is read from the\n" +
+		"title of the file, or given by --stockNo. Days without trades are skipped. The price\n" +
+		"of a stock on a date imported again is replaced. The files are imported all or\n" +
+		"nothing.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: priceImportRun,
+}
+
+var priceFetchCmd = &cobra.Command{
+	Use:   "fetch --stockNo <StockNumber> --from <Date> [--to <Date>] [--dir <Directory>]",
+	Short: "Fetch daily prices from TWSE",
+	Example: "" +
+		"  - Fetch the prices of 2024 of two stocks:\n" +
+		"    hermInvestCli price fetch --stockNo 2330,0050 --from 2024-01-01 --to 2024-12-31\n\n" +
+
+		"  - Fetch the prices up to today:\n" +
+		"    hermInvestCli price fetch --stockNo 0050 --from 2024-06-01\n\n" +
+
+		"  - Read the prices from the STOCK_DAY JSON files saved in a directory:\n" +
+		"    hermInvestCli price fetch --stockNo 2330 --from 2024-01-01 --dir ./quotes",
+	Long: "" +
+		"Fetch the daily trading of the stocks (STOCK_DAY JSON of TWSE), a request per stock and\n" +
+		"month, into tblPrice as 'hermInvestCli price import' does. The stocks traded on TPEx are\n" +
+		"not served by TWSE, import their files instead. The requests are apart by the interval and\n" +
+		"the failures of the network or the server are retried, both set in the config file with\n" +
+		"the website, which may be a local stand-in server:\n" +
+		"  \"quote\": {\"baseURL\": \"https://www.twse.com.tw\", \"interval\": \"2s\", \"retries\": 3}\n" +
+		"With --dir the prices are read from the files named like STOCK_DAY_2330_202401.json\n" +
+		"instead. The prices of a stock are stored once all its months are fetched. The other\n" +
+		"stocks are fetched after a stock fails, and the command fails with the errors of them all.",
+	Args: cobra.NoArgs,
+	RunE: priceFetchRun,
+}
+
+func init() {
+	rootCmd.AddCommand(priceCmd)
+	priceCmd.AddCommand(priceImportCmd)
+	priceCmd.AddCommand(priceFetchCmd)
+
+	priceImportCmd.Flags().String("stockNo", "", "Stock number of the files without a title")
+
+	priceFetchCmd.Flags().StringSlice("stockNo", nil, "Stock numbers, separated by commas")
+	priceFetchCmd.Flags().String("from", "", "Fetch on or after the date")
+	priceFetchCmd.Flags().String("to", "", "Fetch on or before the date (default today)")
+	priceFetchCmd.Flags().String("dir", "", "Read the STOCK_DAY JSON files of the directory instead")
+}
+
+func priceImportRun(cmd *cobra.Command, args []string) error {
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	var prices []*model.Price
+	for _, path := range args {
+		filePrices, err := readStockDay(path, stockNo)
+		if err != nil {
+			return fmt.Errorf("error parsing %s, nothing is imported: %w", path, err)
+		}
+		prices = append(prices, filePrices...)
+	}
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	err = serv.ImportPrices(prices)
+	if err != nil {
+		return fmt.Errorf("error importing prices, nothing is imported: %w", err)
+	}
+
+	fmt.Printf("Imported %d prices of %d files.\n", len(prices), len(args))
+	return nil
+}
+
+// readStockDay parses the prices of the STOCK_DAY file.
+func readStockDay(path, stockNo string) ([]*model.Price, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return importer.ParseStockDay(file, stockNo)
+}
+
+func priceFetchRun(cmd *cobra.Command, args []string) error {
+	stockNos, _ := cmd.Flags().GetStringSlice("stockNo")
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	dir, _ := cmd.Flags().GetString("dir")
+
+	if len(stockNos) == 0 || from == "" {
+		return errors.New("--stockNo and --from are required")
+	}
+	if to == "" {
+		to = time.Now().Format(time.DateOnly)
+	}
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	var provider quote.QuoteProvider
+	if dir != "" {
+		provider = quote.NewFileProvider(dir)
+	} else {
+		provider = quote.NewHTTPProvider(cfg.Quote.BaseURL, cfg.Quote.Interval, cfg.Quote.Retries)
+	}
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	// A failed stock doesn't stop the others, its error is returned with theirs
+	var errs []error
+	for _, stockNo := range stockNos {
+		prices, err := serv.FetchPrices(provider, stockNo, from, to)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error fetching %s, its prices are not stored: %w", stockNo, err))
+			continue
+		}
+		fmt.Printf("Fetched %d prices of %s from %s to %s.\n", len(prices), stockNo, from, to)
+	}
+
+	return errors.Join(errs...)
+}
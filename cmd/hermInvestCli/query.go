@@ -9,7 +9,7 @@ import (
 )
 
 var queryCmd = &cobra.Command{
-	Use:   `query {--all | --id <ID> | [--stockNo <StockNumber> --type <Type> --date <Date>]}`,
+	Use:   `query {--all | --summary | --id <ID> | [--stockNo <StockNumber> --type <Type> --date <Date>]}`,
 	Short: "Query stock (Transaction ID, Stock No., Type, or Date)",
 	Example: "" +
 		"  - Query by Transaction ID:\n" +
@@ -18,12 +18,19 @@ var queryCmd = &cobra.Command{
 		"  - Query all records:\n" +
 		"    hermInvestCli stock query --all\n\n" +
 
+		"  - Query the inventory per stock valued at the last close:\n" +
+		"    hermInvestCli stock query --summary\n\n" +
+
 		"  - Query by stock number:\n" +
 		"    hermInvestCli stock query --stockNo 0050\n\n" +
 
 		"  - Query by stock number, type, and date:\n" +
 		"    hermInvestCli stock query --stockNo 0050 --type 1 --date 2023-12-01",
-	Long: "Query stock by transaction ID, stock number, type, or date.",
+	Long: "" +
+		"Query stock by transaction ID, stock number, type, or date.\n" +
+		"The summary sums up the inventory per stock and values it at the last close imported\n" +
+		"by 'hermInvestCli price import'. The unrealized gain is the market value less the total\n" +
+		"amount, before the fee and taxes of selling.",
 	Args: cobra.NoArgs,
 	RunE: queryRun,
 }
@@ -32,6 +39,7 @@ func init() {
 	stockCmd.AddCommand(queryCmd)
 
 	queryCmd.Flags().Bool("all", false, "Query all records")
+	queryCmd.Flags().Bool("summary", false, "Query the inventory per stock with unrealized gain")
 	queryCmd.Flags().Int("id", 0, "Query by ID")
 	queryCmd.Flags().String("stockNo", "", "Stock number")
 	queryCmd.Flags().Int("type", 0, "Type")
@@ -44,12 +52,28 @@ func queryRun(cmd *cobra.Command, args []string) error {
 	}
 
 	all, _ := cmd.Flags().GetBool("all")
+	summary, _ := cmd.Flags().GetBool("summary")
 	id, _ := cmd.Flags().GetInt("id")
 	stockNo, _ := cmd.Flags().GetString("stockNo")
 	tranType, _ := cmd.Flags().GetInt("type")
 	date, _ := cmd.Flags().GetString("date")
 
-	serv := service.InitializeService()
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	if summary {
+		valuations, err := serv.QueryInventoryValuation()
+		if err != nil {
+			return fmt.Errorf("error querying database: %w", err)
+		}
+		displayValuations(valuations)
+		return nil
+	}
 
 	var transactions []*model.Transaction
 	var transactionsErr error
@@ -63,17 +87,37 @@ func queryRun(cmd *cobra.Command, args []string) error {
 		transactions, transactionsErr = serv.QueryTransactionByDetails(stockNo, tranType, date)
 	}
 	if transactionsErr != nil {
-		fmt.Println("Error querying database:", transactionsErr)
-	} else {
-		displayResults(transactions)
+		return fmt.Errorf("error querying database: %w", transactionsErr)
 	}
 
+	displayResults(transactions)
 	return nil
 }
 
 func displayResults(transactions []*model.Transaction) {
-	fmt.Print("ID,\tStock No,\tType,\tQty(shares),\tUnit Price,\tTotal Amount,\ttaxes\n")
+	fmt.Print("ID,\tStock No,\tType,\tQty(shares),\tUnit Price,\tTotal Amount,\ttaxes,\tfee\n")
 	for _, t := range transactions {
-		fmt.Printf("%d,\t%8s,\t%4d,\t%11d,\t%10.2f,\t%12d,\t%5d\n", t.ID, t.StockNo, t.TranType, t.Quantity, t.UnitPrice, t.TotalAmount, t.Taxes)
+		fmt.Printf("%d,\t%8s,\t%4d,\t%11d,\t%10s,\t%12s,\t%5d,\t%5d\n", t.ID, t.StockNo, t.TranType, t.Quantity, t.UnitPrice.StringFixed(2), t.TotalAmount.StringFixed(2), t.Taxes, t.Fee)
+	}
+}
+
+func displayValuations(valuations []*model.Valuation) {
+	fmt.Print("Stock No,\tQty(shares),\tUnit Price,\tTotal Amount,\tClose Date,\tLast Close,\tMarket Value,\tUnrealized Gain,\tGain %\n")
+	for _, v := range valuations {
+		fmt.Printf("%8s,\t%11d,\t%10s,\t%12s,\t%10s,\t%10s,\t%12s,\t%15s,\t%7s\n",
+			v.StockNo, v.Quantity, v.UnitPrice.StringFixed(2), v.TotalAmount.StringFixed(2),
+			v.CloseDate, fixedOrNA(v.LastClose), fixedOrNA(v.MarketValue), fixedOrNA(v.UnrealizedGain), fixedOrNA(v.GainPercent))
+	}
+
+	totalAmount, marketValue, unrealizedGain := model.SumValuations(valuations)
+	fmt.Printf("%8s,\t%11s,\t%10s,\t%12s,\t%10s,\t%10s,\t%12s,\t%15s,\t%7s\n",
+		"Total", "", "", totalAmount.StringFixed(2), "", "", marketValue.StringFixed(2), unrealizedGain.StringFixed(2), "")
+}
+
+// fixedOrNA formats the value with 2 decimal places, or "N/A" if it is nil.
+func fixedOrNA(d *model.Decimal) string {
+	if d == nil {
+		return "N/A"
 	}
+	return d.StringFixed(2)
 }
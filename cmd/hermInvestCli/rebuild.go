@@ -0,0 +1,168 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var rebuildCmd = &cobra.Command{
+	Use:   "rebuild [--dry-run] [--only records|inventory|cash] [--stockNo stockNo] [--from date] [--yes]",
+	Short: "Rebuild the records, the inventory and the cash dividends from the ledger",
+	Example: "" +
+		"  - Rebuild everything, confirming the changes first:\n" +
+		"    hermInvestCli rebuild\n\n" +
+
+		"  - Print what a rebuild writing off the latest lots first for the trades added\n" +
+		"    before their cost basis method was recorded would change:\n" +
+		"    hermInvestCli rebuild --dry-run --costBasis lifo\n\n" +
+
+		"  - Rebuild the cash dividends only, without confirmation:\n" +
+		"    hermInvestCli rebuild --only cash --yes\n\n" +
+
+		"  - Rebuild 2330 from 2024-06-01 on:\n" +
+		"    hermInvestCli rebuild --stockNo 2330 --from 2024-06-01",
+	Long: "" +
+		"Rebuild the tables derived from the ledger tblTransactionRecord and the corporate actions:\n" +
+		"  records    tblTransactionRecordSys, with the records of the capital reductions and\n" +
+		"             stock dividends\n" +
+		"  inventory  tblTransaction, tblTransactionHistory and tblRealizedPnL, replayed from the\n" +
+		"             records\n" +
+		"  cash       tblTransactionCash, the cash dividends and the cash refunded by the capital\n" +
+		"             reductions, with the cash in lieu of the fractional shares\n" +
+		"The rebuild is computed in a database transaction, and the shares, cost, records of the\n" +
+		"corporate actions and cash dividends of each stock changed are printed before and after.\n" +
+		"Once confirmed it is computed again and committed if it makes the same changes, or it is\n" +
+		"committed at once with --yes; nothing is changed if any part fails.\n" +
+		"--stockNo and --from limit the rebuild to the stock, and to the records from the date on;\n" +
+		"only the stocks traded or with a corporate action from the date are replayed, each from\n" +
+		"the last time it was flat before the date.\n" +
+		"The trades are replayed by the cost basis method and the lots recorded on the ledger when\n" +
+		"they were added; --costBasis applies to the ones added before they were recorded.",
+	Args: cobra.NoArgs,
+	RunE: rebuildRun,
+}
+
+func init() {
+	rootCmd.AddCommand(rebuildCmd)
+
+	rebuildCmd.Flags().Bool("dry-run", false, "Print the changes without rebuilding")
+	rebuildCmd.Flags().String("only", "", "Rebuild one part: "+strings.Join(service.RebuildParts, ", "))
+	rebuildCmd.Flags().String("stockNo", "", "Rebuild the stock only")
+	rebuildCmd.Flags().String("from", "", "Rebuild the records from the date on, e.g. 2024-06-01")
+	rebuildCmd.Flags().BoolP("yes", "y", false, "Commit without confirmation")
+	addCostBasisFlag(rebuildCmd)
+	addAllowShortFlag(rebuildCmd)
+}
+
+func rebuildRun(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	only, _ := cmd.Flags().GetString("only")
+	yes, _ := cmd.Flags().GetBool("yes")
+	allowShort, _ := cmd.Flags().GetBool("allow-short")
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+	from, _ := cmd.Flags().GetString("from")
+
+	if from != "" {
+		if _, err := time.Parse(time.DateOnly, from); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+	if only != "" {
+		if err := service.ValidateRebuildPart(only); err != nil {
+			return err
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	report, err := rebuild(only, service.RebuildScope{StockNo: stockNo, From: from}, allowShort, dryRun, yes)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case report.Committed:
+		fmt.Println("Rebuilt.")
+	case dryRun:
+		fmt.Println("\nDry run, nothing is rebuilt.")
+	default:
+		fmt.Println("Rebuild cancelled, nothing is changed.")
+	}
+
+	return nil
+}
+
+// rebuild rebuilds the part, or everything if part is empty, of the scope,
+// and prints the changes. Unless yes or dryRun, the changes are confirmed
+// once the database transaction computing them is rolled back, then the
+// rebuild is computed again and committed if it still makes the same changes.
+func rebuild(part string, scope service.RebuildScope, allowShort, dryRun, yes bool) (*service.RebuildReport, error) {
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+	serv = serv.WithAllowShort(allowShort)
+
+	report, err := serv.Rebuild(part, scope, func(report *service.RebuildReport) bool {
+		displayRebuildReport(report)
+		return !dryRun && yes
+	})
+	if err != nil {
+		return nil, rebuildError(err)
+	}
+	if report.Committed || dryRun || !confirmRebuild() {
+		return report, nil
+	}
+
+	confirmed, err := serv.Rebuild(part, scope, func(again *service.RebuildReport) bool {
+		return reflect.DeepEqual(again.Changes, report.Changes)
+	})
+	if err != nil {
+		return nil, rebuildError(err)
+	}
+	if !confirmed.Committed {
+		return nil, errors.New("the database changed while confirming, nothing is changed, rebuild again")
+	}
+
+	return confirmed, nil
+}
+
+// rebuildError explains the error of a rebuild.
+func rebuildError(err error) error {
+	if errors.Is(err, model.ErrOversell) {
+		fmt.Println("* Use --allow-short to record the excess as a short position, 'hermInvestCli stock check' lists the over-sells.")
+	}
+	return fmt.Errorf("error rebuilding, nothing is changed: %w", err)
+}
+
+func displayRebuildReport(report *service.RebuildReport) {
+	if len(report.Changes) == 0 {
+		fmt.Println("No stock is changed.")
+		return
+	}
+
+	fmt.Print("Stock No,\tQty Before,\tQty After,\tCost Before,\tCost After,\tRecords Before,\tRecords After,\tCash Before,\tCash After\n")
+	for _, c := range report.Changes {
+		fmt.Printf("%8s,\t%10d,\t%9d,\t%11s,\t%10s,\t%14d,\t%13d,\t%11d,\t%10d\n",
+			c.StockNo, c.QuantityBefore, c.QuantityAfter, c.CostBefore.StringFixed(2), c.CostAfter.StringFixed(2),
+			c.RecordsBefore, c.RecordsAfter, c.CashBefore, c.CashAfter)
+	}
+}
+
+func confirmRebuild() bool {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("\nCommit the rebuild? (yes/no): ")
+	text, _ := reader.ReadString('\n')
+
+	return strings.TrimSpace(text) == "yes"
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"HermInvest/pkg/model"
 	"HermInvest/pkg/service"
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -21,41 +23,52 @@ var updateCmd = &cobra.Command{
 	Example: "" +
 		"  - Update unit Price by ID:\n" +
 		"    hermInvestCli stock update 11 20.3",
-	Long: `Update the unit price of stock in the inventory using the transaction ID.`,
+	Long: "" +
+		"Update the unit price of stock in the inventory using the transaction ID.\n" +
+		"The unit price of the trade of the ledger tblTransactionRecord that opened the lot is updated,\n" +
+		"its fee and taxes are charged again, and the records and the inventory of the stock are rebuilt\n" +
+		"from its date, so a later rebuild keeps the update.",
 	Args: cobra.ExactArgs(2),
-	Run:  updateRun,
+	RunE: updateRun,
 }
 
 func init() {
 	stockCmd.AddCommand(updateCmd)
 }
 
-func updateRun(cmd *cobra.Command, args []string) {
+func updateRun(cmd *cobra.Command, args []string) error {
 	transactionID, err := strconv.Atoi(args[0])
 	if err != nil {
-		fmt.Println("Error parsing integer: ", err)
+		return fmt.Errorf("error parsing integer: %s", err)
 	}
-	unitPrice, err := strconv.ParseFloat(args[1], 64)
+	unitPrice, err := model.ParseDecimal(args[1])
 	if err != nil {
-		fmt.Println("Error parsing float: ", err)
+		return fmt.Errorf("error parsing decimal: %s", err)
 	}
 
-	serv := service.InitializeService()
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
 
-	t, err := serv.QueryTransactionByID(transactionID)
+	serv, err := service.InitializeService(cfg)
 	if err != nil {
-		fmt.Println("Error querying database:", err)
+		exitOnDBError(err)
 	}
 
-	// TODO: check update work. ex: update a fake transaction ID to db
-	t.SetUnitPrice(unitPrice) // update unit Price
+	entry, err := serv.UpdateTransaction(transactionID, unitPrice)
+	if errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("transaction ID %d not found", transactionID)
+	} else if err != nil {
+		return fmt.Errorf("error updating stock information, nothing is changed: %w", err)
+	}
+
+	fmt.Printf("Successfully updated transaction ID %d with new unit price %s\n", transactionID, unitPrice.StringFixed(2))
 
-	// update db
-	err = serv.UpdateTransaction(t.ID, t)
+	ts, err := serv.QueryTransactionByDetails(entry.StockNo, 0, "")
 	if err != nil {
-		fmt.Println("Error updating stock information:", err)
-		return
+		return fmt.Errorf("error querying database: %w", err)
 	}
+	fmt.Printf("The inventory is rebuilt from the ledger, the lots of %s:\n", entry.StockNo)
+	displayResults(ts)
 
-	fmt.Printf("Successfully updated transaction ID %d with new unit price %.2f\n", t.ID, t.UnitPrice)
+	return nil
 }
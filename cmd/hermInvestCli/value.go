@@ -0,0 +1,101 @@
+package main
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/service"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var valueCmd = &cobra.Command{
+	Use:   "value [--daily] [--from <Date>] [--to <Date>] [--stockNo <StockNumber>]",
+	Short: "Report the portfolio value",
+	Example: "" +
+		"  - Report the holdings and their value at the last close:\n" +
+		"    hermInvestCli stock value\n\n" +
+
+		"  - Report the holdings at the close of a day:\n" +
+		"    hermInvestCli stock value --to 2024-06-28\n\n" +
+
+		"  - Report the value of each day of 2024:\n" +
+		"    hermInvestCli stock value --daily --from 2024-01-01 --to 2024-12-31\n\n" +
+
+		"  - Report the value of a stock of each day:\n" +
+		"    hermInvestCli stock value --daily --stockNo 0050",
+	Long: "" +
+		"Report the holdings replayed from the ledger and the corporate actions, valued at the\n" +
+		"closes of tblPrice, see 'hermInvestCli price'. The cost is the unit price times the\n" +
+		"shares of the lots held, before fees and taxes, and a stock without a price yet is valued\n" +
+		"at its cost. The days are the ones with a price or a transaction. Without --daily the\n" +
+		"holdings of the last day are reported per stock.",
+	Args: cobra.NoArgs,
+	RunE: valueRun,
+}
+
+func init() {
+	stockCmd.AddCommand(valueCmd)
+
+	valueCmd.Flags().Bool("daily", false, "Report the total value of each day")
+	valueCmd.Flags().String("from", "", "On or after the date")
+	valueCmd.Flags().String("to", "", "On or before the date")
+	valueCmd.Flags().String("stockNo", "", "Stock number")
+}
+
+func valueRun(cmd *cobra.Command, args []string) error {
+	daily, _ := cmd.Flags().GetBool("daily")
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	stockNo, _ := cmd.Flags().GetString("stockNo")
+
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+
+	// The arguments are valid, the errors from here on are not usage errors
+	cmd.SilenceUsage = true
+
+	serv, err := service.InitializeService(cfg)
+	if err != nil {
+		exitOnDBError(err)
+	}
+
+	days, err := serv.QueryPortfolioTimeSeries(from, to, stockNo)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	if daily {
+		displayPortfolioDays(days)
+	} else if len(days) > 0 {
+		displayPortfolioDay(days[len(days)-1])
+	}
+
+	return nil
+}
+
+func displayPortfolioDays(days []*model.PortfolioDay) {
+	fmt.Print("Date,\tCost,\tMarket Value,\tUnrealized Gain\n")
+	for _, d := range days {
+		fmt.Printf("%10s,\t%12s,\t%12s,\t%15s\n",
+			d.Date, d.Total.Cost.StringFixed(2), d.Total.MarketValue.StringFixed(2), d.Total.MarketValue.Sub(d.Total.Cost).StringFixed(2))
+	}
+}
+
+func displayPortfolioDay(day *model.PortfolioDay) {
+	fmt.Print("Date,\tStock No,\tQty(shares),\tCost,\tLast Close,\tMarket Value,\tUnrealized Gain\n")
+	for _, v := range day.Stocks {
+		fmt.Printf("%10s,\t%8s,\t%11d,\t%12s,\t%10s,\t%12s,\t%15s\n",
+			day.Date, v.StockNo, v.Quantity, v.Cost.StringFixed(2), fixedOrNA(v.LastClose),
+			v.MarketValue.StringFixed(2), v.MarketValue.Sub(v.Cost).StringFixed(2))
+	}
+	fmt.Printf("%10s,\t%8s,\t%11s,\t%12s,\t%10s,\t%12s,\t%15s\n",
+		day.Date, "Total", "", day.Total.Cost.StringFixed(2), "",
+		day.Total.MarketValue.StringFixed(2), day.Total.MarketValue.Sub(day.Total.Cost).StringFixed(2))
+}
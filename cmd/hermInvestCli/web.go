@@ -1,16 +1,20 @@
 package main
 
 import (
+	"HermInvest/pkg/model"
 	"HermInvest/pkg/repository"
+	"HermInvest/pkg/service"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 var webCmd = &cobra.Command{
@@ -18,11 +22,25 @@ var webCmd = &cobra.Command{
 	Run: webRun,
 }
 
+// The database shared by the handlers, opened and checked once by webRun.
+// webDBErr tells why it is unusable, then the handlers respond 503.
+var (
+	webDB    *gorm.DB
+	webDBErr error
+)
+
 func init() {
 	stockCmd.AddCommand(webCmd)
 }
 
 func webRun(cmd *cobra.Command, args []string) {
+	webDB, webDBErr = repository.GetDBConnection(cfg.DBPath, cfg.AutoMigrate)
+	if webDBErr != nil {
+		fmt.Println("err: ", webDBErr)
+	} else if sqlDB, err := webDB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
 	router := gin.Default()
 
 	// load HTML files - Is it a best way?
@@ -33,6 +51,12 @@ func webRun(cmd *cobra.Command, args []string) {
 	router.GET("/api/transaction", apiGetTransactions)
 	router.GET("/transactionDetails/:stockNo", transactionDetailsPage)
 	router.GET("/api/transaction/:stockNo", apiGetTransactionsByStockNo)
+	router.GET("/api/pnl", apiGetRealizedPnL)
+	router.GET("/api/ledger", apiGetLedger)
+	router.GET("/portfolio", portfolioPage)
+	router.GET("/api/portfolio/timeseries", apiGetPortfolioTimeSeries)
+	router.GET("/api/portfolio/benchmark", apiGetBenchmarkTimeSeries)
+	router.GET("/api/performance", apiGetPerformance)
 	router.Static("/assets", "./assets")
 
 	open("http://127.0.0.1:9453/transaction")
@@ -86,7 +110,10 @@ func apiGetTransactions(c *gin.Context) {
 	// 		},
 	// 	},
 	// }
-	db := repository.GetDBConnection()
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
 
 	// init transactionRepository
 	repo := repository.NewRepository(db)
@@ -98,11 +125,22 @@ func apiGetTransactions(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, transactions)
+	prices, err := repo.QueryLatestPriceAll()
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query price"})
+		return
+	}
+
+	// the inventory per stock valued at the last close
+	c.JSON(http.StatusOK, model.NewValuations(transactions, prices))
 }
 
 func apiGetTransactionsByStockNo(c *gin.Context) {
-	db := repository.GetDBConnection()
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
 
 	repo := repository.NewRepository(db)
 
@@ -118,6 +156,214 @@ func apiGetTransactionsByStockNo(c *gin.Context) {
 	c.JSON(http.StatusOK, transactions)
 }
 
+// apiGetRealizedPnL responds the realized profit and loss, filtered by the
+// query parameters from, to and stockNo like 'stock pnl'.
+func apiGetRealizedPnL(c *gin.Context) {
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
+
+	repo := repository.NewRepository(db)
+
+	from := c.Query("from")
+	to := c.Query("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date '%s'", date)})
+			return
+		}
+	}
+
+	pnls, err := repo.QueryRealizedPnL(from, to, c.Query("stockNo"))
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query realized pnl"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"records": pnls,
+		"total":   model.SumRealizedPnL(pnls),
+	})
+}
+
+func apiGetLedger(c *gin.Context) {
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
+
+	repo := repository.NewRepository(db)
+
+	from := c.Query("from")
+	to := c.Query("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date '%s'", date)})
+			return
+		}
+	}
+
+	var source model.RecordSource
+	if name := c.Query("source"); name != "" {
+		var err error
+		source, err = model.ParseRecordSource(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	entries, err := repo.QueryLedger(from, to, c.Query("stockNo"))
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query ledger"})
+		return
+	}
+	if source != 0 {
+		entries = filterLedgerEntries(entries, source)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// apiGetPortfolioTimeSeries responds the holdings and their value at the
+// close of each day, filtered by the query parameters from, to and stockNo
+// like 'stock value --daily'.
+func apiGetPortfolioTimeSeries(c *gin.Context) {
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
+
+	// the series only reads, the fee and tax schedules are not needed
+	serv := service.NewService(repository.NewRepository(db), nil, nil, nil)
+
+	from := c.Query("from")
+	to := c.Query("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date '%s'", date)})
+			return
+		}
+	}
+
+	days, err := serv.QueryPortfolioTimeSeries(from, to, c.Query("stockNo"))
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query portfolio time series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, days)
+}
+
+func apiGetBenchmarkTimeSeries(c *gin.Context) {
+	benchmarkNo := c.Query("benchmark")
+	if benchmarkNo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the benchmark is required"})
+		return
+	}
+	from := c.Query("from")
+	to := c.Query("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date '%s'", date)})
+			return
+		}
+	}
+
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
+
+	// the cash flows have the fees and taxes recorded, the schedules are not
+	// needed
+	serv := service.NewService(repository.NewRepository(db), nil, nil, nil)
+
+	values, err := serv.QueryBenchmarkTimeSeries(benchmarkNo, from, to, c.Query("stockNo"))
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, values)
+}
+
+func apiGetPerformance(c *gin.Context) {
+	from := c.Query("from")
+	to := c.Query("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date '%s'", date)})
+			return
+		}
+	}
+
+	db, ok := openDB(c)
+	if !ok {
+		return
+	}
+
+	// the cash flows have the fees and taxes recorded, the schedules are not
+	// needed
+	serv := service.NewService(repository.NewRepository(db), nil, nil, nil)
+
+	performances, err := serv.QueryPerformance(from, to, c.Query("stockNo"))
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query performance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, performances)
+}
+
+// openDB returns the database shared by the handlers for a request. If the
+// database was unusable when the server started, or can't be reached since,
+// it responds 503 Service Unavailable and returns false.
+func openDB(c *gin.Context) (*gorm.DB, bool) {
+	err := webDBErr
+	if err == nil {
+		err = pingDB(webDB)
+	}
+	if err != nil {
+		fmt.Println("err: ", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return webDB, true
+}
+
+// pingDB checks the connection pool of db still reaches the database.
+func pingDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Ping()
+}
+
 func transactionPage(c *gin.Context) {
 
 	var pageHTML []byte
@@ -129,6 +375,16 @@ func transactionPage(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html", pageHTML)
 }
 
+func portfolioPage(c *gin.Context) {
+	var pageHTML []byte
+	pageHTML, err := os.ReadFile("html/portfolio.html")
+	if err != nil {
+		log.Fatal("os.ReadFile: ", err)
+	}
+
+	c.Data(http.StatusOK, "text/html", pageHTML)
+}
+
 func transactionDetailsPage(c *gin.Context) {
 
 	stockNo := c.Param("stockNo")
@@ -1,14 +1,25 @@
 package main
 
 import (
+	"HermInvest/pkg/config"
 	"database/sql"
+	"flag"
 	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	db, err := sql.Open("sqlite3", "./internal/app/database/dev-database.db")
+	dbFlag := flag.String("db", "", "Database path (overrides $"+config.EnvDBPath+" and the config file)")
+	flag.Parse()
+
+	cfg, err := config.Load(config.Flags{DBPath: *dbFlag})
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		return
+	}
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -0,0 +1,402 @@
+// Package config resolves the settings shared by the CLI, the web server and
+// the internal tools.
+//
+// A setting is taken from, in order of precedence:
+//  1. the command line flag (e.g. --db)
+//  2. the environment variable (e.g. HERMINVEST_DB)
+//  3. the config file ($XDG_CONFIG_HOME/hermInvest/config.json)
+//  4. the built-in default
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	appName        = "hermInvest"
+	configFileName = "config.json"
+	dbFileName     = "hermInvest.db"
+
+	// EnvConfigFile overrides the location of the config file.
+	EnvConfigFile = "HERMINVEST_CONFIG"
+	// EnvDBPath overrides the location of the SQLite database.
+	EnvDBPath = "HERMINVEST_DB"
+	// EnvAutoMigrate enables migrating an outdated database on connection.
+	EnvAutoMigrate = "HERMINVEST_AUTO_MIGRATE"
+	// EnvBroker selects the broker account whose fee schedule is used.
+	EnvBroker = "HERMINVEST_BROKER"
+	// EnvCostBasis selects the cost basis method matching sells to lots.
+	EnvCostBasis = "HERMINVEST_COST_BASIS"
+	// EnvQuoteBaseURL overrides the website the daily prices are fetched from.
+	EnvQuoteBaseURL = "HERMINVEST_QUOTE_BASE_URL"
+
+	// DefaultBroker charges the standard TWSE commission without discount.
+	DefaultBroker = "default"
+)
+
+// Defaults of fetching the daily prices from TWSE.
+const (
+	DefaultQuoteBaseURL  = "https://www.twse.com.tw"
+	DefaultQuoteInterval = 2 * time.Second // TWSE blocks more than about 3 requests in 5 seconds
+	DefaultQuoteRetries  = 3
+)
+
+// Cost basis methods, deciding which lots a sell writes off.
+const (
+	CostBasisFIFO     = "fifo"     // first in, first out
+	CostBasisLIFO     = "lifo"     // last in, first out
+	CostBasisAverage  = "average"  // moving average of the lots held
+	CostBasisSpecific = "specific" // the lots referenced by the sell
+
+	DefaultCostBasis = CostBasisFIFO
+)
+
+// CostBasisMethods lists the valid cost basis methods.
+var CostBasisMethods = []string{CostBasisFIFO, CostBasisLIFO, CostBasisAverage, CostBasisSpecific}
+
+// ValidateCostBasis returns an error if method is not a cost basis method.
+func ValidateCostBasis(method string) error {
+	for _, m := range CostBasisMethods {
+		if m == method {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown cost basis method '%s', valid methods are: %s",
+		method, strings.Join(CostBasisMethods, ", "))
+}
+
+// Source describes where the value of a setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Config holds the effective settings.
+type Config struct {
+	DBPath      string
+	AutoMigrate bool
+	Broker      string
+	Account     Account // settings of the Broker account
+	CostBasis   string
+
+	// ImportProfiles are the saved column mappings of stock import, by name.
+	ImportProfiles map[string]ImportProfile
+
+	Quote Quote
+
+	file    string
+	sources map[string]Source
+}
+
+// Account is the settings of a broker account: its broker commission
+// (手續費) and, optionally, its own cost basis method.
+type Account struct {
+	FeeRate     float64 `json:"feeRate"`
+	FeeDiscount float64 `json:"feeDiscount"` // e.g. 0.6 for 六折
+	MinimumFee  int     `json:"minimumFee"`
+	CostBasis   string  `json:"costBasis"` // empty for the top-level costBasis
+}
+
+// DefaultAccount charges the standard TWSE commission without discount.
+func DefaultAccount() Account {
+	return Account{FeeRate: 0.001425, FeeDiscount: 1, MinimumFee: 20}
+}
+
+// UnmarshalJSON fills the fields missing in the config file with the ones of
+// DefaultAccount.
+func (a *Account) UnmarshalJSON(data []byte) error {
+	type alias Account // avoid infinite recursion
+	decoded := alias(DefaultAccount())
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&decoded); err != nil {
+		return err
+	}
+
+	*a = Account(decoded)
+	return nil
+}
+
+// ImportProfile maps the fields of a transaction to the columns of a CSV
+// file to import, e.g. {"date": "成交日期", "stockNo": "代號"}.
+type ImportProfile struct {
+	Columns   map[string]string `json:"columns"`
+	Delimiter string            `json:"delimiter"` // empty for ","
+}
+
+// Quote is the settings of fetching the daily prices: the website, the
+// interval between the requests and the retries of a failed request.
+type Quote struct {
+	BaseURL  string
+	Interval time.Duration
+	Retries  int
+}
+
+// fileQuote is the layout of the quote settings in the config file, e.g.
+// {"baseURL": "http://127.0.0.1:8080", "interval": "500ms", "retries": 1}.
+type fileQuote struct {
+	BaseURL  string `json:"baseURL"`
+	Interval string `json:"interval"`
+	Retries  *int   `json:"retries"`
+}
+
+// fileConfig is the layout of the config file. Pointer fields tell an unset
+// value apart from a zero one.
+type fileConfig struct {
+	DBPath      string             `json:"dbPath"`
+	AutoMigrate *bool              `json:"autoMigrate"`
+	Broker      string             `json:"broker"`
+	Brokers     map[string]Account `json:"brokers"`
+	CostBasis   string             `json:"costBasis"`
+
+	ImportProfiles map[string]ImportProfile `json:"importProfiles"`
+	Quote          fileQuote                `json:"quote"`
+}
+
+// Flags holds the values of the command line flags, empty if not given.
+type Flags struct {
+	DBPath    string
+	Broker    string
+	CostBasis string
+}
+
+// Setting is a single resolved setting, used to print the effective config.
+type Setting struct {
+	Key    string
+	Value  string
+	Source Source
+}
+
+// Load resolves the config with the given command line flags.
+func Load(flags Flags) (*Config, error) {
+	dbPath, err := DefaultDBPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		DBPath:    dbPath,
+		Broker:    DefaultBroker,
+		CostBasis: DefaultCostBasis,
+		Quote:     Quote{BaseURL: DefaultQuoteBaseURL, Interval: DefaultQuoteInterval, Retries: DefaultQuoteRetries},
+		sources: map[string]Source{
+			"dbPath":        SourceDefault,
+			"autoMigrate":   SourceDefault,
+			"broker":        SourceDefault,
+			"costBasis":     SourceDefault,
+			"quoteBaseURL":  SourceDefault,
+			"quoteInterval": SourceDefault,
+			"quoteRetries":  SourceDefault,
+		},
+	}
+
+	file, err := FilePath()
+	if err != nil {
+		return nil, err
+	}
+	cfg.file = file
+
+	fileCfg, err := readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if fileCfg.DBPath != "" {
+		cfg.DBPath = resolvePath(fileCfg.DBPath, filepath.Dir(file))
+		cfg.sources["dbPath"] = SourceFile
+	}
+	if fileCfg.AutoMigrate != nil {
+		cfg.AutoMigrate = *fileCfg.AutoMigrate
+		cfg.sources["autoMigrate"] = SourceFile
+	}
+	if fileCfg.Broker != "" {
+		cfg.Broker = fileCfg.Broker
+		cfg.sources["broker"] = SourceFile
+	}
+
+	if v := os.Getenv(EnvDBPath); v != "" {
+		cfg.DBPath = resolvePath(v, "")
+		cfg.sources["dbPath"] = SourceEnv
+	}
+	if v := os.Getenv(EnvAutoMigrate); v != "" {
+		autoMigrate, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of $%s: %w", EnvAutoMigrate, err)
+		}
+		cfg.AutoMigrate = autoMigrate
+		cfg.sources["autoMigrate"] = SourceEnv
+	}
+	if v := os.Getenv(EnvBroker); v != "" {
+		cfg.Broker = v
+		cfg.sources["broker"] = SourceEnv
+	}
+
+	if flags.DBPath != "" {
+		cfg.DBPath = resolvePath(flags.DBPath, "")
+		cfg.sources["dbPath"] = SourceFlag
+	}
+	if flags.Broker != "" {
+		cfg.Broker = flags.Broker
+		cfg.sources["broker"] = SourceFlag
+	}
+
+	account, ok := fileCfg.Brokers[cfg.Broker]
+	if ok {
+		cfg.sources["feeSchedule"] = SourceFile
+	} else if cfg.Broker == DefaultBroker {
+		account = DefaultAccount()
+		cfg.sources["feeSchedule"] = SourceDefault
+	} else {
+		return nil, fmt.Errorf("broker '%s' is not defined in the brokers of config file '%s'", cfg.Broker, file)
+	}
+	cfg.Account = account
+
+	// The cost basis of the account is more specific than the top-level one,
+	// but still a setting of the file.
+	if fileCfg.CostBasis != "" {
+		cfg.CostBasis = fileCfg.CostBasis
+		cfg.sources["costBasis"] = SourceFile
+	}
+	if account.CostBasis != "" {
+		cfg.CostBasis = account.CostBasis
+		cfg.sources["costBasis"] = SourceFile
+	}
+	if v := os.Getenv(EnvCostBasis); v != "" {
+		cfg.CostBasis = v
+		cfg.sources["costBasis"] = SourceEnv
+	}
+	if flags.CostBasis != "" {
+		cfg.CostBasis = flags.CostBasis
+		cfg.sources["costBasis"] = SourceFlag
+	}
+	if err := ValidateCostBasis(cfg.CostBasis); err != nil {
+		return nil, err
+	}
+
+	cfg.ImportProfiles = fileCfg.ImportProfiles
+
+	if fileCfg.Quote.BaseURL != "" {
+		cfg.Quote.BaseURL = fileCfg.Quote.BaseURL
+		cfg.sources["quoteBaseURL"] = SourceFile
+	}
+	if fileCfg.Quote.Interval != "" {
+		interval, err := time.ParseDuration(fileCfg.Quote.Interval)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid quote interval '%s' in config file '%s', want e.g. '2s'", fileCfg.Quote.Interval, file)
+		}
+		cfg.Quote.Interval = interval
+		cfg.sources["quoteInterval"] = SourceFile
+	}
+	if fileCfg.Quote.Retries != nil {
+		if *fileCfg.Quote.Retries < 0 {
+			return nil, fmt.Errorf("invalid quote retries %d in config file '%s'", *fileCfg.Quote.Retries, file)
+		}
+		cfg.Quote.Retries = *fileCfg.Quote.Retries
+		cfg.sources["quoteRetries"] = SourceFile
+	}
+	if v := os.Getenv(EnvQuoteBaseURL); v != "" {
+		cfg.Quote.BaseURL = v
+		cfg.sources["quoteBaseURL"] = SourceEnv
+	}
+
+	return cfg, nil
+}
+
+// FilePath returns the location of the config file. It does not check
+// whether the file exists.
+func FilePath() (string, error) {
+	if v := os.Getenv(EnvConfigFile); v != "" {
+		return resolvePath(v, ""), nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to locate the user config directory: %w", err)
+	}
+
+	return filepath.Join(dir, appName, configFileName), nil
+}
+
+// DefaultDBPath returns the location of the database when none is set, next
+// to the default config file ($XDG_CONFIG_HOME/hermInvest/hermInvest.db), so
+// it doesn't depend on the working directory.
+func DefaultDBPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to locate the user config directory: %w", err)
+	}
+
+	return filepath.Join(dir, appName, dbFileName), nil
+}
+
+// File returns the location of the config file in use.
+func (cfg *Config) File() string {
+	return cfg.file
+}
+
+// Settings returns the effective settings and their sources.
+func (cfg *Config) Settings() []Setting {
+	return []Setting{
+		{Key: "dbPath", Value: cfg.DBPath, Source: cfg.sources["dbPath"]},
+		{Key: "autoMigrate", Value: strconv.FormatBool(cfg.AutoMigrate), Source: cfg.sources["autoMigrate"]},
+		{Key: "broker", Value: cfg.Broker, Source: cfg.sources["broker"]},
+		{Key: "feeRate", Value: strconv.FormatFloat(cfg.Account.FeeRate, 'f', -1, 64), Source: cfg.sources["feeSchedule"]},
+		{Key: "feeDiscount", Value: strconv.FormatFloat(cfg.Account.FeeDiscount, 'f', -1, 64), Source: cfg.sources["feeSchedule"]},
+		{Key: "minimumFee", Value: strconv.Itoa(cfg.Account.MinimumFee), Source: cfg.sources["feeSchedule"]},
+		{Key: "costBasis", Value: cfg.CostBasis, Source: cfg.sources["costBasis"]},
+		{Key: "quoteBaseURL", Value: cfg.Quote.BaseURL, Source: cfg.sources["quoteBaseURL"]},
+		{Key: "quoteInterval", Value: cfg.Quote.Interval.String(), Source: cfg.sources["quoteInterval"]},
+		{Key: "quoteRetries", Value: strconv.Itoa(cfg.Quote.Retries), Source: cfg.sources["quoteRetries"]},
+	}
+}
+
+// readFile reads the config file. A missing file is not an error, it
+// results in an empty config.
+func readFile(path string) (*fileConfig, error) {
+	fileCfg := &fileConfig{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fileCfg, nil
+		}
+		return nil, fmt.Errorf("unable to read config file '%s': %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(fileCfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file '%s': %w", path, err)
+	}
+
+	return fileCfg, nil
+}
+
+// resolvePath expands a leading '~' to the home directory. A relative path
+// is joined with baseDir if baseDir is given, so paths in the config file are
+// relative to the file itself rather than the working directory.
+func resolvePath(path, baseDir string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+
+	if baseDir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+
+	return path
+}
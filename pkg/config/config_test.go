@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	configDir := t.TempDir()
+	fileDir := t.TempDir()
+
+	fileJSON := `{
+		"dbPath": "file.db",
+		"broker": "fileBroker",
+		"brokers": {
+			"fileBroker": {"feeDiscount": 0.6},
+			"accountBroker": {"costBasis": "average"},
+			"envBroker": {},
+			"flagBroker": {}
+		},
+		"costBasis": "lifo"
+	}`
+
+	tests := []struct {
+		name       string
+		file       string // empty for no config file
+		env        map[string]string
+		flags      Flags
+		key        string
+		wantValue  string
+		wantSource Source
+	}{
+		{name: "dbPath default", key: "dbPath",
+			wantValue: filepath.Join(configDir, appName, dbFileName), wantSource: SourceDefault},
+		{name: "dbPath file, relative to the file", file: fileJSON, key: "dbPath",
+			wantValue: filepath.Join(fileDir, "file.db"), wantSource: SourceFile},
+		{name: "dbPath env over file", file: fileJSON, env: map[string]string{EnvDBPath: "/env.db"}, key: "dbPath",
+			wantValue: "/env.db", wantSource: SourceEnv},
+		{name: "dbPath flag over env", file: fileJSON, env: map[string]string{EnvDBPath: "/env.db"},
+			flags: Flags{DBPath: "/flag.db"}, key: "dbPath", wantValue: "/flag.db", wantSource: SourceFlag},
+
+		{name: "broker default", key: "broker", wantValue: DefaultBroker, wantSource: SourceDefault},
+		{name: "broker file", file: fileJSON, key: "broker", wantValue: "fileBroker", wantSource: SourceFile},
+		{name: "broker env over file", file: fileJSON, env: map[string]string{EnvBroker: "envBroker"}, key: "broker",
+			wantValue: "envBroker", wantSource: SourceEnv},
+		{name: "broker flag over env", file: fileJSON, env: map[string]string{EnvBroker: "envBroker"},
+			flags: Flags{Broker: "flagBroker"}, key: "broker", wantValue: "flagBroker", wantSource: SourceFlag},
+		{name: "fee schedule of the broker", file: fileJSON, key: "feeDiscount", wantValue: "0.6", wantSource: SourceFile},
+
+		{name: "costBasis default", key: "costBasis", wantValue: DefaultCostBasis, wantSource: SourceDefault},
+		{name: "costBasis file", file: fileJSON, key: "costBasis", wantValue: CostBasisLIFO, wantSource: SourceFile},
+		{name: "costBasis account over file", file: fileJSON, flags: Flags{Broker: "accountBroker"}, key: "costBasis",
+			wantValue: CostBasisAverage, wantSource: SourceFile},
+		{name: "costBasis env over account", file: fileJSON, env: map[string]string{EnvCostBasis: CostBasisSpecific},
+			flags: Flags{Broker: "accountBroker"}, key: "costBasis", wantValue: CostBasisSpecific, wantSource: SourceEnv},
+		{name: "costBasis flag over env", file: fileJSON, env: map[string]string{EnvCostBasis: CostBasisSpecific},
+			flags: Flags{CostBasis: CostBasisFIFO}, key: "costBasis", wantValue: CostBasisFIFO, wantSource: SourceFlag},
+
+		{name: "autoMigrate env", env: map[string]string{EnvAutoMigrate: "true"}, key: "autoMigrate",
+			wantValue: "true", wantSource: SourceEnv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", configDir)
+			for _, key := range []string{EnvDBPath, EnvAutoMigrate, EnvBroker, EnvCostBasis, EnvQuoteBaseURL} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			file := filepath.Join(fileDir, configFileName)
+			t.Setenv(EnvConfigFile, file)
+			os.Remove(file)
+			if tt.file != "" {
+				if err := os.WriteFile(file, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := Load(tt.flags)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			for _, s := range cfg.Settings() {
+				if s.Key != tt.key {
+					continue
+				}
+				if s.Value != tt.wantValue || s.Source != tt.wantSource {
+					t.Errorf("%s = %s from %s, want %s from %s", s.Key, s.Value, s.Source, tt.wantValue, tt.wantSource)
+				}
+				return
+			}
+			t.Errorf("no setting %s", tt.key)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		flags Flags
+	}{
+		{name: "Unknown broker", flags: Flags{Broker: "missing"}},
+		{name: "Unknown cost basis", flags: Flags{CostBasis: "hifo"}},
+		{name: "Invalid autoMigrate", env: map[string]string{EnvAutoMigrate: "maybe"}},
+		{name: "Unknown field in file", file: `{"dbFile": "typo.db"}`},
+		{name: "Invalid quote interval", file: `{"quote": {"interval": "2"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			for _, key := range []string{EnvDBPath, EnvAutoMigrate, EnvBroker, EnvCostBasis, EnvQuoteBaseURL} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			file := filepath.Join(dir, configFileName)
+			t.Setenv(EnvConfigFile, file)
+			if tt.file != "" {
+				if err := os.WriteFile(file, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := Load(tt.flags); err == nil {
+				t.Errorf("Load() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Columns of the commission history (委託回報) exported by the stock system
+// of the broker, located by their header.
+const (
+	commissionColTime      = "委託時間"
+	commissionColStock     = "股票名稱"
+	commissionColTranType  = "交易類別"
+	commissionColUnitPrice = "成交均價"
+	commissionColQuantity  = "成交股數"
+	commissionColStatus    = "狀態"
+)
+
+// commissionTranTypes maps the trade types of the commission history to
+// tranType. Margin trading is not supported.
+var commissionTranTypes = map[string]int{
+	"現股買進": 1,
+	"現股賣出": -1,
+}
+
+// commissionStatusOrdered is the status of an order placed but not filled.
+const commissionStatusOrdered = "委託成功"
+
+// ParseBrokerCommission parses a Big5 encoded commission history, e.g.
+// commission_history_2021-Q1.csv, into ledger entries of source
+// model.SourceBroker, sorted by time. Orders not filled are skipped.
+func ParseBrokerCommission(r io.Reader) ([]*model.LedgerEntry, error) {
+	reader := csv.NewReader(traditionalchinese.Big5.NewDecoder().Reader(r))
+	reader.TrimLeadingSpace = true // the header is separated by ",\t"
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file empty")
+		}
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	columns, err := indexColumns(header, commissionColTime, commissionColStock, commissionColTranType,
+		commissionColUnitPrice, commissionColQuantity, commissionColStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*model.LedgerEntry
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		entry, err := parseCommissionRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Time < entries[j].Time
+	})
+
+	return entries, nil
+}
+
+// parseCommissionRow parses a row of the commission history. It returns nil
+// if the order was not filled.
+func parseCommissionRow(row []string, columns map[string]int) (*model.LedgerEntry, error) {
+	status := row[columns[commissionColStatus]]
+	quantityStr := row[columns[commissionColQuantity]]
+	if status == commissionStatusOrdered || quantityStr == "--" || quantityStr == "0" {
+		return nil, nil
+	}
+
+	// e.g. "2020/12/15 12:17:05.285", the milliseconds tell apart the orders
+	// of the same second.
+	dateTime := row[columns[commissionColTime]]
+	parsedTime, err := time.Parse("2006/01/02 15:04:05", dateTime)
+	if err != nil {
+		return nil, fmt.Errorf("parsing time '%s': %w", dateTime, err)
+	}
+	_, tranTime, _ := strings.Cut(dateTime, " ")
+
+	stockNo, stockName, err := parseStockNameNo(row[columns[commissionColStock]])
+	if err != nil {
+		return nil, err
+	}
+
+	tranTypeStr := row[columns[commissionColTranType]]
+	tranType, ok := commissionTranTypes[tranTypeStr]
+	if !ok {
+		return nil, fmt.Errorf("unsupported trade type '%s'", tranTypeStr)
+	}
+
+	quantity, err := strconv.Atoi(quantityStr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing quantity '%s': %w", quantityStr, err)
+	}
+
+	unitPriceStr := row[columns[commissionColUnitPrice]]
+	unitPrice, err := model.ParseDecimal(unitPriceStr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing unit price '%s': %w", unitPriceStr, err)
+	}
+
+	return model.NewLedgerEntry(parsedTime.Format(time.DateOnly), tranTime, stockNo, stockName,
+		tranType, quantity, unitPrice, model.SourceBroker), nil
+}
+
+// parseStockNameNo splits "元大台灣50(0050)" into the stock number and name.
+// An empty name is "N/A".
+func parseStockNameNo(s string) (string, string, error) {
+	i := strings.LastIndex(s, "(")
+	if i < 0 || !strings.HasSuffix(s, ")") || i+1 == len(s)-1 {
+		return "", "", fmt.Errorf("parsing stock '%s': want 'name(stockNo)'", s)
+	}
+
+	stockNo := s[i+1 : len(s)-1]
+	stockName := strings.TrimSpace(s[:i])
+	if stockName == "" {
+		stockName = "N/A"
+	}
+
+	return stockNo, stockName, nil
+}
+
+// indexColumns maps the names of the wanted columns to their index in the
+// header.
+func indexColumns(header []string, names ...string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	indexes := map[string]int{}
+	for _, name := range names {
+		i, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("column '%s' not found in the header", name)
+		}
+		indexes[name] = i
+	}
+
+	return indexes, nil
+}
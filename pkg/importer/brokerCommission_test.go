@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+const commissionHistoryExample = "../../cmd/internal/convert2TransactionRecords/commissionHistoryExample"
+
+func TestParseBrokerCommissionExample(t *testing.T) {
+	tests := []struct {
+		file      string
+		wantCount int
+		wantFirst *model.LedgerEntry
+	}{
+		{
+			file:      "commission_history_2020-12.csv",
+			wantCount: 16, // 17 rows, 1 order not filled
+			wantFirst: model.NewLedgerEntry("2020-12-03", "10:14:52.784", "3218", "大學光", 1, 1000, model.MustParseDecimal("284.5"), model.SourceBroker),
+		},
+		{
+			file:      "commission_history_2021-Q1.csv",
+			wantCount: 52, // 54 rows, 2 orders not filled
+			wantFirst: model.NewLedgerEntry("2021-01-12", "09:03:15.222", "2368", "金像電", 1, 1000, model.NewDecimalFromInt(51), model.SourceBroker),
+		},
+		{
+			file:      "commission_history_2021-Q2.csv",
+			wantCount: 28,
+			wantFirst: model.NewLedgerEntry("2021-04-07", "10:00:38.939", "3705", "永信", -1, 1000, model.MustParseDecimal("44.05"), model.SourceBroker),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file, err := os.Open(filepath.Join(commissionHistoryExample, tt.file))
+			if err != nil {
+				t.Fatalf("failed to open example: %v", err)
+			}
+			defer file.Close()
+
+			entries, err := ParseBrokerCommission(file)
+			if err != nil {
+				t.Fatalf("ParseBrokerCommission() error = %v", err)
+			}
+			if len(entries) != tt.wantCount {
+				t.Fatalf("ParseBrokerCommission() = %d entries, want %d", len(entries), tt.wantCount)
+			}
+
+			got, want := entries[0], tt.wantFirst
+			if got.Date != want.Date || got.Time != want.Time || got.StockNo != want.StockNo ||
+				got.StockName != want.StockName || got.TranType != want.TranType ||
+				got.Quantity != want.Quantity || got.UnitPrice.Cmp(want.UnitPrice) != 0 || got.Source != want.Source {
+				t.Errorf("first entry = %+v, want %+v", got, want)
+			}
+
+			for i := 1; i < len(entries); i++ {
+				if entries[i-1].Date+entries[i-1].Time > entries[i].Date+entries[i].Time {
+					t.Fatalf("entries are not sorted by time at %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBrokerCommissionErrors(t *testing.T) {
+	header := "委託時間,\t股票名稱,\t交易類別,\t委託條件,\t價格,\t成交均價,\t原委託,\t成交股數,\t未成交,\t取消股數,\t委託書號,\t狀態\r\n"
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		want    int
+	}{
+		{name: "Empty file", content: "", wantErr: true},
+		{name: "Missing column", content: "委託時間,股票名稱\r\n", wantErr: true},
+		{name: "Filled and cancelled orders", content: header +
+			"2021/03/12 09:16:15.648,亞信(3169),現股買進,ROD,136.50,136,1000,1000,0,--,63398,完全成交\r\n" +
+			"2021/03/12 09:17:15.648,亞信(3169),現股買進,ROD,130.50,--,1000,--,0,1000,63399,刪單成功\r\n" +
+			"2021/03/09 08:59:25.993,義隆(2458),現股買進,ROD,168.00,--,1000,--,1000,--,61447,委託成功\r\n", want: 1},
+		{name: "Margin trading", content: header +
+			"2021/03/12 09:16:15.648,亞信(3169),融資買進,ROD,136.50,136,1000,1000,0,--,63398,完全成交\r\n", wantErr: true},
+		{name: "Stock without number", content: header +
+			"2021/03/12 09:16:15.648,亞信,現股買進,ROD,136.50,136,1000,1000,0,--,63398,完全成交\r\n", wantErr: true},
+		{name: "Invalid time", content: header +
+			"2021-03-12 09:16,亞信(3169),現股買進,ROD,136.50,136,1000,1000,0,--,63398,完全成交\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var big5 bytes.Buffer
+			writer := traditionalchinese.Big5.NewEncoder().Writer(&big5)
+			if _, err := writer.Write([]byte(tt.content)); err != nil {
+				t.Fatalf("failed to encode Big5: %v", err)
+			}
+
+			entries, err := ParseBrokerCommission(&big5)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBrokerCommission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(entries) != tt.want {
+				t.Errorf("ParseBrokerCommission() = %d entries, want %d", len(entries), tt.want)
+			}
+		})
+	}
+}
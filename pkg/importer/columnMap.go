@@ -0,0 +1,269 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Fields of a transaction, mapped to the columns of a CSV file by their
+// header.
+const (
+	FieldDate      = "date"
+	FieldTime      = "time" // optional, the trades are timed by a tradeClock
+	FieldStockNo   = "stockNo"
+	FieldTranType  = "tranType"
+	FieldQuantity  = "quantity"
+	FieldUnitPrice = "unitPrice"
+)
+
+// Fields lists the fields which can be mapped.
+var Fields = []string{FieldDate, FieldTime, FieldStockNo, FieldTranType, FieldQuantity, FieldUnitPrice}
+
+// requiredFields are the fields which must be mapped.
+var requiredFields = []string{FieldDate, FieldStockNo, FieldTranType, FieldQuantity, FieldUnitPrice}
+
+// tranTypes maps the trade types written in words to tranType.
+var tranTypes = map[string]int{
+	"buy": 1, "買": 1, "買進": 1, "現買": 1, "現股買進": 1,
+	"sell": -1, "賣": -1, "賣出": -1, "現賣": -1, "現股賣出": -1,
+}
+
+// ColumnMap maps the fields of a transaction to the headers of the columns.
+type ColumnMap map[string]string
+
+// ParseColumnMap parses "date=成交日期,stockNo=代號,..." into a column map.
+func ParseColumnMap(s string) (ColumnMap, error) {
+	cm := ColumnMap{}
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("parsing mapping '%s': want 'field=column'", pair)
+		}
+		if _, ok := cm[field]; ok {
+			return nil, fmt.Errorf("field '%s' is mapped twice", field)
+		}
+		cm[field] = column
+	}
+
+	return cm, cm.Validate()
+}
+
+// Validate returns an error if the map has an unknown field or misses a
+// required one.
+func (cm ColumnMap) Validate() error {
+	for field := range cm {
+		if !contains(Fields, field) {
+			return fmt.Errorf("unknown field '%s', valid fields are: %s", field, strings.Join(Fields, ", "))
+		}
+	}
+	for _, field := range requiredFields {
+		if _, ok := cm[field]; !ok {
+			return fmt.Errorf("field '%s' is not mapped", field)
+		}
+	}
+
+	return nil
+}
+
+// ParseDelimiter parses the delimiter of a CSV file: a single character, or
+// "tab". An empty delimiter is ",".
+func ParseDelimiter(s string) (rune, error) {
+	switch s {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter '%s', want a single character", s)
+	}
+
+	return r, nil
+}
+
+// ParseMappedCSV parses a CSV file whose columns are located by the headers
+// of the column map into transaction records, sorted by time. The errors of
+// all the invalid rows are joined, one line each.
+func ParseMappedCSV(r io.Reader, cm ColumnMap, delimiter rune) ([]*model.TransactionRecord, error) {
+	if err := cm.Validate(); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file empty")
+		}
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff") // BOM written by Excel
+
+	var names []string
+	for _, field := range Fields {
+		if column, ok := cm[field]; ok {
+			names = append(names, column)
+		}
+	}
+	columns, err := indexColumns(header, names...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file has no time if the time is not mapped
+	clock := tradeClock{}
+
+	var records []*model.TransactionRecord
+	var rowErrs []error
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		fields := map[string]string{}
+		for field, column := range cm {
+			fields[field] = strings.TrimSpace(row[columns[column]])
+		}
+
+		record, err := parseMappedRow(fields)
+		if err == nil && record.Time == "" {
+			record.Time, err = clock.next(record.Date)
+			record.TimeGenerated = true
+		}
+		if err != nil {
+			rowErrs = append(rowErrs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+
+		records = append(records, record)
+	}
+	if len(rowErrs) > 0 {
+		return nil, errors.Join(rowErrs...)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Date != records[j].Date {
+			return records[i].Date < records[j].Date
+		}
+		return records[i].Time < records[j].Time
+	})
+
+	return records, nil
+}
+
+// parseMappedRow parses the fields of a row. The time is empty if it is
+// not mapped.
+func parseMappedRow(fields map[string]string) (*model.TransactionRecord, error) {
+	date, err := ParseDate(fields[FieldDate])
+	if err != nil {
+		return nil, err
+	}
+
+	var tranTime string
+	if s, ok := fields[FieldTime]; ok {
+		parsedTime, err := time.Parse(time.TimeOnly, s)
+		if err != nil {
+			return nil, fmt.Errorf("parsing time '%s': %w", s, err)
+		}
+		tranTime = parsedTime.Format(time.TimeOnly)
+	}
+
+	stockNo := fields[FieldStockNo]
+	if stockNo == "" {
+		return nil, errors.New("stockNo is empty")
+	}
+
+	tranType, err := parseTranType(fields[FieldTranType])
+	if err != nil {
+		return nil, err
+	}
+
+	quantityStr := fields[FieldQuantity]
+	quantity, err := strconv.Atoi(removeThousandsSeparators(quantityStr))
+	if err != nil || quantity <= 0 {
+		return nil, fmt.Errorf("parsing quantity '%s': want a positive integer", quantityStr)
+	}
+
+	unitPriceStr := fields[FieldUnitPrice]
+	unitPrice, err := model.ParseDecimal(removeThousandsSeparators(unitPriceStr))
+	if err != nil {
+		return nil, fmt.Errorf("parsing unit price '%s': %w", unitPriceStr, err)
+	}
+
+	return model.NewTransactionRecord(date, tranTime, stockNo, tranType, quantity, unitPrice), nil
+}
+
+// ParseDate parses a date like "2020-12-15", "2020/12/15", or in the years of
+// the Republic of China (民國), "109/12/15", into "2020-12-15".
+func ParseDate(s string) (string, error) {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '/' || r == '.' })
+	if len(parts) != 3 {
+		return "", fmt.Errorf("parsing date '%s': want 'yyyy/mm/dd' or 'yyy/mm/dd'", s)
+	}
+
+	var ymd [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return "", fmt.Errorf("parsing date '%s': %w", s, err)
+		}
+		ymd[i] = n
+	}
+	if len(parts[0]) <= 3 {
+		ymd[0] += 1911 // ROC year 1 is 1912
+	}
+
+	date := fmt.Sprintf("%04d-%02d-%02d", ymd[0], ymd[1], ymd[2])
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return "", fmt.Errorf("parsing date '%s': %w", s, err)
+	}
+
+	return date, nil
+}
+
+// parseTranType parses 1 and -1, or a trade type in words like "買進".
+func parseTranType(s string) (int, error) {
+	if tranType, ok := tranTypes[strings.ToLower(s)]; ok {
+		return tranType, nil
+	}
+
+	tranType, err := strconv.Atoi(s)
+	if err != nil || (tranType != 1 && tranType != -1) {
+		return 0, fmt.Errorf("parsing tranType '%s': want 1, -1, buy or sell", s)
+	}
+
+	return tranType, nil
+}
+
+// removeThousandsSeparators turns "1,234.5" into "1234.5".
+func removeThousandsSeparators(s string) string {
+	return strings.ReplaceAll(s, ",", "")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
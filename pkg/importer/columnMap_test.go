@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"strings"
+	"testing"
+)
+
+func TestParseColumnMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string // the header of stockNo
+		wantErr bool
+	}{
+		{name: "Valid", s: "date=成交日期, stockNo=代號,tranType=買賣別,quantity=成交股數,unitPrice=成交價", want: "代號"},
+		{name: "Missing required field", s: "date=成交日期,stockNo=代號", wantErr: true},
+		{name: "Unknown field", s: "date=成交日期,stockNo=代號,tranType=買賣別,quantity=成交股數,unitPrice=成交價,fee=手續費", wantErr: true},
+		{name: "Mapped twice", s: "date=成交日期,date=日期,stockNo=代號,tranType=買賣別,quantity=成交股數,unitPrice=成交價", wantErr: true},
+		{name: "Missing column", s: "date=,stockNo=代號,tranType=買賣別,quantity=成交股數,unitPrice=成交價", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseColumnMap(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColumnMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got[FieldStockNo] != tt.want {
+				t.Errorf("ParseColumnMap()[stockNo] = %s, want %s", got[FieldStockNo], tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{s: "2020-12-15", want: "2020-12-15"},
+		{s: "2020/12/15", want: "2020-12-15"},
+		{s: "2020/1/5", want: "2020-01-05"},
+		{s: "109/12/15", want: "2020-12-15"},
+		{s: "99.01.04", want: "2010-01-04"},
+		{s: "2020/02/30", wantErr: true},
+		{s: "20201215", wantErr: true},
+		{s: "2020/12/aa", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseDate(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    rune
+		wantErr bool
+	}{
+		{s: "", want: ','},
+		{s: ";", want: ';'},
+		{s: "tab", want: '\t'},
+		{s: "|", want: '|'},
+		{s: ",,", wantErr: true},
+		{s: `"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseDelimiter(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDelimiter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMappedCSV(t *testing.T) {
+	cm := ColumnMap{
+		FieldDate: "成交日期", FieldStockNo: "代號", FieldTranType: "買賣別",
+		FieldQuantity: "成交股數", FieldUnitPrice: "成交價",
+	}
+	content := "" +
+		"備註;成交價;成交股數;買賣別;代號;成交日期\n" +
+		";\"1,100.5\";2,000;現股買進;0050;109/12/15\n" +
+		"first;500.5;\"1,000\";buy;2330;2020/12/15\n" +
+		";600;500;-1;2330;2020-12-16\n"
+
+	records, err := ParseMappedCSV(strings.NewReader(content), cm, ';')
+	if err != nil {
+		t.Fatalf("ParseMappedCSV() error = %v", err)
+	}
+
+	want := []*model.TransactionRecord{
+		model.NewTransactionRecord("2020-12-15", "09:00:00", "0050", 1, 2000, model.MustParseDecimal("1100.5")),
+		model.NewTransactionRecord("2020-12-15", "09:00:10", "2330", 1, 1000, model.MustParseDecimal("500.5")),
+		model.NewTransactionRecord("2020-12-16", "09:00:00", "2330", -1, 500, model.NewDecimalFromInt(600)),
+	}
+	if len(records) != len(want) {
+		t.Fatalf("ParseMappedCSV() = %d records, want %d", len(records), len(want))
+	}
+	for i, got := range records {
+		if got.Date != want[i].Date || got.Time != want[i].Time || got.StockNo != want[i].StockNo ||
+			got.TranType != want[i].TranType || got.Quantity != want[i].Quantity || got.UnitPrice.Cmp(want[i].UnitPrice) != 0 ||
+			!got.TimeGenerated {
+			t.Errorf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	cm[FieldTime] = "成交時間"
+	if _, err := ParseMappedCSV(strings.NewReader(content), cm, ';'); err == nil {
+		t.Errorf("ParseMappedCSV() without the column of time succeeded, want an error")
+	}
+}
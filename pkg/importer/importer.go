@@ -0,0 +1,80 @@
+// Package importer parses the transactions exported by brokers and kept in
+// spreadsheets into entries of the transaction ledger.
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+	"time"
+)
+
+// Formats of the files to import.
+const (
+	// FormatCSV is "date,time,stockNo,tranType,quantity,unitPrice", or any
+	// columns located by a ColumnMap, added to the inventory directly.
+	FormatCSV = "csv"
+	// FormatBrokerCommission is the Big5 commission history exported by the
+	// stock system of the broker.
+	FormatBrokerCommission = "broker-commission"
+	// FormatManualExcel is the UTF-8 CSV saved from the spreadsheet of the
+	// manual input, without the time of the trades.
+	FormatManualExcel = "manual-excel"
+)
+
+// The files without the time of the trades are timed by a tradeClock. The
+// first trade of a day is at firstTradeTime, and each following trade of the
+// same day is tradeTimeStep later, so that the trades never overlap. Retime
+// moves them after the trades of the ledger.
+const (
+	firstTradeTime = "09:00:00"
+	tradeTimeStep  = 10 * time.Second
+)
+
+// tradeClock holds the time of the latest trade of each day.
+type tradeClock map[string]time.Time
+
+// next returns the time of the next trade on date, not before
+// firstTradeTime.
+func (c tradeClock) next(date string) (string, error) {
+	first, _ := time.Parse(time.TimeOnly, firstTradeTime)
+	tradeTime, ok := c[date]
+	if ok {
+		tradeTime = tradeTime.Add(tradeTimeStep)
+	}
+	if !ok || tradeTime.Before(first) {
+		tradeTime = first
+	}
+	if tradeTime.Day() != 1 { // time.Parse of a time only is on 0000-01-01
+		return "", fmt.Errorf("too many trades on %s", date)
+	}
+	c[date] = tradeTime
+
+	return tradeTime.Format(time.TimeOnly), nil
+}
+
+// Retime times the records timed by the importer again, after the latest
+// trade of their date in latest, e.g. of the ledger, so they don't collide
+// with it. The records of a date keep their order.
+func Retime(trs []*model.TransactionRecord, latest map[string]string) error {
+	clock := tradeClock{}
+	for date, latestTime := range latest {
+		tradeTime, err := time.Parse(time.TimeOnly, latestTime)
+		if err != nil {
+			return fmt.Errorf("parsing time '%s': %w", latestTime, err)
+		}
+		clock[date] = tradeTime
+	}
+
+	for _, tr := range trs {
+		if !tr.TimeGenerated {
+			continue
+		}
+		tradeTime, err := clock.next(tr.Date)
+		if err != nil {
+			return err
+		}
+		tr.Time = tradeTime
+	}
+
+	return nil
+}
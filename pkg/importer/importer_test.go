@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"strings"
+	"testing"
+)
+
+func TestRetime(t *testing.T) {
+	tests := []struct {
+		name      string
+		latest    map[string]string
+		wantTimes string
+		wantErr   bool
+	}{
+		{"empty ledger", nil, "09:00:00,09:00:10,13:00:00,09:00:00", false},
+		{"after the ledger", map[string]string{"2024-01-02": "13:30:00"}, "13:30:10,13:30:20,13:00:00,09:00:00", false},
+		{"not before the first trade", map[string]string{"2024-01-02": "08:00:10", "2024-01-03": "09:00:00"},
+			"09:00:00,09:00:10,13:00:00,09:00:10", false},
+		{"too many trades", map[string]string{"2024-01-02": "23:59:55"}, "", true},
+		{"invalid time", map[string]string{"2024-01-02": "9 am"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trs := []*model.TransactionRecord{
+				model.NewTransactionRecord("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500)),
+				model.NewTransactionRecord("2024-01-02", "09:00:10", "0050", 1, 1000, model.NewDecimalFromInt(100)),
+				model.NewTransactionRecord("2024-01-02", "13:00:00", "2330", -1, 1000, model.NewDecimalFromInt(510)),
+				model.NewTransactionRecord("2024-01-03", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500)),
+			}
+			for _, i := range []int{0, 1, 3} {
+				trs[i].TimeGenerated = true
+			}
+
+			err := Retime(trs, tt.latest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Retime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var times []string
+			for _, tr := range trs {
+				times = append(times, tr.Time)
+			}
+			if got := strings.Join(times, ","); got != tt.wantTimes {
+				t.Errorf("Retime() times = %s, want %s", got, tt.wantTimes)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns of the transactions kept in the spreadsheet, e.g.
+// Before_2020-12_excel.csv, located by their header. The price column, the
+// total amount, is ignored.
+const (
+	manualColStockName = "stockName"
+	manualColStockNo   = "stockNo"
+	manualColTranType  = "tranType"
+	manualColQuantity  = "quantity"
+	manualColDate      = "date"
+	manualColUnitPrice = "unitPrice"
+)
+
+// ParseManualExcel parses the UTF-8 CSV saved from the spreadsheet of the
+// manual input into ledger entries of source model.SourceManual, sorted by
+// time.
+func ParseManualExcel(r io.Reader) ([]*model.LedgerEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file empty")
+		}
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // BOM written by Excel
+	}
+
+	columns, err := indexColumns(header, manualColStockName, manualColStockNo, manualColTranType,
+		manualColQuantity, manualColDate, manualColUnitPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	// The spreadsheet has no time
+	clock := tradeClock{}
+
+	var entries []*model.LedgerEntry
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		entry, err := parseManualRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		entry.Time, err = clock.next(entry.Date)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry.TimeGenerated = true
+
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Time < entries[j].Time
+	})
+
+	return entries, nil
+}
+
+// parseManualRow parses a row of the spreadsheet, leaving the time empty.
+func parseManualRow(row []string, columns map[string]int) (*model.LedgerEntry, error) {
+	date := strings.TrimSpace(row[columns[manualColDate]])
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return nil, fmt.Errorf("parsing date '%s': %w", date, err)
+	}
+
+	stockNo := strings.TrimSpace(row[columns[manualColStockNo]])
+	if stockNo == "" {
+		return nil, errors.New("stockNo is empty")
+	}
+	stockName := strings.TrimSpace(row[columns[manualColStockName]])
+	if stockName == "" {
+		stockName = "N/A"
+	}
+
+	tranTypeStr := strings.TrimSpace(row[columns[manualColTranType]])
+	tranType, err := strconv.Atoi(tranTypeStr)
+	if err != nil || (tranType != 1 && tranType != -1) {
+		return nil, fmt.Errorf("parsing tranType '%s': want 1 or -1", tranTypeStr)
+	}
+
+	quantityStr := strings.TrimSpace(row[columns[manualColQuantity]])
+	quantity, err := strconv.Atoi(quantityStr)
+	if err != nil || quantity <= 0 {
+		return nil, fmt.Errorf("parsing quantity '%s': want a positive integer", quantityStr)
+	}
+
+	unitPriceStr := strings.TrimSpace(row[columns[manualColUnitPrice]])
+	unitPrice, err := model.ParseDecimal(unitPriceStr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing unit price '%s': %w", unitPriceStr, err)
+	}
+
+	return model.NewLedgerEntry(date, "", stockNo, stockName, tranType, quantity, unitPrice, model.SourceManual), nil
+}
@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseManualExcelExample(t *testing.T) {
+	file, err := os.Open(filepath.Join(commissionHistoryExample, "Before_2020-12_excel.csv"))
+	if err != nil {
+		t.Fatalf("failed to open example: %v", err)
+	}
+	defer file.Close()
+
+	entries, err := ParseManualExcel(file)
+	if err != nil {
+		t.Fatalf("ParseManualExcel() error = %v", err)
+	}
+	if len(entries) != 56 {
+		t.Fatalf("ParseManualExcel() = %d entries, want 56", len(entries))
+	}
+
+	// 2020-03-13 has 4 trades
+	var times []string
+	for _, e := range entries {
+		if e.Source != model.SourceManual {
+			t.Fatalf("entry %+v has source %d, want %d", e, e.Source, model.SourceManual)
+		}
+		if e.Date == "2020-03-13" {
+			times = append(times, e.Time)
+		}
+	}
+	want := "09:00:00,09:00:10,09:00:20,09:00:30"
+	if got := strings.Join(times, ","); got != want {
+		t.Errorf("times on 2020-03-13 = %s, want %s", got, want)
+	}
+
+	got := entries[0]
+	if got.Date != "2020-02-27" || got.Time != "09:00:00" || got.StockNo != "2886" || got.StockName != "兆豐金" ||
+		got.TranType != 1 || got.Quantity != 1000 || got.UnitPrice.Cmp(model.MustParseDecimal("32.2")) != 0 {
+		t.Errorf("first entry = %+v, want 2886 兆豐金 bought 1000 at 32.2 on 2020-02-27 09:00:00", got)
+	}
+}
+
+func TestParseManualExcel(t *testing.T) {
+	header := "\ufeffstockName,stockNo,tranType,quantity,date,unitPrice,price\r\n"
+	tests := []struct {
+		name      string
+		content   string
+		wantErr   bool
+		wantTimes []string
+	}{
+		{name: "Empty file", content: "", wantErr: true},
+		{name: "Missing column", content: "stockName,stockNo,tranType,quantity,date\r\n", wantErr: true},
+		{name: "Days not in order", content: header +
+			"華航,2610,1,1000,2020-03-11,8.03,8030\r\n" +
+			"景碩,3189,1,1000,2020-03-09,49.7,49700\r\n" +
+			"華航,2610,-1,1000,2020-03-11,8.5,-8500\r\n",
+			wantTimes: []string{"2020-03-09 09:00:00", "2020-03-11 09:00:00", "2020-03-11 09:00:10"}},
+		{name: "Invalid date", content: header + "華航,2610,1,1000,2020/03/11,8.03,8030\r\n", wantErr: true},
+		{name: "Invalid tranType", content: header + "華航,2610,2,1000,2020-03-11,8.03,8030\r\n", wantErr: true},
+		{name: "Invalid quantity", content: header + "華航,2610,1,-1000,2020-03-11,8.03,8030\r\n", wantErr: true},
+		{name: "Invalid unit price", content: header + "華航,2610,1,1000,2020-03-11,abc,8030\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseManualExcel(strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseManualExcel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var times []string
+			for _, e := range entries {
+				times = append(times, e.Date+" "+e.Time)
+			}
+			if strings.Join(times, ",") != strings.Join(tt.wantTimes, ",") {
+				t.Errorf("ParseManualExcel() times = %v, want %v", times, tt.wantTimes)
+			}
+		})
+	}
+}
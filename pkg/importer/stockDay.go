@@ -0,0 +1,264 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Columns of the daily trading of a stock in a month (各日成交資訊), STOCK_DAY
+// of TWSE or the same of TPEx, located by their header without spaces.
+const stockDayColDate = "日期"
+
+var (
+	stockDayColVolume         = []string{"成交股數"}
+	stockDayColVolumeThousand = []string{"成交仟股"} // TPEx counts thousands of shares
+	stockDayColOpen           = []string{"開盤價", "開盤"}
+	stockDayColHigh           = []string{"最高價", "最高"}
+	stockDayColLow            = []string{"最低價", "最低"}
+	stockDayColClose          = []string{"收盤價", "收盤"}
+)
+
+// The stock number in the title of TWSE, e.g. "113年01月 2330 台積電 各日成交資訊",
+// or in the line of TPEx, e.g. "股票代號:6488 股票名稱:環球晶".
+var (
+	stockDayTitleTWSE = regexp.MustCompile(`^\d+年\d+月\s+(\S+)\s`)
+	stockDayTitleTPEx = regexp.MustCompile(`股票代號\s*[:：]\s*(\w+)`)
+)
+
+// ParseStockDay parses the daily trading of a stock in a month, the CSV
+// downloaded from TWSE or TPEx in UTF-8 or Big5, into prices. The stock
+// number is read from the title of the file, or is stockNo if it has none.
+// Days without trades and the notes after the rows are skipped.
+func ParseStockDay(r io.Reader, stockNo string) ([]*model.Price, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		data, err = traditionalchinese.Big5.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding Big5: %w", err)
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1 // the title and the notes are single fields
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var columns *stockDayColumns
+	var prices []*model.Price
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if columns == nil {
+			if fileStockNo := parseStockDayTitle(row); fileStockNo != "" {
+				if stockNo != "" && stockNo != fileStockNo {
+					return nil, fmt.Errorf("line %d: stock '%s' of the file, want '%s'", line, fileStockNo, stockNo)
+				}
+				stockNo = fileStockNo
+			}
+			if isStockDayHeader(row) {
+				columns, err = indexStockDayColumns(row)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		price, err := parseStockDayRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if price != nil {
+			price.StockNo = stockNo
+			prices = append(prices, price)
+		}
+	}
+
+	if columns == nil {
+		return nil, errors.New("header not found")
+	}
+	if stockNo == "" {
+		return nil, errors.New("stock number not found in the file, give it")
+	}
+
+	return prices, nil
+}
+
+// ParseStockDayRows parses the rows of the daily trading under the header,
+// e.g. the fields and the data of the STOCK_DAY JSON of TWSE, into the prices
+// of stockNo. Days without trades and notes are skipped.
+func ParseStockDayRows(header []string, rows [][]string, stockNo string) ([]*model.Price, error) {
+	if !isStockDayHeader(header) {
+		return nil, fmt.Errorf("header %v not led by '%s'", header, stockDayColDate)
+	}
+	columns, err := indexStockDayColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []*model.Price
+	for i, row := range rows {
+		price, err := parseStockDayRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if price != nil {
+			price.StockNo = stockNo
+			prices = append(prices, price)
+		}
+	}
+
+	return prices, nil
+}
+
+// parseStockDayTitle returns the stock number in the title row, or "".
+func parseStockDayTitle(row []string) string {
+	for _, field := range row {
+		field = strings.TrimSpace(field)
+		if m := stockDayTitleTWSE.FindStringSubmatch(field); m != nil {
+			return m[1]
+		}
+		if m := stockDayTitleTPEx.FindStringSubmatch(field); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// isStockDayHeader reports whether the row is the header, led by the date.
+func isStockDayHeader(row []string) bool {
+	return len(row) > 1 && removeSpaces(row[0]) == stockDayColDate
+}
+
+// stockDayColumns are the indexes of the columns of the daily trading.
+type stockDayColumns struct {
+	date, volume, open, high, low, close int
+	volumeThousand                       bool // the volume is in thousands of shares
+}
+
+// indexStockDayColumns locates the columns by the header.
+func indexStockDayColumns(header []string) (*stockDayColumns, error) {
+	names := make([]string, len(header))
+	for i, name := range header {
+		names[i] = removeSpaces(name)
+	}
+
+	columns := &stockDayColumns{}
+	for _, col := range []struct {
+		alternatives []string
+		index        *int
+	}{
+		{stockDayColOpen, &columns.open},
+		{stockDayColHigh, &columns.high},
+		{stockDayColLow, &columns.low},
+		{stockDayColClose, &columns.close},
+	} {
+		i, err := indexAlternatives(names, col.alternatives)
+		if err != nil {
+			return nil, err
+		}
+		*col.index = i
+	}
+
+	i, err := indexAlternatives(names, stockDayColVolume)
+	if err != nil {
+		i, err = indexAlternatives(names, stockDayColVolumeThousand)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s' not found in the header", stockDayColVolume[0])
+		}
+		columns.volumeThousand = true
+	}
+	columns.volume = i
+
+	return columns, nil
+}
+
+// indexAlternatives returns the index of the first name found of the
+// alternatives.
+func indexAlternatives(names []string, alternatives []string) (int, error) {
+	for _, alternative := range alternatives {
+		for i, name := range names {
+			if name == alternative {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("column '%s' not found in the header", alternatives[0])
+}
+
+// parseStockDayRow parses a row of the daily trading. It returns nil if the
+// row is a note, or the stock was not traded on the day.
+func parseStockDayRow(row []string, columns *stockDayColumns) (*model.Price, error) {
+	for _, i := range []int{columns.date, columns.volume, columns.open, columns.high, columns.low, columns.close} {
+		if i >= len(row) {
+			return nil, nil // a note
+		}
+	}
+
+	date, err := ParseDate(removeSpaces(row[columns.date]))
+	if err != nil {
+		return nil, nil // a note, e.g. "說明:"
+	}
+
+	closeStr := removeSpaces(row[columns.close])
+	if strings.Trim(closeStr, "-") == "" {
+		return nil, nil // "--", not traded
+	}
+
+	price := &model.Price{Date: date}
+	for _, col := range []struct {
+		name  string
+		index int
+		value *model.Decimal
+	}{
+		{stockDayColOpen[0], columns.open, &price.Open},
+		{stockDayColHigh[0], columns.high, &price.High},
+		{stockDayColLow[0], columns.low, &price.Low},
+		{stockDayColClose[0], columns.close, &price.Close},
+	} {
+		s := removeThousandsSeparators(removeSpaces(row[col.index]))
+		value, err := model.ParseDecimal(s)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s '%s': %w", col.name, s, err)
+		}
+		*col.value = value
+	}
+
+	s := removeThousandsSeparators(removeSpaces(row[columns.volume]))
+	volume, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing volume '%s': %w", s, err)
+	}
+	if columns.volumeThousand {
+		volume *= 1000
+	}
+	price.Volume = volume
+
+	return price, nil
+}
+
+// removeSpaces removes the spaces, e.g. of "日 期" in the header of TPEx.
+func removeSpaces(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"HermInvest/pkg/model"
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+const stockDayTWSE = `"113年01月 2330 台積電           各日成交資訊"
+"日期","成交股數","成交金額","開盤價","最高價","最低價","收盤價","漲跌價差","成交筆數",
+"113/01/02","26,059,058","15,437,186,903","590.00","593.00","589.00","593.00","-0.00","24,306",
+"113/01/03","37,106,763","21,653,100,145","584.00","585.00","578.00","578.00","-15.00","39,955",
+"113/01/04","--","0","--","--","--","--"," 0.00","0",
+"說明:"
+"符號說明:+/-/X表示漲/跌/不比價"
+`
+
+const stockDayTPEx = `個股日成交資訊
+股票代號:6488 股票名稱:環球晶
+資料日期:113/01
+日 期,成交仟股,成交仟元,開盤,最高,最低,收盤,漲跌,筆數
+113/01/02,"1,234","741,587",601.00,605.00,598.00,600.00,-3.00,"1,562"
+113/01/03,987,"584,211",597.00,598.00,588.00,590.00,-10.00,"1,201"
+共2筆
+`
+
+func TestParseStockDay(t *testing.T) {
+	big5, err := traditionalchinese.Big5.NewEncoder().String(stockDayTWSE)
+	if err != nil {
+		t.Fatalf("failed to encode Big5: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		stockNo   string
+		want      []*model.Price
+		wantError bool
+	}{
+		{
+			name: "TWSE",
+			data: stockDayTWSE,
+			want: []*model.Price{
+				{StockNo: "2330", Date: "2024-01-02", Open: model.NewDecimalFromInt(590), High: model.NewDecimalFromInt(593),
+					Low: model.NewDecimalFromInt(589), Close: model.NewDecimalFromInt(593), Volume: 26059058},
+				{StockNo: "2330", Date: "2024-01-03", Open: model.NewDecimalFromInt(584), High: model.NewDecimalFromInt(585),
+					Low: model.NewDecimalFromInt(578), Close: model.NewDecimalFromInt(578), Volume: 37106763},
+			},
+		},
+		{
+			name: "TWSE in Big5 with a BOM",
+			data: "\xef\xbb\xbf" + big5,
+			want: []*model.Price{
+				{StockNo: "2330", Date: "2024-01-02", Open: model.NewDecimalFromInt(590), High: model.NewDecimalFromInt(593),
+					Low: model.NewDecimalFromInt(589), Close: model.NewDecimalFromInt(593), Volume: 26059058},
+				{StockNo: "2330", Date: "2024-01-03", Open: model.NewDecimalFromInt(584), High: model.NewDecimalFromInt(585),
+					Low: model.NewDecimalFromInt(578), Close: model.NewDecimalFromInt(578), Volume: 37106763},
+			},
+		},
+		{
+			name: "TPEx in thousands of shares",
+			data: stockDayTPEx,
+			want: []*model.Price{
+				{StockNo: "6488", Date: "2024-01-02", Open: model.NewDecimalFromInt(601), High: model.NewDecimalFromInt(605),
+					Low: model.NewDecimalFromInt(598), Close: model.NewDecimalFromInt(600), Volume: 1234000},
+				{StockNo: "6488", Date: "2024-01-03", Open: model.NewDecimalFromInt(597), High: model.NewDecimalFromInt(598),
+					Low: model.NewDecimalFromInt(588), Close: model.NewDecimalFromInt(590), Volume: 987000},
+			},
+		},
+		{
+			name:    "stock number given without a title",
+			data:    "日期,成交股數,開盤價,最高價,最低價,收盤價\n113/02/15,\"1,000\",10.5,11,10.25,10.95\n",
+			stockNo: "0050",
+			want: []*model.Price{
+				{StockNo: "0050", Date: "2024-02-15", Open: model.MustParseDecimal("10.5"), High: model.NewDecimalFromInt(11),
+					Low: model.MustParseDecimal("10.25"), Close: model.MustParseDecimal("10.95"), Volume: 1000},
+			},
+		},
+		{
+			name:      "stock number not found",
+			data:      "日期,成交股數,開盤價,最高價,最低價,收盤價\n113/02/15,1000,10.5,11,10.25,10.95\n",
+			wantError: true,
+		},
+		{
+			name:      "stock number unlike the title",
+			data:      stockDayTWSE,
+			stockNo:   "2317",
+			wantError: true,
+		},
+		{
+			name:      "header not found",
+			data:      "\"113年01月 2330 台積電 各日成交資訊\"\n",
+			wantError: true,
+		},
+		{
+			name:      "close not a number",
+			data:      "日期,成交股數,開盤價,最高價,最低價,收盤價\n113/02/15,1000,10.5,11,10.25,x\n",
+			stockNo:   "0050",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStockDay(bytes.NewReader([]byte(tt.data)), tt.stockNo)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseStockDay() error = %v, wantError %v", err, tt.wantError)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseStockDay() = %d prices, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				p := got[i]
+				if p.StockNo != want.StockNo || p.Date != want.Date || p.Open.Cmp(want.Open) != 0 ||
+					p.High.Cmp(want.High) != 0 || p.Low.Cmp(want.Low) != 0 || p.Close.Cmp(want.Close) != 0 ||
+					p.Volume != want.Volume {
+					t.Errorf("price %d = %+v, want %+v", i, p, want)
+				}
+			}
+		})
+	}
+}
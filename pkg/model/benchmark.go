@@ -0,0 +1,107 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NewBenchmarkValues simulates investing the external cash flows of the
+// portfolio in a benchmark, the stock of the prices and the dividends: a
+// payment buys the shares of its amount at the close of its date, or the
+// latest before, and a receipt sells them, down to none. The dividends of the
+// shares held are reinvested at the close of the ex-dividend date, and a
+// stock dividend adds its shares. The shares are fractional. It returns the
+// value of the shares held at the close of each of the dates, or an error if a
+// flow or a dividend has no close, or a close of 0, to trade at. The flows, the
+// prices and the dates are ordered by date.
+func NewBenchmarkValues(flows []CashFlow, prices []*Price, dividends []*ExDividend, dates []string) ([]DailyValue, error) {
+	exDividends := make([]*ExDividend, len(dividends))
+	copy(exDividends, dividends)
+	sort.SliceStable(exDividends, func(i, j int) bool {
+		return exDividends[i].ExDividendDate < exDividends[j].ExDividendDate
+	})
+
+	var shares, lastClose Decimal
+	var hasClose bool
+	var i int
+	closeOf := func(date string) {
+		for ; i < len(prices) && prices[i].Date <= date; i++ {
+			lastClose = prices[i].Close
+			hasClose = true
+		}
+	}
+
+	values := make([]DailyValue, 0, len(dates))
+	var j, k int
+	for _, date := range dates {
+		for {
+			hasDividend := k < len(exDividends) && exDividends[k].ExDividendDate <= date
+			hasFlow := j < len(flows) && flows[j].Date <= date
+			if !hasDividend && !hasFlow {
+				break
+			}
+
+			// The holders before the ex-dividend date are paid, so the
+			// dividends of a date come before its flows
+			if hasDividend && (!hasFlow || exDividends[k].ExDividendDate <= flows[j].Date) {
+				ed := exDividends[k]
+				k++
+				closeOf(ed.ExDividendDate)
+				if shares.IsZero() {
+					continue
+				}
+
+				if !hasClose || lastClose.IsZero() {
+					return nil, fmt.Errorf("no price of the benchmark on or before %s", ed.ExDividendDate)
+				}
+				cash := shares.Mul(ed.CashDividend)
+				shares = shares.Add(shares.Mul(ed.StockDividend.Div(ParValue)))
+				shares = shares.Add(cash.Div(lastClose))
+				continue
+			}
+
+			f := flows[j]
+			j++
+			closeOf(f.Date)
+			if !hasClose || lastClose.IsZero() {
+				return nil, fmt.Errorf("no price of the benchmark on or before %s", f.Date)
+			}
+			shares = shares.Sub(f.Amount.Div(lastClose))
+			if shares.Sign() < 0 {
+				shares = DecimalZero // received more than the benchmark is worth
+			}
+		}
+
+		closeOf(date)
+		values = append(values, DailyValue{Date: date, Value: shares.Mul(lastClose)})
+	}
+
+	return values, nil
+}
+
+// BenchmarkComparison is the returns of the portfolio, or of a stock, and of
+// a benchmark invested with the same cash flows over a period.
+type BenchmarkComparison struct {
+	Portfolio *Performance
+	Benchmark *Performance
+}
+
+// XIRRDiff returns the XIRR of the portfolio less the one of the benchmark,
+// or nil if either has none.
+func (bc *BenchmarkComparison) XIRRDiff() *float64 {
+	return diffRates(bc.Portfolio.XIRR, bc.Benchmark.XIRR)
+}
+
+// TWRDiff returns the time-weighted return of the portfolio less the one of
+// the benchmark, or nil if either has none.
+func (bc *BenchmarkComparison) TWRDiff() *float64 {
+	return diffRates(bc.Portfolio.TWR, bc.Benchmark.TWR)
+}
+
+func diffRates(a, b *float64) *float64 {
+	if a == nil || b == nil {
+		return nil
+	}
+	diff := *a - *b
+	return &diff
+}
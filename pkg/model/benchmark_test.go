@@ -0,0 +1,98 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewBenchmarkValues(t *testing.T) {
+	prices := []*Price{
+		{StockNo: "0050", Date: "2024-01-02", Close: NewDecimalFromInt(100)},
+		{StockNo: "0050", Date: "2024-01-03", Close: NewDecimalFromInt(110)},
+		{StockNo: "0050", Date: "2024-01-05", Close: NewDecimalFromInt(100)},
+		{StockNo: "0050", Date: "2024-01-08", Close: NewDecimalFromInt(120)},
+	}
+	dividends := []*ExDividend{
+		{StockNo: "0050", ExDividendDate: "2024-01-05", CashDividend: NewDecimalFromInt(5), StockDividend: NewDecimalFromInt(1)},
+	}
+	dates := []string{"2024-01-02", "2024-01-03", "2024-01-05", "2024-01-08"}
+
+	tests := []struct {
+		name    string
+		flows   []CashFlow
+		prices  []*Price // the prices above if nil
+		want    []int
+		wantErr bool
+	}{
+		{
+			// 10 shares, 10 more at the close before 01-04, 2 of the stock
+			// dividend and 1 of the cash dividend of 100, then 10 sold
+			name: "buys, a dividend and a sell",
+			flows: []CashFlow{
+				{"2024-01-02", NewDecimalFromInt(-1000)},
+				{"2024-01-04", NewDecimalFromInt(-1100)},
+				{"2024-01-08", NewDecimalFromInt(1200)},
+			},
+			want: []int{1000, 1100, 2300, 1560},
+		},
+		{
+			name: "received more than held",
+			flows: []CashFlow{
+				{"2024-01-02", NewDecimalFromInt(-1000)},
+				{"2024-01-03", NewDecimalFromInt(5000)},
+			},
+			want: []int{1000, 0, 0, 0},
+		},
+		{
+			name:    "a flow before the first price",
+			flows:   []CashFlow{{"2024-01-01", NewDecimalFromInt(-1000)}},
+			wantErr: true,
+		},
+		{
+			name:  "a dividend at a close of 0",
+			flows: []CashFlow{{"2024-01-02", NewDecimalFromInt(-1000)}},
+			prices: []*Price{
+				{StockNo: "0050", Date: "2024-01-02", Close: NewDecimalFromInt(100)},
+				{StockNo: "0050", Date: "2024-01-05", Close: DecimalZero},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testPrices := prices
+			if tt.prices != nil {
+				testPrices = tt.prices
+			}
+			values, err := NewBenchmarkValues(tt.flows, testPrices, dividends, dates)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewBenchmarkValues() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil || len(values) != len(tt.want) {
+				t.Fatalf("NewBenchmarkValues() = %d values, %v, want %d", len(values), err, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if values[i].Date != dates[i] || values[i].Value.Cmp(NewDecimalFromInt(want)) != 0 {
+					t.Errorf("values[%d] = %s %s, want %s %d", i, values[i].Date, values[i].Value, dates[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBenchmarkComparisonDiff(t *testing.T) {
+	xirr, twr, benchmarkXIRR := 0.12, 0.1, 0.15
+	bc := &BenchmarkComparison{
+		Portfolio: &Performance{XIRR: &xirr, TWR: &twr},
+		Benchmark: &Performance{XIRR: &benchmarkXIRR},
+	}
+	if diff := bc.XIRRDiff(); diff == nil || math.Abs(*diff+0.03) > 1e-12 {
+		t.Errorf("XIRRDiff() = %v, want -0.03", diff)
+	}
+	if diff := bc.TWRDiff(); diff != nil {
+		t.Errorf("TWRDiff() = %v, want nil without the return of the benchmark", *diff)
+	}
+}
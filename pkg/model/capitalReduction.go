@@ -1,13 +1,17 @@
 package model
 
-// Transaction represents a share transaction.
+import "sort"
+
+// CapitalReduction represents a capital reduction (減資) of a stock: Ratio of
+// the shares are cancelled, Cash is refunded per share held, and the shares
+// left are distributed, under NewStockNo if the stock is renamed.
 type CapitalReduction struct {
 	YQ                   string  `gorm:"column:YQ"`
 	StockNo              string  `gorm:"column:stockNo"`
 	CapitalReductionDate string  `gorm:"column:capitalReductionDate"`
 	DistributionDate     string  `gorm:"column:distributionDate"`
-	Cash                 float64 `gorm:"column:cash"`
-	Ratio                float64 `gorm:"column:ratio"`
+	Cash                 Decimal `gorm:"column:cash"`
+	Ratio                Decimal `gorm:"column:ratio"`
 	NewStockNo           string  `gorm:"column:newStockNo"`
 }
 
@@ -15,27 +19,119 @@ func (cr *CapitalReduction) TableName() string {
 	return "tblCapitalReduction" // default table name
 }
 
-func (cr *CapitalReduction) CalcTransactionRecords(totalQuantity int, avgUnitPrice float64) (*TransactionRecord, *TransactionRecord) {
-	capitalReductionRecord := cr.calcCapitalReductionRecord(totalQuantity, avgUnitPrice)
-	distributionRecord := cr.calcDistributionRecord(totalQuantity, avgUnitPrice)
-	return capitalReductionRecord, distributionRecord
+// DistributedStockNo returns the stock number of the shares distributed,
+// NewStockNo if the stock is renamed, or StockNo.
+func (cr *CapitalReduction) DistributedStockNo() string {
+	if cr.NewStockNo == "" {
+		return cr.StockNo
+	}
+	return cr.NewStockNo
 }
 
-func (cr *CapitalReduction) calcCapitalReductionRecord(totalQuantity int, avgUnitPrice float64) *TransactionRecord {
-	return NewTransactionRecord(
-		cr.CapitalReductionDate, "08:00:00",
-		cr.StockNo, -1, totalQuantity, avgUnitPrice)
+// ReduceLots calculates the whole shares left of the lots of quantities, and
+// the cash paid in lieu of the fractional share (畸零股) at par value,
+// rounded down to the dollar. The fraction is of the whole holding: each lot
+// keeps its whole shares, and the shares of the fractions summed up go to the
+// lots with the largest fractions, the earlier lot first.
+func (cr *CapitalReduction) ReduceLots(quantities []int) (reduced []int, cashInLieu int) {
+	remainingRatio := DecimalOne.Sub(cr.Ratio)
+
+	var totalQuantity int
+	reduced = make([]int, len(quantities))
+	fractions := make([]Decimal, len(quantities))
+	for i, q := range quantities {
+		left := remainingRatio.MulInt(q)
+		reduced[i] = left.Floor()
+		fractions[i] = left.Sub(NewDecimalFromInt(reduced[i]))
+		totalQuantity += q
+	}
+
+	left := remainingRatio.MulInt(totalQuantity)
+	shares := left.Floor()
+	for _, r := range reduced {
+		shares -= r
+	}
+
+	order := make([]int, len(quantities))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return fractions[order[i]].Cmp(fractions[order[j]]) > 0
+	})
+	for _, i := range order[:shares] {
+		reduced[i]++
+	}
+
+	cashInLieu = left.Sub(NewDecimalFromInt(left.Floor())).Mul(ParValue).Floor()
+	return reduced, cashInLieu
 }
 
-func (cr *CapitalReduction) calcDistributionRecord(totalQuantity int, avgUnitPrice float64) *TransactionRecord {
-	if cr.NewStockNo == "" {
-		cr.NewStockNo = cr.StockNo
+// ReduceUnitPrice calculates the unit price of a share left of a lot bought
+// at unitPrice: the cost less the cash refunded, over the shares left. It is
+// 0 if all the shares are cancelled.
+func (cr *CapitalReduction) ReduceUnitPrice(unitPrice Decimal) Decimal {
+	remainingRatio := DecimalOne.Sub(cr.Ratio)
+	if remainingRatio.IsZero() {
+		return DecimalZero
+	}
+	return unitPrice.Sub(cr.Cash).Div(remainingRatio)
+}
+
+// CalcTransactionRecords calculates the records of the capital reduction of
+// the lots: each lot is sold at its unit price on the capital reduction date,
+// and its shares left are bought at the reduced unit price on the
+// distribution date, so each lot keeps its cost. The buy of a lot keeps its
+// acquisition date and time as AcquiredDate and AcquiredTime, as the lot
+// reduced in the inventory does; it is dated when the shares are held again,
+// after the sells, so the records still replay in time order. The sells come
+// first, then the buys, both in the order of the lots.
+func (cr *CapitalReduction) CalcTransactionRecords(lots []*TransactionRecord) []*TransactionRecord {
+	quantities := make([]int, len(lots))
+	for i, lot := range lots {
+		quantities[i] = lot.Quantity
+	}
+	reduced, _ := cr.ReduceLots(quantities)
+
+	var sells, buys []*TransactionRecord
+	for i, lot := range lots {
+		sell := NewTransactionRecord(
+			cr.CapitalReductionDate, "08:00:00",
+			cr.StockNo, -1, lot.Quantity, lot.UnitPrice)
+		sell.Source = SourceCapitalReduction
+		sells = append(sells, sell)
+
+		if reduced[i] == 0 {
+			continue
+		}
+		buy := NewTransactionRecord(
+			cr.DistributionDate, "08:00:10",
+			cr.DistributedStockNo(), 1, reduced[i], cr.ReduceUnitPrice(lot.UnitPrice))
+		buy.Source = SourceCapitalReduction
+		buy.AcquiredDate, buy.AcquiredTime = lot.Date, lot.Time
+		if lot.AcquiredDate != "" {
+			buy.AcquiredDate, buy.AcquiredTime = lot.AcquiredDate, lot.AcquiredTime
+		}
+		buys = append(buys, buy)
 	}
 
-	distributionQuantity := int(float64(totalQuantity) * (1 - cr.Ratio))
-	distributionUnitPrice := (avgUnitPrice - cr.Cash) / (1 - cr.Ratio)
+	return append(sells, buys...)
+}
+
+// CalcCashRecord calculates the cash received for the lots of quantities: the
+// cash refunded per share and the cash in lieu of the fractional share, each
+// in whole dollars rounded down.
+func (cr *CapitalReduction) CalcCashRecord(quantities []int) *ExDividend {
+	var totalQuantity int
+	for _, q := range quantities {
+		totalQuantity += q
+	}
+	_, cashInLieu := cr.ReduceLots(quantities)
+	totalAmount := cr.Cash.MulInt(totalQuantity).Floor() + cashInLieu
 
-	return NewTransactionRecord(
-		cr.DistributionDate, "08:00:10",
-		cr.NewStockNo, 1, distributionQuantity, distributionUnitPrice)
+	cd := NewCashDividendRecord(
+		cr.YQ, cr.StockNo, cr.CapitalReductionDate, cr.DistributionDate,
+		cr.Cash, DecimalZero, totalQuantity, totalAmount)
+	cd.Kind = CashKindCapitalReduction
+	return cd
 }
@@ -0,0 +1,90 @@
+package model
+
+import "testing"
+
+func TestCapitalReductionReduceLots(t *testing.T) {
+	tests := []struct {
+		name           string
+		ratio          string
+		quantities     []int
+		wantReduced    []int
+		wantCashInLieu int
+	}{
+		{name: "Whole shares", ratio: "0.3", quantities: []int{1000, 2000}, wantReduced: []int{700, 1400}, wantCashInLieu: 0},
+		// 555 * 0.7 = 388.5, 1555 * 0.7 = 1088.5: 0.5 share paid at par value
+		{name: "Fractional share", ratio: "0.3", quantities: []int{1000, 555}, wantReduced: []int{700, 388}, wantCashInLieu: 5},
+		// 166.5 + 166.5 + 167 = 500 shares, the fraction summed up goes to the first lot
+		{name: "Fractions of the lots summed up", ratio: "0.5", quantities: []int{333, 333, 334}, wantReduced: []int{167, 166, 167}, wantCashInLieu: 0},
+		{name: "All cancelled", ratio: "1", quantities: []int{1000}, wantReduced: []int{0}, wantCashInLieu: 0},
+		{name: "No lot", ratio: "0.3", quantities: nil, wantReduced: []int{}, wantCashInLieu: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &CapitalReduction{StockNo: "2888", Ratio: MustParseDecimal(tt.ratio)}
+
+			reduced, cashInLieu := cr.ReduceLots(tt.quantities)
+			if len(reduced) != len(tt.wantReduced) || cashInLieu != tt.wantCashInLieu {
+				t.Fatalf("ReduceLots(%v) = %v, %d, want %v, %d", tt.quantities, reduced, cashInLieu, tt.wantReduced, tt.wantCashInLieu)
+			}
+			for i := range reduced {
+				if reduced[i] != tt.wantReduced[i] {
+					t.Fatalf("ReduceLots(%v) = %v, want %v", tt.quantities, reduced, tt.wantReduced)
+				}
+			}
+		})
+	}
+}
+
+func TestCapitalReductionCalc(t *testing.T) {
+	cr := &CapitalReduction{
+		YQ:                   "2024Q1",
+		StockNo:              "2888",
+		CapitalReductionDate: "2024-03-01",
+		DistributionDate:     "2024-03-20",
+		Cash:                 MustParseDecimal("1"),
+		Ratio:                MustParseDecimal("0.3"),
+		NewStockNo:           "2888A",
+	}
+	lots := []*TransactionRecord{
+		NewTransactionRecord("2024-01-02", "09:00:00", "2888", 1, 1000, MustParseDecimal("50")),
+		NewTransactionRecord("2024-02-01", "09:00:00", "2888", 1, 555, MustParseDecimal("36")),
+	}
+
+	// Each lot is sold at its unit price, and its shares left bought at
+	// (unit price - cash) / (1 - ratio) under the new stock number
+	want := []*TransactionRecord{
+		NewTransactionRecord("2024-03-01", "08:00:00", "2888", -1, 1000, MustParseDecimal("50")),
+		NewTransactionRecord("2024-03-01", "08:00:00", "2888", -1, 555, MustParseDecimal("36")),
+		NewTransactionRecord("2024-03-20", "08:00:10", "2888A", 1, 700, MustParseDecimal("70")),
+		NewTransactionRecord("2024-03-20", "08:00:10", "2888A", 1, 388, MustParseDecimal("50")),
+	}
+	records := cr.CalcTransactionRecords(lots)
+	if len(records) != len(want) {
+		t.Fatalf("CalcTransactionRecords() = %d records, want %d", len(records), len(want))
+	}
+	for i, r := range records {
+		w := want[i]
+		if r.Date != w.Date || r.Time != w.Time || r.StockNo != w.StockNo || r.TranType != w.TranType ||
+			r.Quantity != w.Quantity || r.UnitPrice.Cmp(w.UnitPrice) != 0 || r.Source != SourceCapitalReduction {
+			t.Errorf("record %d = %+v, want %+v of the capital reduction", i, r, w)
+		}
+	}
+
+	// The buys keep the acquisition of their lot, through another reduction
+	for i, want := range []string{"2024-01-02 09:00:00", "2024-02-01 09:00:00"} {
+		if got := records[2+i].AcquiredAt(); got != want {
+			t.Errorf("buy %d acquired at %s, want %s", i, got, want)
+		}
+	}
+	again := &CapitalReduction{StockNo: "2888A", CapitalReductionDate: "2024-09-02", DistributionDate: "2024-09-20",
+		Ratio: MustParseDecimal("0.5")}
+	if got := again.CalcTransactionRecords(records[2:3])[1].AcquiredAt(); got != "2024-01-02 09:00:00" {
+		t.Errorf("buy of a second reduction acquired at %s, want 2024-01-02 09:00:00", got)
+	}
+
+	// 1555 shares refunded 1 each, and 0.5 share in lieu
+	cd := cr.CalcCashRecord([]int{1000, 555})
+	if cd.Kind != CashKindCapitalReduction || cd.Quantity != 1555 || cd.TotalAmount != 1560 || cd.ExDividendDate != "2024-03-01" {
+		t.Errorf("CalcCashRecord() = %+v, want 1560 for 1555 shares of the capital reduction", cd)
+	}
+}
@@ -0,0 +1,320 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// DecimalPlaces is the precision of Decimal. TWSE quotes prices with 2
+// decimal places, while dividends and capital reduction ratios come with up
+// to 8.
+const DecimalPlaces = 8
+
+const decimalScale int64 = 100000000 // 10^DecimalPlaces
+
+// ErrDecimalOverflow is returned when a value doesn't fit in a Decimal,
+// which holds about ±92 billion.
+var ErrDecimalOverflow = errors.New("decimal overflow")
+
+// Decimal is a fixed-point number for money, prices and ratios, so amounts
+// don't drift as float64 does. Arithmetic rounds half away from zero to
+// DecimalPlaces; use Floor to charge to the dollar as TWSE does.
+//
+// The zero value is 0.
+type Decimal struct {
+	units int64 // value * decimalScale
+}
+
+var (
+	DecimalZero = Decimal{}
+	DecimalOne  = Decimal{units: decimalScale}
+)
+
+// NewDecimalFromInt creates a Decimal of an integer.
+func NewDecimalFromInt(i int) Decimal {
+	return Decimal{units: mulDiv(int64(i), decimalScale, 1)}
+}
+
+// NewDecimalFromFloat creates a Decimal from the shortest representation of
+// f, so 0.1 becomes exactly 0.1. It panics if f doesn't fit in a Decimal.
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		panic(fmt.Sprintf("model: NewDecimalFromFloat(%v): %v", f, err))
+	}
+	return d
+}
+
+// ParseDecimal parses a decimal string such as "-130.55". Digits beyond
+// DecimalPlaces are rounded half away from zero.
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+
+	neg := false
+	if strings.HasPrefix(str, "-") || strings.HasPrefix(str, "+") {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(str, ".")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("invalid decimal '%s'", s)
+	}
+
+	var units int64
+	for _, c := range intPart {
+		if units > (math.MaxInt64-9)/10 {
+			return Decimal{}, fmt.Errorf("%w: '%s'", ErrDecimalOverflow, s)
+		}
+		units = units*10 + int64(c-'0')
+	}
+	if units > math.MaxInt64/decimalScale {
+		return Decimal{}, fmt.Errorf("%w: '%s'", ErrDecimalOverflow, s)
+	}
+	units *= decimalScale
+
+	scale := decimalScale
+	for i, c := range fracPart {
+		if i == DecimalPlaces {
+			if c >= '5' {
+				units++
+			}
+			break
+		}
+		scale /= 10
+		units += int64(c-'0') * scale
+	}
+
+	if neg {
+		units = -units
+	}
+	return Decimal{units: units}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics on error. It simplifies
+// the initialization of constants.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic("model: " + err.Error())
+	}
+	return d
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{units: d.units + o.units}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{units: d.units - o.units}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{units: -d.units}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{units: mulDiv(d.units, o.units, decimalScale)}
+}
+
+// MulInt multiplies d by an integer, e.g. a unit price by a quantity.
+func (d Decimal) MulInt(i int) Decimal {
+	return Decimal{units: mulDiv(d.units, int64(i), 1)}
+}
+
+// Div divides d by o. It panics if o is zero.
+func (d Decimal) Div(o Decimal) Decimal {
+	return Decimal{units: mulDiv(d.units, decimalScale, o.units)}
+}
+
+// DivInt divides d by an integer, e.g. a total amount by a quantity. It
+// panics if i is zero.
+func (d Decimal) DivInt(i int) Decimal {
+	return Decimal{units: mulDiv(d.units, 1, int64(i))}
+}
+
+// Cmp returns -1, 0 or +1 if d is less than, equal to or greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Sign returns -1, 0 or +1 by the sign of d.
+func (d Decimal) Sign() int {
+	return d.Cmp(DecimalZero)
+}
+
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+// Floor rounds d down to an integer, e.g. fees and taxes to the dollar.
+func (d Decimal) Floor() int {
+	q := d.units / decimalScale
+	if d.units%decimalScale < 0 {
+		q--
+	}
+	return int(q)
+}
+
+// Round rounds d half away from zero to the given decimal places.
+func (d Decimal) Round(places int) Decimal {
+	if places >= DecimalPlaces {
+		return d
+	}
+
+	unit := int64(math.Pow10(DecimalPlaces - places))
+	return Decimal{units: mulDiv(d.units, 1, unit) * unit}
+}
+
+// Float64 converts d to the nearest float64, for display and charts only.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String formats d without trailing zeros, e.g. "130.5".
+func (d Decimal) String() string {
+	s := d.StringFixed(DecimalPlaces)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// StringFixed formats d rounded to the given decimal places, e.g. "130.50".
+func (d Decimal) StringFixed(places int) string {
+	if places > DecimalPlaces {
+		places = DecimalPlaces
+	}
+	if places < 0 {
+		places = 0
+	}
+
+	units := d.Round(places).units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+
+	// Convert to uint64 to handle math.MinInt64
+	abs := uint64(units)
+	if units < 0 {
+		abs = uint64(-units)
+	}
+
+	intPart := abs / uint64(decimalScale)
+	s := sign + strconv.FormatUint(intPart, 10)
+	if places == 0 {
+		return s
+	}
+
+	frac := fmt.Sprintf("%0*d", DecimalPlaces, abs%uint64(decimalScale))
+	return s + "." + frac[:places]
+}
+
+// MarshalJSON encodes d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON decodes d from a JSON number or string.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores d as its decimal string. SQLite converts it into the REAL or
+// INTEGER affinity of the column, which keeps 15 significant digits, e.g.
+// 9,999,999.99999999, so reading it back by Scan round-trips exactly.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads d from a SQLite REAL, INTEGER or TEXT value.
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*d = DecimalZero
+	case int64:
+		if v > math.MaxInt64/decimalScale || v < math.MinInt64/decimalScale {
+			return fmt.Errorf("%w: %d", ErrDecimalOverflow, v)
+		}
+		*d = Decimal{units: v * decimalScale}
+	case float64:
+		*d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		*d, err = ParseDecimal(v)
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	default:
+		err = fmt.Errorf("can't scan %T into Decimal", src)
+	}
+	return err
+}
+
+// mulDiv returns a*b/c rounded half away from zero. The product is computed
+// in 128 bits so it doesn't overflow before the division. It panics if c is
+// zero or the result doesn't fit in int64.
+func mulDiv(a, b, c int64) int64 {
+	if c == 0 {
+		panic("model: decimal division by zero")
+	}
+
+	neg := (a < 0) != (b < 0) != (c < 0)
+	hi, lo := bits.Mul64(absUint64(a), absUint64(b))
+	uc := absUint64(c)
+	if hi >= uc {
+		panic("model: " + ErrDecimalOverflow.Error())
+	}
+
+	q, r := bits.Div64(hi, lo, uc)
+	if r >= uc-r {
+		q++
+	}
+	if q > math.MaxInt64 {
+		panic("model: " + ErrDecimalOverflow.Error())
+	}
+
+	if neg {
+		return -int64(q)
+	}
+	return int64(q)
+}
+
+func absUint64(i int64) uint64 {
+	if i < 0 {
+		return uint64(-i)
+	}
+	return uint64(i)
+}
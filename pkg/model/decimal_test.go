@@ -0,0 +1,94 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "130.5", want: "130.5"},
+		{input: "-0.001425", want: "-0.001425"},
+		{input: "+12", want: "12"},
+		{input: ".5", want: "0.5"},
+		{input: "3.", want: "3"},
+		{input: "0.123456785", want: "0.12345679"},
+		{input: "-0.123456785", want: "-0.12345679"},
+		{input: "", wantErr: true},
+		{input: "1,000", wantErr: true},
+		{input: "1e3", wantErr: true},
+		{input: "99999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDecimal(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDecimal(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseDecimal(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	d := MustParseDecimal
+
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{name: "Add", got: d("0.1").Add(d("0.2")), want: "0.3"},
+		{name: "MulInt", got: d("130.55").MulInt(15), want: "1958.25"},
+		{name: "Mul", got: d("130500").Mul(d("0.001425")), want: "185.9625"},
+		{name: "Div rounds half away from zero", got: d("2").Div(d("3")), want: "0.66666667"},
+		{name: "Negative Div", got: d("-2").Div(d("3")), want: "-0.66666667"},
+		{name: "DivInt", got: d("100").DivInt(3), want: "33.33333333"},
+		{name: "Round", got: d("2.345").Round(2), want: "2.35"},
+		{name: "Large Mul", got: d("90000000000").Mul(d("0.5")), want: "45000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+	if got := d("-0.5").Floor(); got != -1 {
+		t.Errorf("Floor(-0.5) = %d, want -1", got)
+	}
+	if got := d("185.9625").Floor(); got != 185 {
+		t.Errorf("Floor(185.9625) = %d, want 185", got)
+	}
+	if got := d("1958.2").StringFixed(2); got != "1958.20" {
+		t.Errorf("StringFixed(2) = %s, want 1958.20", got)
+	}
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	for _, s := range []string{"0", "130.55", "-0.00000001", "9999999.99999999", "0.83604612"} {
+		want := MustParseDecimal(s)
+
+		// SQLite hands a REAL column back as float64
+		var got Decimal
+		if err := got.Scan(want.Float64()); err != nil || got != want {
+			t.Errorf("Scan(float64 of %s) = %s, %v, want %s", s, got, err, want)
+		}
+
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("json.Marshal(%s) error = %v", s, err)
+		}
+		var decoded Decimal
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != want {
+			t.Errorf("json round trip of %s = %s, %v", s, decoded, err)
+		}
+	}
+}
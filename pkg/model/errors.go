@@ -0,0 +1,33 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned by a Repositorier when the requested record does
+// not exist, regardless of the underlying storage.
+var ErrNotFound = errors.New("record not found")
+
+// ErrOversell is returned when a sell exceeds the shares held, which would
+// open a short position.
+var ErrOversell = errors.New("oversell")
+
+// OversellError describes a sell exceeding the shares held. It matches
+// ErrOversell with errors.Is.
+type OversellError struct {
+	StockNo   string
+	Date      string
+	Time      string
+	Held      int
+	Requested int
+}
+
+func (e *OversellError) Error() string {
+	return fmt.Sprintf("oversell of %s on %s %s: selling %d shares, but holding %d",
+		e.StockNo, e.Date, e.Time, e.Requested, e.Held)
+}
+
+func (e *OversellError) Is(target error) bool {
+	return target == ErrOversell
+}
@@ -1,26 +1,58 @@
 package model
 
-// Transaction represents a share transaction.
+import "fmt"
+
+// ParValue is the par value (面額) of a TWSE share. Stock dividends (配股)
+// are declared in dollars of par value per share, e.g. a stock dividend of
+// 1.5 distributes 150 shares per 1000 shares.
+var ParValue = NewDecimalFromInt(10)
+
+// CashKind tells what a cash record of tblTransactionCash is received for.
+type CashKind int
+
+const (
+	CashKindDividend         CashKind = 0 // a cash dividend, with the cash in lieu of its stock dividend
+	CashKindCapitalReduction CashKind = 1 // the cash refunded by a capital reduction, with the cash in lieu
+)
+
+var cashKindNames = map[CashKind]string{
+	CashKindDividend:         "dividend",
+	CashKindCapitalReduction: "capital-reduction",
+}
+
+func (k CashKind) String() string {
+	if name, ok := cashKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+// ExDividend represents a dividend of a stock, paid in cash, in shares, or
+// both. The cash received, a row of tblTransactionCash, is an ExDividend of
+// its Kind.
 type ExDividend struct {
 	YQ               string  `gorm:"column:YQ"`
 	StockNo          string  `gorm:"column:stockNo"`
 	ExDividendDate   string  `gorm:"column:exDividendDate"`
 	DistributionDate string  `gorm:"column:distributionDate"`
-	CashDividend     float64 `gorm:"column:cashDividend"`
-	StockDividend    float64 `gorm:"column:stockDividend"`
+	CashDividend     Decimal `gorm:"column:cashDividend"`
+	StockDividend    Decimal `gorm:"column:stockDividend"`
 	Quantity         int     `gorm:"column:quantity"`
 	TotalAmount      int     `gorm:"column:totalAmount"`
+
+	Kind CashKind `gorm:"column:kind"` // of tblTransactionCash only
 }
 
-// NewTransactionRecord creates a new transaction record object.
+// NewCashDividendRecord creates a new cash dividend record object.
 func NewCashDividendRecord(yq, stockNo, exDividendDate, distributionDate string,
-	cashDividend float64, quantity, totalAmount int) *ExDividend {
+	cashDividend, stockDividend Decimal, quantity, totalAmount int) *ExDividend {
 	return &ExDividend{
 		YQ:               yq,
 		StockNo:          stockNo,
 		ExDividendDate:   exDividendDate,
 		DistributionDate: distributionDate,
 		CashDividend:     cashDividend,
+		StockDividend:    stockDividend,
 		Quantity:         quantity,
 		TotalAmount:      totalAmount,
 	}
@@ -30,21 +62,54 @@ func (ed *ExDividend) TableName() string {
 	return "tblDividend" // default table name
 }
 
+// CalcTransactionRecords calculates the record of the shares distributed by
+// the stock dividend of totalQuantity shares, or nil if there are none.
 func (ed *ExDividend) CalcTransactionRecords(totalQuantity int) *TransactionRecord {
-	distributionRecord := ed.calcDistributionRecord(totalQuantity)
+	shares, _ := ed.CalcStockDividend(totalQuantity)
+	if shares == 0 {
+		return nil
+	}
+
+	distributionRecord := ed.calcDistributionRecord(shares)
 	return distributionRecord
 }
 
-func (ed *ExDividend) calcDistributionRecord(totalQuantity int) *TransactionRecord {
-	return NewTransactionRecord(
-		ed.DistributionDate, "08:00:10",
-		ed.StockNo, -1, totalQuantity, ed.CashDividend)
+// calcDistributionRecord buys the distributed shares at zero cost, a lot of
+// their own, so the cost of the holding is unchanged. Only the average cost
+// basis spreads it over the distributed shares, repricing the lots before a
+// sell; fifo, lifo and specific write off the zero cost lot in its turn,
+// e.g. lifo first, its whole proceeds a gain.
+func (ed *ExDividend) calcDistributionRecord(shares int) *TransactionRecord {
+	distributionDate := ed.DistributionDate
+	if distributionDate == "" {
+		distributionDate = ed.ExDividendDate
+	}
+
+	tr := NewTransactionRecord(
+		distributionDate, "08:00:10",
+		ed.StockNo, 1, shares, DecimalZero)
+	tr.Source = SourceCorporateAction
+	return tr
+}
+
+// CalcStockDividend calculates the whole shares distributed by the stock
+// dividend of totalQuantity shares, and the cash paid in lieu of the
+// fractional share (畸零股) at par value, rounded down to the dollar.
+func (ed *ExDividend) CalcStockDividend(totalQuantity int) (shares int, cashInLieu int) {
+	entitled := ed.StockDividend.MulInt(totalQuantity).Div(ParValue)
+	shares = entitled.Floor()
+	cashInLieu = entitled.Sub(NewDecimalFromInt(shares)).Mul(ParValue).Floor()
+	return shares, cashInLieu
 }
 
+// CalcCashDividendRecord calculates the cash received for totalQuantity
+// shares: the cash dividend and the cash in lieu of the fractional share of
+// the stock dividend, each paid in whole dollars rounded down.
 func (ed *ExDividend) CalcCashDividendRecord(totalQuantity int) *ExDividend {
-	totalAmount := int(float64(totalQuantity) * ed.CashDividend)
+	_, cashInLieu := ed.CalcStockDividend(totalQuantity)
+	totalAmount := ed.CashDividend.MulInt(totalQuantity).Floor() + cashInLieu
 
 	return NewCashDividendRecord(
 		ed.YQ, ed.StockNo, ed.ExDividendDate, ed.DistributionDate,
-		ed.CashDividend, totalQuantity, totalAmount)
+		ed.CashDividend, ed.StockDividend, totalQuantity, totalAmount)
 }
@@ -0,0 +1,56 @@
+package model
+
+import "testing"
+
+func TestExDividendCalc(t *testing.T) {
+	tests := []struct {
+		name            string
+		cashDividend    string
+		stockDividend   string
+		quantity        int
+		wantShares      int
+		wantCashInLieu  int
+		wantTotalAmount int
+	}{
+		{name: "Cash only", cashDividend: "1.2", stockDividend: "0", quantity: 1000, wantShares: 0, wantCashInLieu: 0, wantTotalAmount: 1200},
+		{name: "Stock only", cashDividend: "0", stockDividend: "1.5", quantity: 1000, wantShares: 150, wantCashInLieu: 0, wantTotalAmount: 0},
+		// 1234 * 0.5 / 10 = 61.7 shares, 0.7 share paid at par value
+		{name: "Fractional share", cashDividend: "0", stockDividend: "0.5", quantity: 1234, wantShares: 61, wantCashInLieu: 7, wantTotalAmount: 7},
+		// 1234 * 1.2 = 1480.8 in cash, 1234 * 0.35 / 10 = 43.19 shares
+		{name: "Mixed cash and stock", cashDividend: "1.2", stockDividend: "0.35", quantity: 1234, wantShares: 43, wantCashInLieu: 1, wantTotalAmount: 1481},
+		{name: "No holding", cashDividend: "1.2", stockDividend: "0.5", quantity: 0, wantShares: 0, wantCashInLieu: 0, wantTotalAmount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ed := &ExDividend{
+				StockNo:          "2330",
+				ExDividendDate:   "2024-06-13",
+				DistributionDate: "2024-07-11",
+				CashDividend:     MustParseDecimal(tt.cashDividend),
+				StockDividend:    MustParseDecimal(tt.stockDividend),
+			}
+
+			shares, cashInLieu := ed.CalcStockDividend(tt.quantity)
+			if shares != tt.wantShares || cashInLieu != tt.wantCashInLieu {
+				t.Errorf("CalcStockDividend(%d) = %d, %d, want %d, %d", tt.quantity, shares, cashInLieu, tt.wantShares, tt.wantCashInLieu)
+			}
+
+			cd := ed.CalcCashDividendRecord(tt.quantity)
+			if cd.TotalAmount != tt.wantTotalAmount || cd.Quantity != tt.quantity {
+				t.Errorf("CalcCashDividendRecord(%d) = %d for %d shares, want %d", tt.quantity, cd.TotalAmount, cd.Quantity, tt.wantTotalAmount)
+			}
+
+			record := ed.CalcTransactionRecords(tt.quantity)
+			if tt.wantShares == 0 {
+				if record != nil {
+					t.Errorf("CalcTransactionRecords(%d) = %v, want nil", tt.quantity, record)
+				}
+				return
+			}
+			if record == nil || record.Quantity != tt.wantShares || record.TranType != 1 ||
+				!record.UnitPrice.IsZero() || record.Date != ed.DistributionDate {
+				t.Errorf("CalcTransactionRecords(%d) = %+v, want a zero-cost buy of %d shares on %s", tt.quantity, record, tt.wantShares, ed.DistributionDate)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+// Broker commission (手續費) of TWSE, charged on both buy and sell.
+var DefaultFeeRate = MustParseDecimal("0.001425")
+
+const DefaultMinimumFee = 20
+
+// FeeSchedule calculates the broker commission of a transaction. Implement it
+// to model a broker with special rules.
+type FeeSchedule interface {
+	Fee(t *Transaction) int
+}
+
+// BrokerFeeSchedule charges the total amount times the fee rate and the
+// broker discount, rounded down to the dollar, but at least the minimum fee.
+type BrokerFeeSchedule struct {
+	Rate       Decimal
+	Discount   Decimal // e.g. 0.6 for 60% of the rate (六折), 1 for no discount
+	MinimumFee int
+}
+
+// NewBrokerFeeSchedule creates a fee schedule of a broker.
+func NewBrokerFeeSchedule(rate, discount Decimal, minimumFee int) *BrokerFeeSchedule {
+	return &BrokerFeeSchedule{
+		Rate:       rate,
+		Discount:   discount,
+		MinimumFee: minimumFee,
+	}
+}
+
+// DefaultFeeSchedule returns the standard TWSE commission without discount.
+func DefaultFeeSchedule() *BrokerFeeSchedule {
+	return NewBrokerFeeSchedule(DefaultFeeRate, DecimalOne, DefaultMinimumFee)
+}
+
+func (fs *BrokerFeeSchedule) Fee(t *Transaction) int {
+	if t.TotalAmount.Sign() <= 0 {
+		return 0
+	}
+
+	fee := t.TotalAmount.Mul(fs.Rate).Mul(fs.Discount).Floor()
+	if fee < fs.MinimumFee {
+		fee = fs.MinimumFee
+	}
+
+	return fee
+}
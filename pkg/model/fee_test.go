@@ -0,0 +1,29 @@
+package model
+
+import "testing"
+
+func TestBrokerFeeSchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		feeSchedule *BrokerFeeSchedule
+		quantity    int
+		unitPrice   string
+		want        int
+	}{
+		{name: "Standard rate", feeSchedule: DefaultFeeSchedule(), quantity: 1000, unitPrice: "130.5", want: 185},
+		{name: "Float error", feeSchedule: DefaultFeeSchedule(), quantity: 1000, unitPrice: "200", want: 285},
+		{name: "Minimum fee", feeSchedule: DefaultFeeSchedule(), quantity: 10, unitPrice: "50", want: 20},
+		{name: "Discount", feeSchedule: NewBrokerFeeSchedule(DefaultFeeRate, MustParseDecimal("0.6"), 20), quantity: 1000, unitPrice: "130.5", want: 111},
+		{name: "Discount under minimum", feeSchedule: NewBrokerFeeSchedule(DefaultFeeRate, MustParseDecimal("0.28"), 20), quantity: 100, unitPrice: "100", want: 20},
+		{name: "Odd lot minimum", feeSchedule: NewBrokerFeeSchedule(DefaultFeeRate, MustParseDecimal("0.6"), 1), quantity: 5, unitPrice: "100", want: 1},
+		{name: "No amount", feeSchedule: DefaultFeeSchedule(), quantity: 0, unitPrice: "100", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tran := NewTransactionFromInput("2023-12-01", "09:00:00", "0050", 1, tt.quantity, MustParseDecimal(tt.unitPrice), tt.feeSchedule, nil)
+			if tran.Fee != tt.want {
+				t.Errorf("Fee of %d shares at %s = %d, want %d", tt.quantity, tt.unitPrice, tran.Fee, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+// ImportBatch is a file imported into the ledger. The entries of the ledger
+// reference the batch which imported them.
+type ImportBatch struct {
+	ID         int    `gorm:"column:id"`
+	FileName   string `gorm:"column:fileName"`
+	FileHash   string `gorm:"column:fileHash"` // SHA-256 of the content
+	Format     string `gorm:"column:format"`
+	ImportedAt string `gorm:"column:importedAt"`
+	RowCount   int    `gorm:"column:rowCount"`
+}
+
+func (b *ImportBatch) TableName() string {
+	return "tblImportBatch" // default table name
+}
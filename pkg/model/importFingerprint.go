@@ -0,0 +1,48 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// ImportFingerprint identifies a row imported by stock import.
+type ImportFingerprint struct {
+	Fingerprint string `gorm:"column:fingerprint;primaryKey"`
+	Date        string `gorm:"column:date"`
+	Time        string `gorm:"column:time"`
+	StockNo     string `gorm:"column:stockNo"`
+	ImportedAt  string `gorm:"column:importedAt"`
+	BatchID     *int   `gorm:"column:batchId"` // nil if imported into the inventory only
+}
+
+func (fp *ImportFingerprint) TableName() string {
+	return "tblImportFingerprint" // default table name
+}
+
+// NewImportFingerprints fingerprints the records of a file by their fields
+// and their occurrence in the file. The ledger is keyed by the time of the
+// trades though, so of two identical records the second is rejected as a
+// transaction at the same time, and the file with it. The files without the
+// time of the trades are timed by the importer, their records all differ.
+func NewImportFingerprints(trs []*TransactionRecord, importedAt string) []*ImportFingerprint {
+	occurrences := map[string]int{}
+
+	fps := make([]*ImportFingerprint, 0, len(trs))
+	for _, tr := range trs {
+		key := fmt.Sprintf("%s|%s|%s|%d|%d|%s",
+			tr.Date, tr.Time, tr.StockNo, tr.TranType, tr.Quantity, tr.UnitPrice.String())
+		occurrences[key]++
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, occurrences[key])))
+		fps = append(fps, &ImportFingerprint{
+			Fingerprint: hex.EncodeToString(sum[:]),
+			Date:        tr.Date,
+			Time:        tr.Time,
+			StockNo:     tr.StockNo,
+			ImportedAt:  importedAt,
+		})
+	}
+
+	return fps
+}
@@ -9,21 +9,48 @@ type Repositorier interface {
 	CreateTransactionHistory(t *Transaction) (int, error)
 	CreateTransactions(ts []*Transaction) ([]int, error)
 	CreateTransactionRecordSys(tr *TransactionRecord) error
+	CreateTransactionRecordSysBatch(trs []*TransactionRecord) error
 	CreateCashDividendRecord(cd *ExDividend) error
+	CreateCashDividendRecords(cds []*ExDividend) error
+	CreateLedgerEntry(le *LedgerEntry) error
+	CreateRealizedPnL(pnl *RealizedPnL) error
+	CreateImportFingerprint(fp *ImportFingerprint) error
+	CreateImportBatch(b *ImportBatch) (int, error)
+	CreatePrices(prices []*Price) error
 
 	FindEarliestTransactionByStockNo(stockNo string) (*Transaction, error)
+	FindImportFingerprint(fingerprint string) (*ImportFingerprint, error)
+	FindImportBatchByFileHash(fileHash string) (*ImportBatch, error)
+	FindStockMapping(stockNo string) (*StockMapping, error)
 	QueryCapitalReductionAll() ([]*CapitalReduction, error)
+	QueryCashDividendAll() ([]*ExDividend, error)
 	QueryDividendAll() ([]*ExDividend, error)
+	QueryImportBatchAll() ([]*ImportBatch, error)
+	QueryImportBatchByID(id int) (*ImportBatch, error)
+	QueryLatestPriceAll() ([]*Price, error)
+	QueryLedger(from, to, stockNo string) ([]*LedgerEntry, error)
+	QueryPrices(from, to, stockNo string) ([]*Price, error)
+	QueryRealizedPnL(from, to, stockNo string) ([]*RealizedPnL, error)
+	QueryStockMappingAll() ([]*StockMapping, error)
+	QueryStockNoTradedFrom(from string) ([]string, error)
 	QueryTransactionAll() ([]*Transaction, error)
 	QueryTransactionByID(id int) (*Transaction, error)
 	QueryTransactionByDetails(stockNo string, tranType int, date string) ([]*Transaction, error)
-	QueryTransactionRecordAll() ([]*TransactionRecord, error)
-	QueryTransactionRecordSysAll() ([]*TransactionRecord, error)
+	QueryTransactionInventory() ([]*Transaction, error)
 
 	UpdateTransaction(id int, t *Transaction) error
+	UpdateLedgerEntryFee(date, time, stockNo string, fee, taxes int) error
+	UpdateLedgerEntryLots(date, time, stockNo, costBasis, lots string) error
+	UpdateLedgerEntryUnitPrice(date, time string, unitPrice Decimal) error
+	UpsertStockMapping(sm *StockMapping) error
 
 	DeleteTransaction(id int) error
 	DeleteTransactions(ids []int) error
+	DeleteImportBatch(id int) error
+	DeleteLedgerEntry(date, time string) error
+	DeleteStockInventory(stockNo, date, time string) error
+	DeleteTransactionRecordSys(stockNo, from string) error
+	DeleteCashDividendRecords(stockNo, from string) error
 
 	DropTable(tablename string) error
 
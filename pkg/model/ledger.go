@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RecordSource tells where an entry of the transaction ledger comes from.
+type RecordSource int
+
+const (
+	SourceManual RecordSource = 1 // manual input, e.g. a spreadsheet
+	SourceBroker RecordSource = 2 // exported from the stock system of the broker
+	SourceCLI    RecordSource = 3 // command line interface
+	SourceWeb    RecordSource = 4 // web
+
+	// SourceCorporateAction is a record generated from a stock dividend by
+	// the rebuild, never stored in the ledger table.
+	SourceCorporateAction RecordSource = 5
+	// SourceCapitalReduction is a record generated from a capital reduction
+	// by the rebuild, never stored in the ledger table. The inventory is not
+	// replayed from them, the capital reduction scales its lots in place.
+	SourceCapitalReduction RecordSource = 6
+)
+
+var recordSourceNames = map[RecordSource]string{
+	SourceManual:           "manual",
+	SourceBroker:           "broker",
+	SourceCLI:              "cli",
+	SourceWeb:              "web",
+	SourceCorporateAction:  "corporate-action",
+	SourceCapitalReduction: "capital-reduction",
+}
+
+func (s RecordSource) String() string {
+	if name, ok := recordSourceNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// IsCorporateAction tells whether the record is generated from a corporate
+// action, a stock dividend or a capital reduction.
+func (s RecordSource) IsCorporateAction() bool {
+	return s == SourceCorporateAction || s == SourceCapitalReduction
+}
+
+// ParseRecordSource parses the name of a source, e.g. "broker".
+func ParseRecordSource(name string) (RecordSource, error) {
+	for s, n := range recordSourceNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown source '%s', valid sources are: manual, broker, cli, web, corporate-action, capital-reduction", name)
+}
+
+// LedgerEntry is an entry of the transaction ledger, tblTransactionRecord,
+// which the records of tblTransactionRecordSys are rebuilt from. The ledger
+// read by the repository also lists the records generated by the corporate
+// actions, of SourceCorporateAction or SourceCapitalReduction.
+type LedgerEntry struct {
+	TransactionRecord `gorm:"embedded"`
+	StockName         string `gorm:"column:stockName"`
+	BatchID           *int   `gorm:"column:batchId"` // nil if not imported by a batch
+
+	// Fee and Taxes are the ones the trade was charged when it was added to
+	// the inventory, nil until then. A rebuild keeps them.
+	Fee   *int `gorm:"column:fee"`
+	Taxes *int `gorm:"column:taxes"`
+
+	// CostBasis is the cost basis method the trade was added with, e.g.
+	// "lifo", and Lots the lots a sell of the specific lot method wrote off,
+	// see LotRefs. Both are empty for the trades added before they were
+	// recorded, which a rebuild replays by the configured method.
+	CostBasis string `gorm:"column:costBasis"`
+	Lots      string `gorm:"column:lots"`
+}
+
+// NewLedgerEntry creates a new entry of the transaction ledger.
+func NewLedgerEntry(date, time, stockNo, stockName string, tranType, quantity int,
+	unitPrice Decimal, source RecordSource) *LedgerEntry {
+	le := &LedgerEntry{
+		TransactionRecord: *NewTransactionRecord(date, time, stockNo, tranType, quantity, unitPrice),
+		StockName:         stockName,
+	}
+	le.Source = source
+	return le
+}
+
+func (le *LedgerEntry) TableName() string {
+	return "tblTransactionRecord" // default table name
+}
+
+// LotRefs returns the lots the sell wrote off, in order, by their
+// acquisition time, see Lot.AcquiredAt.
+func (le *LedgerEntry) LotRefs() []string {
+	if le.Lots == "" {
+		return nil
+	}
+	return strings.Split(le.Lots, ",")
+}
+
+// FormatLotRefs joins the acquisition times of lots, as LedgerEntry.Lots
+// records them.
+func FormatLotRefs(refs []string) string {
+	return strings.Join(refs, ",")
+}
@@ -0,0 +1,65 @@
+package model
+
+// Lot is a position a sell can write off: a Transaction in the inventory, or
+// a TransactionRecord while the records are replayed. The cost basis methods
+// of the service choose and price the lots through it.
+type Lot interface {
+	// LotID identifies the lot in the inventory, 0 for a record.
+	LotID() int
+	// AcquiredAt is "2006-01-02 15:04:05", comparable as strings.
+	AcquiredAt() string
+	LotQuantity() int
+	LotUnitPrice() Decimal
+	// Reprice reprices the lot, e.g. to the moving average. The fee and
+	// taxes recorded on it, the ones paid, are kept.
+	Reprice(unitPrice Decimal)
+}
+
+func (tr *TransactionRecord) LotID() int {
+	return 0
+}
+
+// AcquiredAt is the acquisition of the lot the record distributes the
+// shares of, or the time of the record.
+func (tr *TransactionRecord) AcquiredAt() string {
+	if tr.AcquiredDate != "" {
+		return tr.AcquiredDate + " " + tr.AcquiredTime
+	}
+	return tr.Date + " " + tr.Time
+}
+
+func (tr *TransactionRecord) LotQuantity() int {
+	return tr.Quantity
+}
+
+func (tr *TransactionRecord) LotUnitPrice() Decimal {
+	return tr.UnitPrice
+}
+
+// Reprice updates the unit price of the record.
+func (tr *TransactionRecord) Reprice(unitPrice Decimal) {
+	tr.UnitPrice = unitPrice
+}
+
+func (t *Transaction) LotID() int {
+	return t.ID
+}
+
+func (t *Transaction) AcquiredAt() string {
+	return t.Date + " " + t.Time
+}
+
+func (t *Transaction) LotQuantity() int {
+	return t.Quantity
+}
+
+func (t *Transaction) LotUnitPrice() Decimal {
+	return t.UnitPrice
+}
+
+// Reprice updates the unit price and the total amount of the lot, unlike
+// SetUnitPrice, it doesn't recalculate the fee and taxes.
+func (t *Transaction) Reprice(unitPrice Decimal) {
+	t.UnitPrice = unitPrice
+	t.calculateTotalAmount()
+}
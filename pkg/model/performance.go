@@ -0,0 +1,125 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Period is a range of dates, inclusive, to measure the returns over.
+type Period struct {
+	Name string
+	From string // empty since inception
+	To   string
+}
+
+// StandardPeriods returns the year to date, the year and the time since
+// inception until the date to.
+func StandardPeriods(to string) ([]Period, error) {
+	date, err := time.Parse(time.DateOnly, to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%s': %w", to, err)
+	}
+
+	return []Period{
+		{Name: "YTD", From: fmt.Sprintf("%04d-01-01", date.Year()), To: to},
+		{Name: "1Y", From: date.AddDate(-1, 0, 1).Format(time.DateOnly), To: to},
+		{Name: "Inception", To: to},
+	}, nil
+}
+
+// DailyValue is the market value of the holdings at the close of a day.
+type DailyValue struct {
+	Date  string
+	Value Decimal
+}
+
+// Performance is the returns of a stock, or of the portfolio, over a period.
+type Performance struct {
+	StockNo string // empty for the portfolio
+	Period  string
+	From    string // the first cash flow since inception
+	To      string
+	XIRR    *float64 // money-weighted, annual, nil without a return
+	TWR     *float64 // time-weighted over the period, nil if nothing was held
+}
+
+// NewPerformance measures the returns over the period of the holdings valued
+// at values, with the cash flows of the investor: paid for the buys, received
+// for the sells and as cash dividends. The values and the flows are ordered
+// by date, all the ones until the end of the period.
+//
+// The money-weighted return is the XIRR of the flows of the period, the
+// value before the period paid on its first day, and the value at its end
+// received on its last day. The time-weighted return chains the returns of
+// the days, the buys invested at the start of a day, and the sells and the
+// cash dividends taken out at its end, so it does not depend on the timing
+// and the size of the flows.
+func NewPerformance(stockNo string, period Period, values []DailyValue, flows []CashFlow) *Performance {
+	from, to := period.From, period.To
+	if from == "" && len(flows) > 0 {
+		from = flows[0].Date
+	}
+	perf := &Performance{StockNo: stockNo, Period: period.Name, From: from, To: to}
+	if from > to {
+		return perf // an empty period
+	}
+
+	// The value before the period, at the close of its last day before from
+	var start Decimal
+	var i int
+	for ; i < len(values) && values[i].Date < from; i++ {
+		start = values[i].Value
+	}
+	var j int
+	for j < len(flows) && flows[j].Date < from {
+		j++
+	}
+
+	end := start
+	growth := 1.0
+	measured := false
+	previous := start.Float64()
+	var periodFlows []CashFlow
+	for ; i < len(values) && values[i].Date <= to; i++ {
+		var paid, received float64
+		for ; j < len(flows) && flows[j].Date <= values[i].Date; j++ {
+			periodFlows = append(periodFlows, flows[j])
+			if amount := flows[j].Amount.Float64(); amount < 0 {
+				paid -= amount
+			} else {
+				received += amount
+			}
+		}
+
+		value := values[i].Value.Float64()
+		if invested := previous + paid; invested > 0 {
+			growth *= (value + received) / invested
+			measured = true
+		}
+		previous = value
+		end = values[i].Value
+	}
+	// The flows after the last value of the period, e.g. cash dividends
+	for ; j < len(flows) && flows[j].Date <= to; j++ {
+		periodFlows = append(periodFlows, flows[j])
+	}
+
+	if measured {
+		twr := growth - 1
+		perf.TWR = &twr
+	}
+
+	var xirrFlows []CashFlow
+	if start.Sign() > 0 {
+		xirrFlows = append(xirrFlows, CashFlow{Date: from, Amount: start.Neg()})
+	}
+	xirrFlows = append(xirrFlows, periodFlows...)
+	if end.Sign() > 0 {
+		xirrFlows = append(xirrFlows, CashFlow{Date: to, Amount: end})
+	}
+	if xirr, err := XIRR(xirrFlows); err == nil {
+		perf.XIRR = &xirr
+	}
+
+	return perf
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStandardPeriods(t *testing.T) {
+	periods, err := StandardPeriods("2024-03-15")
+	if err != nil {
+		t.Fatalf("StandardPeriods() error = %v", err)
+	}
+
+	want := []Period{
+		{Name: "YTD", From: "2024-01-01", To: "2024-03-15"},
+		{Name: "1Y", From: "2023-03-16", To: "2024-03-15"},
+		{Name: "Inception", To: "2024-03-15"},
+	}
+	for i := range want {
+		if periods[i] != want[i] {
+			t.Errorf("StandardPeriods()[%d] = %+v, want %+v", i, periods[i], want[i])
+		}
+	}
+
+	if _, err := StandardPeriods("2024/03/15"); err == nil {
+		t.Errorf("StandardPeriods() of an invalid date succeeded, want an error")
+	}
+}
+
+func TestNewPerformance(t *testing.T) {
+	tests := []struct {
+		name     string
+		period   Period
+		values   []DailyValue
+		flows    []CashFlow
+		wantXIRR float64 // NaN for none
+		wantTWR  float64
+	}{
+		{
+			name:   "a year at 10%",
+			period: Period{To: "2024-01-01"},
+			values: []DailyValue{
+				{"2023-01-01", NewDecimalFromInt(1000)},
+				{"2024-01-01", NewDecimalFromInt(1100)},
+			},
+			flows:    []CashFlow{{"2023-01-01", NewDecimalFromInt(-1000)}},
+			wantXIRR: 0.1,
+			wantTWR:  0.1,
+		},
+		{
+			// +10%, then -10% after buying 10 times more: the time-weighted
+			// return is -1% whatever was bought, while the money paid exceeds
+			// the money received at any rate, so it has no XIRR
+			name:   "a large buy before a fall",
+			period: Period{To: "2023-01-03"},
+			values: []DailyValue{
+				{"2023-01-01", NewDecimalFromInt(100)},
+				{"2023-01-02", NewDecimalFromInt(110)},
+				{"2023-01-03", NewDecimalFromInt(999)},
+			},
+			flows: []CashFlow{
+				{"2023-01-01", NewDecimalFromInt(-100)},
+				{"2023-01-03", NewDecimalFromInt(-1000)},
+			},
+			wantXIRR: math.NaN(),
+			wantTWR:  1.1*0.9 - 1,
+		},
+		{
+			// held before the period, the value before it is paid on its
+			// first day
+			name:   "year to date",
+			period: Period{Name: "YTD", From: "2024-01-01", To: "2024-01-31"},
+			values: []DailyValue{
+				{"2023-06-01", NewDecimalFromInt(900)},
+				{"2023-12-29", NewDecimalFromInt(1000)},
+				{"2024-01-31", NewDecimalFromInt(1050)},
+			},
+			flows:    []CashFlow{{"2023-06-01", NewDecimalFromInt(-900)}},
+			wantXIRR: math.Pow(1.05, 365.0/30) - 1,
+			wantTWR:  0.05,
+		},
+		{
+			// sold at +20% with a dividend of 5% before
+			name:   "sold with a dividend",
+			period: Period{To: "2024-01-01"},
+			values: []DailyValue{
+				{"2023-01-01", NewDecimalFromInt(1000)},
+				{"2023-07-02", NewDecimalFromInt(1100)},
+				{"2024-01-01", DecimalZero},
+			},
+			flows: []CashFlow{
+				{"2023-01-01", NewDecimalFromInt(-1000)},
+				{"2023-07-02", NewDecimalFromInt(50)},
+				{"2024-01-01", NewDecimalFromInt(1200)},
+			},
+			wantXIRR: 0.25605,
+			wantTWR:  (1150.0/1000)*(1200.0/1100) - 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPerformance("", tt.period, tt.values, tt.flows)
+			if math.IsNaN(tt.wantXIRR) {
+				if got.XIRR != nil {
+					t.Errorf("XIRR = %v, want none", *got.XIRR)
+				}
+			} else if got.XIRR == nil || math.Abs(*got.XIRR-tt.wantXIRR) > 1e-3*math.Max(1, math.Abs(tt.wantXIRR)) {
+				t.Errorf("XIRR = %v, want %v", ratePtr(got.XIRR), tt.wantXIRR)
+			}
+			if got.TWR == nil || math.Abs(*got.TWR-tt.wantTWR) > 1e-9 {
+				t.Errorf("TWR = %v, want %v", ratePtr(got.TWR), tt.wantTWR)
+			}
+		})
+	}
+
+	// Nothing held nor traded in the period
+	got := NewPerformance("2330", Period{From: "2024-01-01", To: "2024-12-31"},
+		[]DailyValue{{"2023-01-02", DecimalZero}}, []CashFlow{{"2023-01-02", NewDecimalFromInt(-1000)}})
+	if got.XIRR != nil || got.TWR != nil {
+		t.Errorf("NewPerformance() without holdings = %v, %v, want no returns", ratePtr(got.XIRR), ratePtr(got.TWR))
+	}
+
+	// The period after the date to
+	got = NewPerformance("2330", Period{From: "2024-02-01", To: "2024-01-31"},
+		[]DailyValue{{"2024-01-02", NewDecimalFromInt(1000)}}, []CashFlow{{"2024-01-02", NewDecimalFromInt(-1000)}})
+	if got.XIRR != nil || got.TWR != nil {
+		t.Errorf("NewPerformance() of an empty period = %v, %v, want no returns", ratePtr(got.XIRR), ratePtr(got.TWR))
+	}
+}
+
+// ratePtr formats a rate which may be nil.
+func ratePtr(r *float64) interface{} {
+	if r == nil {
+		return nil
+	}
+	return *r
+}
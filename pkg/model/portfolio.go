@@ -0,0 +1,127 @@
+package model
+
+import "sort"
+
+// PortfolioValue is the holding of a stock, or of the whole portfolio, at the
+// close of a day. A stock without a price yet is valued at its cost.
+type PortfolioValue struct {
+	StockNo     string   // empty for the whole portfolio
+	Quantity    int      // 0 for the whole portfolio
+	Cost        Decimal  // unit price * quantity of the lots held, before fees and taxes
+	LastClose   *Decimal // on or before the day, nil for the whole portfolio
+	MarketValue Decimal
+}
+
+// PortfolioDay is the holdings of a day and their total.
+type PortfolioDay struct {
+	Date   string
+	Stocks []*PortfolioValue // ordered by stock number
+	Total  *PortfolioValue
+}
+
+// NewPortfolioTimeSeries replays the ledger merged with the records of the
+// corporate actions to the holdings at the close of each day between the
+// dates from and to, inclusive, valued at the prices. The days are the ones
+// with a price or an entry, since the first entry if from is empty, and until
+// the last price or entry if to is. A sell reduces the cost by the cost of
+// the lots it wrote off, the realized profit and loss of its date, so the
+// cost is the one of the inventory whatever the cost basis method. A capital
+// reduction reduces the cost by its record of each lot instead. The entries,
+// the realized profit and loss and the prices are all the ones until to,
+// ordered by date.
+func NewPortfolioTimeSeries(entries []*LedgerEntry, pnls []*RealizedPnL, prices []*Price, from, to string) []*PortfolioDay {
+	type dayKey struct{ stockNo, date string }
+	writtenOff := map[dayKey]Decimal{}
+	for _, pnl := range pnls {
+		k := dayKey{pnl.StockNo, pnl.SellDate}
+		writtenOff[k] = writtenOff[k].Add(pnl.Cost)
+	}
+
+	if from == "" && len(entries) > 0 {
+		from = entries[0].Date // since the first entry
+	}
+
+	dateSet := map[string]bool{}
+	for _, e := range entries {
+		if inDateRange(e.Date, from, to) {
+			dateSet[e.Date] = true
+		}
+	}
+	for _, p := range prices {
+		if inDateRange(p.Date, from, to) {
+			dateSet[p.Date] = true
+		}
+	}
+	dates := make([]string, 0, len(dateSet))
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	holdings := map[string]*PortfolioValue{}
+	closes := map[string]Decimal{}
+	var days []*PortfolioDay
+	var i, j int
+	for _, date := range dates {
+		// Entries before the first day only make up the holdings
+		for ; i < len(entries) && entries[i].Date <= date; i++ {
+			e := entries[i]
+			h, ok := holdings[e.StockNo]
+			if !ok {
+				h = &PortfolioValue{StockNo: e.StockNo}
+				holdings[e.StockNo] = h
+			}
+
+			h.Quantity += e.TranType * e.Quantity
+			if e.TranType > 0 || e.Source == SourceCapitalReduction {
+				h.Cost = h.Cost.Add(e.UnitPrice.MulInt(e.TranType * e.Quantity))
+			}
+
+			// The lots written off by the sells of the day, once
+			k := dayKey{e.StockNo, e.Date}
+			if cost, ok := writtenOff[k]; ok {
+				h.Cost = h.Cost.Sub(cost)
+				delete(writtenOff, k)
+			}
+		}
+		for ; j < len(prices) && prices[j].Date <= date; j++ {
+			closes[prices[j].StockNo] = prices[j].Close
+		}
+
+		days = append(days, newPortfolioDay(date, holdings, closes))
+	}
+
+	return days
+}
+
+// newPortfolioDay values the holdings, except the ones closed, at the closes.
+func newPortfolioDay(date string, holdings map[string]*PortfolioValue, closes map[string]Decimal) *PortfolioDay {
+	day := &PortfolioDay{Date: date, Total: &PortfolioValue{}}
+	for stockNo, h := range holdings {
+		if h.Quantity == 0 {
+			continue
+		}
+
+		v := &PortfolioValue{StockNo: stockNo, Quantity: h.Quantity, Cost: h.Cost, MarketValue: h.Cost}
+		if c, ok := closes[stockNo]; ok {
+			lastClose := c
+			v.LastClose = &lastClose
+			v.MarketValue = c.MulInt(h.Quantity)
+		}
+		day.Stocks = append(day.Stocks, v)
+
+		day.Total.Cost = day.Total.Cost.Add(v.Cost)
+		day.Total.MarketValue = day.Total.MarketValue.Add(v.MarketValue)
+	}
+	sort.Slice(day.Stocks, func(i, j int) bool {
+		return day.Stocks[i].StockNo < day.Stocks[j].StockNo
+	})
+
+	return day
+}
+
+// inDateRange reports whether the date is between the dates from and to,
+// inclusive. Empty dates are ignored.
+func inDateRange(date, from, to string) bool {
+	return (from == "" || date >= from) && (to == "" || date <= to)
+}
@@ -0,0 +1,62 @@
+package model
+
+import "testing"
+
+func TestNewPortfolioTimeSeries(t *testing.T) {
+	entries := []*LedgerEntry{
+		NewLedgerEntry("2024-01-02", "09:00:00", "2330", "台積電", 1, 1000, NewDecimalFromInt(100), SourceCLI),
+		NewLedgerEntry("2024-01-03", "09:00:00", "0050", "元大台灣50", 1, 2000, NewDecimalFromInt(50), SourceCLI),
+		NewLedgerEntry("2024-01-04", "09:00:00", "2330", "台積電", -1, 400, NewDecimalFromInt(110), SourceCLI),
+		NewLedgerEntry("2024-01-05", "00:00:00", "2330", "台積電", 1, 60, DecimalZero, SourceCorporateAction),
+		// a capital reduction of 0050 by half, refunding 10 a share
+		NewLedgerEntry("2024-01-08", "08:00:00", "0050", "元大台灣50", -1, 2000, NewDecimalFromInt(50), SourceCapitalReduction),
+		NewLedgerEntry("2024-01-09", "08:00:10", "0050", "元大台灣50", 1, 1000, NewDecimalFromInt(80), SourceCapitalReduction),
+	}
+	pnls := []*RealizedPnL{
+		{StockNo: "2330", SellDate: "2024-01-04", Quantity: 400, Cost: NewDecimalFromInt(40000)},
+	}
+	prices := []*Price{
+		{StockNo: "2330", Date: "2023-12-29", Close: NewDecimalFromInt(99)},
+		{StockNo: "2330", Date: "2024-01-02", Close: NewDecimalFromInt(101)},
+		{StockNo: "2330", Date: "2024-01-04", Close: NewDecimalFromInt(110)},
+		{StockNo: "0050", Date: "2024-01-09", Close: NewDecimalFromInt(85)},
+	}
+
+	days := NewPortfolioTimeSeries(entries, pnls, prices, "", "")
+
+	want := []struct {
+		date        string
+		cost        int
+		marketValue int
+		stocks      int
+	}{
+		{"2024-01-02", 100000, 101000, 1},        // 1000 * 101
+		{"2024-01-03", 200000, 201000, 2},        // 0050 at its cost without a price
+		{"2024-01-04", 160000, 166000, 2},        // 600 * 110 + 100000
+		{"2024-01-05", 160000, 172600, 2},        // 660 * 110 + 100000
+		{"2024-01-08", 60000, 72600, 1},          // 0050 suspended
+		{"2024-01-09", 140000, 72600 + 85000, 2}, // 1000 * 85
+	}
+	if len(days) != len(want) {
+		t.Fatalf("NewPortfolioTimeSeries() = %d days, want %d", len(days), len(want))
+	}
+	for i, w := range want {
+		d := days[i]
+		if d.Date != w.date || d.Total.Cost.Cmp(NewDecimalFromInt(w.cost)) != 0 ||
+			d.Total.MarketValue.Cmp(NewDecimalFromInt(w.marketValue)) != 0 || len(d.Stocks) != w.stocks {
+			t.Errorf("day %d = %s cost %s value %s of %d stocks, want %s cost %d value %d of %d stocks",
+				i, d.Date, d.Total.Cost, d.Total.MarketValue, len(d.Stocks), w.date, w.cost, w.marketValue, w.stocks)
+		}
+	}
+
+	last := days[len(days)-1].Stocks
+	if last[0].StockNo != "0050" || last[0].Quantity != 1000 || last[1].StockNo != "2330" || last[1].Quantity != 660 ||
+		last[1].LastClose.Cmp(NewDecimalFromInt(110)) != 0 {
+		t.Errorf("stocks of the last day = %+v, %+v", last[0], last[1])
+	}
+
+	days = NewPortfolioTimeSeries(entries, pnls, prices, "2024-01-04", "2024-01-05")
+	if len(days) != 2 || days[0].Date != "2024-01-04" || days[0].Total.Cost.Cmp(NewDecimalFromInt(160000)) != 0 {
+		t.Errorf("NewPortfolioTimeSeries() from 2024-01-04 to 2024-01-05 = %d days, want 2 from the holdings before", len(days))
+	}
+}
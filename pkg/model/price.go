@@ -0,0 +1,105 @@
+package model
+
+import "encoding/json"
+
+// Price is the daily quote of a stock, a row of tblPrice.
+type Price struct {
+	StockNo string  `gorm:"column:stockNo"`
+	Date    string  `gorm:"column:date"`
+	Open    Decimal `gorm:"column:open"`
+	High    Decimal `gorm:"column:high"`
+	Low     Decimal `gorm:"column:low"`
+	Close   Decimal `gorm:"column:close"`
+	Volume  int     `gorm:"column:volume"` // shares traded
+}
+
+func (p *Price) TableName() string {
+	return "tblPrice" // default table name
+}
+
+// Valuation is a stock of the inventory valued at its last close. The close
+// and the values are nil if the stock has no price.
+type Valuation struct {
+	*Transaction // the shares and the cost of the stock, summed up
+
+	CloseDate      string
+	LastClose      *Decimal
+	MarketValue    *Decimal // last close * quantity
+	UnrealizedGain *Decimal // market value - total amount, before fees and taxes
+	GainPercent    *Decimal // unrealized gain / total amount, in percent
+}
+
+// NewValuations values the stocks of the inventory at their latest price.
+func NewValuations(inventory []*Transaction, latestPrices []*Price) []*Valuation {
+	priceByStockNo := map[string]*Price{}
+	for _, p := range latestPrices {
+		priceByStockNo[p.StockNo] = p
+	}
+
+	valuations := make([]*Valuation, len(inventory))
+	for i, t := range inventory {
+		valuations[i] = NewValuation(t, priceByStockNo[t.StockNo])
+	}
+	return valuations
+}
+
+// NewValuation values the stock of the inventory at the price, or not at all
+// if price is nil.
+func NewValuation(t *Transaction, price *Price) *Valuation {
+	v := &Valuation{Transaction: t}
+	if price == nil {
+		return v
+	}
+
+	lastClose := price.Close
+	marketValue := lastClose.MulInt(t.Quantity)
+	gain := marketValue.Sub(t.TotalAmount)
+	v.CloseDate = price.Date
+	v.LastClose = &lastClose
+	v.MarketValue = &marketValue
+	v.UnrealizedGain = &gain
+	if !t.TotalAmount.IsZero() {
+		percent := gain.MulInt(100).Div(t.TotalAmount).Round(2)
+		v.GainPercent = &percent
+	}
+
+	return v
+}
+
+// MarshalJSON adds the valuation to the JSON of the transaction, instead of
+// the one promoted from it.
+func (v *Valuation) MarshalJSON() ([]byte, error) {
+	data, err := v.Transaction.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	var fields map[string]json.RawMessage // keeps the numbers as they are
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, field := range fields {
+		m[k] = field
+	}
+	m["CloseDate"] = v.CloseDate
+	m["LastClose"] = v.LastClose
+	m["MarketValue"] = v.MarketValue
+	m["UnrealizedGain"] = v.UnrealizedGain
+	m["GainPercent"] = v.GainPercent
+
+	return json.Marshal(m)
+}
+
+// SumValuations sums up the total amount, and the market value and the
+// unrealized gain of the stocks with a price.
+func SumValuations(valuations []*Valuation) (totalAmount, marketValue, unrealizedGain Decimal) {
+	for _, v := range valuations {
+		totalAmount = totalAmount.Add(v.TotalAmount)
+		if v.MarketValue != nil {
+			marketValue = marketValue.Add(*v.MarketValue)
+			unrealizedGain = unrealizedGain.Add(*v.UnrealizedGain)
+		}
+	}
+	return totalAmount, marketValue, unrealizedGain
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewValuations(t *testing.T) {
+	inventory := []*Transaction{
+		{StockNo: "2330", Quantity: 1000, UnitPrice: NewDecimalFromInt(580), TotalAmount: NewDecimalFromInt(580000),
+			StockMapping: StockMapping{StockNo: "2330", StockName: "台積電"}},
+		{StockNo: "0050", Quantity: 3000, UnitPrice: MustParseDecimal("130.5"), TotalAmount: NewDecimalFromInt(391500)},
+	}
+	prices := []*Price{
+		{StockNo: "2330", Date: "2024-01-03", Close: MustParseDecimal("593.5")},
+	}
+
+	valuations := NewValuations(inventory, prices)
+
+	v := valuations[0]
+	if v.CloseDate != "2024-01-03" || v.LastClose.Cmp(MustParseDecimal("593.5")) != 0 ||
+		v.MarketValue.Cmp(NewDecimalFromInt(593500)) != 0 || v.UnrealizedGain.Cmp(NewDecimalFromInt(13500)) != 0 ||
+		v.GainPercent.Cmp(MustParseDecimal("2.33")) != 0 {
+		t.Errorf("valuation of 2330 = %s %v %v %v %v", v.CloseDate, v.LastClose, v.MarketValue, v.UnrealizedGain, v.GainPercent)
+	}
+	if v := valuations[1]; v.LastClose != nil || v.MarketValue != nil || v.UnrealizedGain != nil || v.GainPercent != nil {
+		t.Errorf("valuation of 0050 without a price = %+v, want no values", v)
+	}
+
+	totalAmount, marketValue, unrealizedGain := SumValuations(valuations)
+	if totalAmount.Cmp(NewDecimalFromInt(971500)) != 0 || marketValue.Cmp(NewDecimalFromInt(593500)) != 0 ||
+		unrealizedGain.Cmp(NewDecimalFromInt(13500)) != 0 {
+		t.Errorf("SumValuations() = %s, %s, %s", totalAmount, marketValue, unrealizedGain)
+	}
+
+	data, err := json.Marshal(valuations[0])
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got["StockName"] != "台積電" || got["TotalAmount"] != 580000.0 || got["MarketValue"] != 593500.0 || got["GainPercent"] != 2.33 {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+}
@@ -0,0 +1,73 @@
+package model
+
+// RealizedPnL is the realized profit and loss (已實現損益) of a closing trade
+// writing off a lot of the inventory. A closing trade writing off several
+// lots has a RealizedPnL for each of them.
+type RealizedPnL struct {
+	ID            int     `gorm:"column:id"`
+	StockNo       string  `gorm:"column:stockNo"`
+	BuyDate       string  `gorm:"column:buyDate"`
+	BuyTime       string  `gorm:"column:buyTime"`
+	BuyUnitPrice  Decimal `gorm:"column:buyUnitPrice"`
+	SellDate      string  `gorm:"column:sellDate"`
+	SellTime      string  `gorm:"column:sellTime"`
+	SellUnitPrice Decimal `gorm:"column:sellUnitPrice"`
+	Quantity      int     `gorm:"column:quantity"`
+	Proceeds      Decimal `gorm:"column:proceeds"` // sell unit price * quantity
+	Cost          Decimal `gorm:"column:cost"`     // buy unit price * quantity
+	Fee           int     `gorm:"column:fee"`      // of both the buy and the sell
+	Taxes         int     `gorm:"column:taxes"`
+	Gain          Decimal `gorm:"column:gain"` // proceeds - cost - fee - taxes
+}
+
+func (pnl *RealizedPnL) TableName() string {
+	return "tblRealizedPnL" // default table name
+}
+
+// NewRealizedPnL creates the realized profit and loss of writing off quantity
+// shares of lot by the closing transaction, after closed of its shares wrote
+// off other lots. Either of them can be the buy, a short position is closed
+// by a buy. The fee and taxes are the ones recorded on both, prorated to
+// quantity, see Transaction.ProratedFee, so the minimum fee is not charged
+// again on each lot written off.
+func NewRealizedPnL(lot, closing *Transaction, quantity, closed int) *RealizedPnL {
+	lotFee, lotTaxes := lot.ProratedFee(0, quantity)
+	closingFee, closingTaxes := closing.ProratedFee(closed, quantity)
+
+	buy, sell := lot, closing
+	if buy.TranType < 0 {
+		buy, sell = sell, buy
+	}
+
+	pnl := &RealizedPnL{
+		StockNo:       closing.StockNo,
+		BuyDate:       buy.Date,
+		BuyTime:       buy.Time,
+		BuyUnitPrice:  buy.UnitPrice,
+		SellDate:      sell.Date,
+		SellTime:      sell.Time,
+		SellUnitPrice: sell.UnitPrice,
+		Quantity:      quantity,
+		Proceeds:      sell.UnitPrice.MulInt(quantity),
+		Cost:          buy.UnitPrice.MulInt(quantity),
+		Fee:           lotFee + closingFee,
+		Taxes:         lotTaxes + closingTaxes,
+	}
+	pnl.Gain = pnl.Proceeds.Sub(pnl.Cost).Sub(NewDecimalFromInt(pnl.Fee + pnl.Taxes))
+
+	return pnl
+}
+
+// SumRealizedPnL sums the quantity, fee, taxes and gain of pnls.
+func SumRealizedPnL(pnls []*RealizedPnL) *RealizedPnL {
+	total := &RealizedPnL{}
+	for _, pnl := range pnls {
+		total.Quantity += pnl.Quantity
+		total.Proceeds = total.Proceeds.Add(pnl.Proceeds)
+		total.Cost = total.Cost.Add(pnl.Cost)
+		total.Fee += pnl.Fee
+		total.Taxes += pnl.Taxes
+		total.Gain = total.Gain.Add(pnl.Gain)
+	}
+	return total
+}
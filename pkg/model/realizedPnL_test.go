@@ -0,0 +1,104 @@
+package model
+
+import "testing"
+
+func TestNewRealizedPnL(t *testing.T) {
+	tests := []struct {
+		name         string
+		lot          *Transaction
+		closing      *Transaction
+		quantity     int
+		wantBuyDate  string
+		wantSellDate string
+		wantFee      int
+		wantTaxes    int
+		wantGain     string
+	}{
+		{
+			name:         "Partial write-off of a long lot",
+			lot:          NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, MustParseDecimal("500"), nil, nil),
+			closing:      NewTransactionFromInput("2024-01-05", "09:00:00", "2330", -1, 1000, MustParseDecimal("600"), nil, nil),
+			quantity:     400,
+			wantBuyDate:  "2024-01-02",
+			wantSellDate: "2024-01-05",
+			wantFee:      284 + 342, // 712 and 855 prorated
+			wantTaxes:    720,
+			wantGain:     "38654", // 240000 - 200000 - 626 - 720
+		},
+		{
+			name:         "Short lot closed by a buy",
+			lot:          NewTransactionFromInput("2024-01-02", "09:00:00", "2330", -1, 1000, MustParseDecimal("600"), nil, nil),
+			closing:      NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 1000, MustParseDecimal("500"), nil, nil),
+			quantity:     1000,
+			wantBuyDate:  "2024-01-03",
+			wantSellDate: "2024-01-02",
+			wantFee:      712 + 855,
+			wantTaxes:    1800,
+			wantGain:     "96633", // 600000 - 500000 - 1567 - 1800
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pnl := NewRealizedPnL(tt.lot, tt.closing, tt.quantity, 0)
+			if pnl.BuyDate != tt.wantBuyDate || pnl.SellDate != tt.wantSellDate {
+				t.Errorf("bought %s, sold %s, want %s, %s", pnl.BuyDate, pnl.SellDate, tt.wantBuyDate, tt.wantSellDate)
+			}
+			if pnl.Fee != tt.wantFee || pnl.Taxes != tt.wantTaxes {
+				t.Errorf("fee %d, taxes %d, want %d, %d", pnl.Fee, pnl.Taxes, tt.wantFee, tt.wantTaxes)
+			}
+			if pnl.Gain.Cmp(MustParseDecimal(tt.wantGain)) != 0 {
+				t.Errorf("gain %s, want %s", pnl.Gain, tt.wantGain)
+			}
+			if tt.lot.Quantity != 1000 || tt.closing.Quantity != 1000 {
+				t.Errorf("NewRealizedPnL() modified the transactions")
+			}
+		})
+	}
+}
+
+func TestNewRealizedPnLOfSeveralLots(t *testing.T) {
+	// The minimum fee of 20 is paid once by the sell, and by each lot
+	sell := NewTransactionFromInput("2024-01-05", "09:00:00", "2330", -1, 100, MustParseDecimal("50"), nil, nil)
+	lots := []*Transaction{
+		NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 40, MustParseDecimal("45"), nil, nil),
+		NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 60, MustParseDecimal("45"), nil, nil),
+	}
+	if sell.Fee != 20 || lots[0].Fee != 20 || lots[1].Fee != 20 {
+		t.Fatalf("fees = %d, %d, %d, want the minimum fee 20", sell.Fee, lots[0].Fee, lots[1].Fee)
+	}
+
+	var closed, fee, taxes int
+	for _, lot := range lots {
+		pnl := NewRealizedPnL(lot, sell, lot.Quantity, closed)
+		closed += lot.Quantity
+		fee += pnl.Fee
+		taxes += pnl.Taxes
+	}
+	if want := sell.Fee + lots[0].Fee + lots[1].Fee; fee != want {
+		t.Errorf("fee = %d, want %d, the fee of the sell once", fee, want)
+	}
+	if taxes != sell.Taxes {
+		t.Errorf("taxes = %d, want %d", taxes, sell.Taxes)
+	}
+}
+
+func TestTransactionWriteOff(t *testing.T) {
+	// A lot written off by several sells keeps its fee
+	lot := NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, MustParseDecimal("500"), nil, nil)
+	recorded := lot.Fee
+	var fee int
+	for _, quantity := range []int{300, 300} {
+		part := lot.Part(0, quantity)
+		if f, _ := lot.ProratedFee(0, quantity); part.Quantity != quantity || part.Fee != f {
+			t.Errorf("Part(%d) = %d shares, fee %d, want fee %d", quantity, part.Quantity, part.Fee, f)
+		}
+		fee += part.Fee
+		lot.WriteOff(quantity)
+	}
+	if lot.Quantity != 400 || lot.TotalAmount.Cmp(NewDecimalFromInt(200000)) != 0 {
+		t.Errorf("lot = %d shares, %s, want 400 shares, 200000", lot.Quantity, lot.TotalAmount)
+	}
+	if fee+lot.Fee != recorded {
+		t.Errorf("fee written off %d + kept %d, want %d", fee, lot.Fee, recorded)
+	}
+}
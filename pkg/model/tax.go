@@ -0,0 +1,135 @@
+package model
+
+import "strings"
+
+// InstrumentType decides which securities transaction tax (證交稅) rules apply.
+type InstrumentType string
+
+const (
+	InstrumentStock   InstrumentType = "stock"
+	InstrumentETF     InstrumentType = "etf"
+	InstrumentBondETF InstrumentType = "bondETF"
+)
+
+// InferInstrumentType guesses the instrument type from the TWSE numbering:
+// ETFs start with "00" and bond ETFs also end with "B", e.g. 00679B.
+func InferInstrumentType(stockNo string) InstrumentType {
+	switch {
+	case strings.HasPrefix(stockNo, "00") && strings.HasSuffix(stockNo, "B"):
+		return InstrumentBondETF
+	case strings.HasPrefix(stockNo, "00"):
+		return InstrumentETF
+	default:
+		return InstrumentStock
+	}
+}
+
+// TaxSchedule calculates the securities transaction tax of a transaction.
+type TaxSchedule interface {
+	Taxes(t *Transaction) int
+}
+
+// TaxRule is the tax rate of selling an instrument type within a period.
+// Buying is never taxed.
+type TaxRule struct {
+	InstrumentType InstrumentType
+	DayTrade       bool   // applies to day-trade sells (當沖) only
+	EffectiveFrom  string // inclusive, "2006-01-02", empty for no lower bound
+	EffectiveTo    string // inclusive, "2006-01-02", empty for no upper bound
+	Rate           Decimal
+}
+
+func (r *TaxRule) isEffective(date string) bool {
+	// Dates are "2006-01-02", comparing them as strings is chronological.
+	return (r.EffectiveFrom == "" || r.EffectiveFrom <= date) &&
+		(r.EffectiveTo == "" || date <= r.EffectiveTo)
+}
+
+// DefaultTaxRules returns the tax rules of TWSE.
+func DefaultTaxRules() []*TaxRule {
+	return []*TaxRule{
+		{InstrumentType: InstrumentStock, Rate: MustParseDecimal("0.003")},
+		// 現股當沖降稅, extended until the end of 2027.
+		{InstrumentType: InstrumentStock, DayTrade: true, EffectiveFrom: "2017-04-28", EffectiveTo: "2027-12-31", Rate: MustParseDecimal("0.0015")},
+		{InstrumentType: InstrumentETF, Rate: MustParseDecimal("0.001")},
+		{InstrumentType: InstrumentBondETF, Rate: MustParseDecimal("0.001")},
+		// 債券ETF停徵證交稅
+		{InstrumentType: InstrumentBondETF, EffectiveFrom: "2017-01-01", EffectiveTo: "2026-12-31", Rate: DecimalZero},
+	}
+}
+
+// TaxRuleEngine resolves the tax rule of a transaction by its instrument type
+// and date. When several rules apply, the one with the latest EffectiveFrom
+// wins; a day-trade sell falls back to the rules of a normal sell.
+type TaxRuleEngine struct {
+	Rules []*TaxRule
+
+	// InstrumentTypes maps stockNo to its instrument type, stocks missing from
+	// it are resolved by InferInstrumentType.
+	InstrumentTypes map[string]InstrumentType
+}
+
+// NewTaxRuleEngine creates a tax rule engine.
+func NewTaxRuleEngine(rules []*TaxRule, instrumentTypes map[string]InstrumentType) *TaxRuleEngine {
+	return &TaxRuleEngine{
+		Rules:           rules,
+		InstrumentTypes: instrumentTypes,
+	}
+}
+
+// DefaultTaxSchedule returns the TWSE rules with inferred instrument types.
+func DefaultTaxSchedule() *TaxRuleEngine {
+	return NewTaxRuleEngine(DefaultTaxRules(), nil)
+}
+
+// InstrumentType returns the instrument type of stockNo.
+func (e *TaxRuleEngine) InstrumentType(stockNo string) InstrumentType {
+	if instrumentType, ok := e.InstrumentTypes[stockNo]; ok && instrumentType != "" {
+		return instrumentType
+	}
+	return InferInstrumentType(stockNo)
+}
+
+// Rate returns the tax rate of selling an instrument type on date.
+func (e *TaxRuleEngine) Rate(instrumentType InstrumentType, dayTrade bool, date string) Decimal {
+	if dayTrade {
+		if rule := e.match(instrumentType, true, date); rule != nil {
+			return rule.Rate
+		}
+	}
+
+	if rule := e.match(instrumentType, false, date); rule != nil {
+		return rule.Rate
+	}
+
+	return DecimalZero
+}
+
+func (e *TaxRuleEngine) match(instrumentType InstrumentType, dayTrade bool, date string) *TaxRule {
+	var matched *TaxRule
+	for _, rule := range e.Rules {
+		if rule.InstrumentType != instrumentType || rule.DayTrade != dayTrade || !rule.isEffective(date) {
+			continue
+		}
+		if matched == nil || rule.EffectiveFrom > matched.EffectiveFrom {
+			matched = rule
+		}
+	}
+	return matched
+}
+
+// Taxes charges sells by the rate of their rule, rounded down to the dollar.
+func (e *TaxRuleEngine) Taxes(t *Transaction) int {
+	if t.TranType > 0 || t.TotalAmount.Sign() <= 0 {
+		return 0
+	}
+
+	instrumentType := t.StockMapping.InstrumentType
+	if instrumentType == "" {
+		instrumentType = e.InstrumentType(t.StockNo)
+	}
+
+	rate := e.Rate(instrumentType, t.DayTrade, t.Date)
+
+	return t.TotalAmount.Mul(rate).Floor()
+}
@@ -0,0 +1,38 @@
+package model
+
+import "testing"
+
+func TestTaxRuleEngine(t *testing.T) {
+	engine := NewTaxRuleEngine(DefaultTaxRules(), map[string]InstrumentType{
+		"2330":  InstrumentStock,
+		"00878": InstrumentETF,
+	})
+
+	tests := []struct {
+		name     string
+		date     string
+		stockNo  string
+		tranType int
+		dayTrade bool
+		want     int
+	}{
+		{name: "Buy", date: "2023-12-01", stockNo: "2330", tranType: 1, want: 0},
+		{name: "Stock sell", date: "2023-12-01", stockNo: "2330", tranType: -1, want: 300},
+		{name: "Stock day-trade sell", date: "2023-12-01", stockNo: "2330", tranType: -1, dayTrade: true, want: 150},
+		{name: "Stock day-trade sell before reduction", date: "2016-12-01", stockNo: "2330", tranType: -1, dayTrade: true, want: 300},
+		{name: "ETF sell", date: "2023-12-01", stockNo: "00878", tranType: -1, want: 100},
+		{name: "ETF day-trade sell", date: "2023-12-01", stockNo: "00878", tranType: -1, dayTrade: true, want: 100},
+		{name: "Inferred ETF sell", date: "2023-12-01", stockNo: "0050", tranType: -1, want: 100},
+		{name: "Bond ETF sell exempt", date: "2023-12-01", stockNo: "00679B", tranType: -1, want: 0},
+		{name: "Bond ETF sell after exemption", date: "2027-01-04", stockNo: "00679B", tranType: -1, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tran := NewTransactionFromInput(tt.date, "09:00:00", tt.stockNo, tt.tranType, 1000, NewDecimalFromInt(100), nil, engine)
+			tran.SetDayTrade(tt.dayTrade)
+			if tran.Taxes != tt.want {
+				t.Errorf("Taxes of %s on %s = %d, want %d", tt.stockNo, tt.date, tran.Taxes, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package model
 
 import (
 	"encoding/json"
-	"fmt"
 )
 
 // Transaction represents a record of a share transaction.
@@ -12,11 +11,23 @@ type TransactionRecord struct {
 	StockNo   string  `gorm:"column:stockNo"`
 	TranType  int     `gorm:"column:tranType"`
 	Quantity  int     `gorm:"column:quantity"`
-	UnitPrice float64 `gorm:"column:unitPrice"`
+	UnitPrice Decimal `gorm:"column:unitPrice"`
+
+	Source RecordSource `gorm:"column:source"` // 0 if not in the ledger
+
+	// AcquiredDate and AcquiredTime are the acquisition of the lot a buy of
+	// a capital reduction distributes the shares left of, dated on the
+	// distribution date; empty for the other records, see AcquiredAt.
+	AcquiredDate string `gorm:"column:acquiredDate"`
+	AcquiredTime string `gorm:"column:acquiredTime"`
+
+	// TimeGenerated marks a time generated by the importer, for a file
+	// without the time of the trades, see importer.Retime.
+	TimeGenerated bool `gorm:"-"`
 }
 
 // NewTransactionRecord creates a new transaction record object.
-func NewTransactionRecord(date, time, stockNo string, tranType, quantity int, unitPrice float64) *TransactionRecord {
+func NewTransactionRecord(date, time, stockNo string, tranType, quantity int, unitPrice Decimal) *TransactionRecord {
 	return &TransactionRecord{
 		Date:      date,
 		Time:      time,
@@ -31,35 +42,20 @@ func (tr *TransactionRecord) TableName() string {
 	return "tblTransactionRecordSys" // default table name
 }
 
-func SumQuantityUnitPrice(remainingTrs []*TransactionRecord) (int, float64) {
-	var totalQuantity, totalAmount int
+// SumQuantityUnitPrice sums the quantity of the records and averages their
+// unit price, weighted by quantity. The average is 0 if there is no quantity.
+func SumQuantityUnitPrice(remainingTrs []*TransactionRecord) (int, Decimal) {
+	var totalQuantity int
+	var totalAmount Decimal
 	for _, tr := range remainingTrs {
 		totalQuantity += tr.Quantity
-		totalAmount += int(float64(tr.Quantity) * tr.UnitPrice)
+		totalAmount = totalAmount.Add(tr.UnitPrice.MulInt(tr.Quantity))
 	}
-	avgUnitPrice := float64(totalAmount) / float64(totalQuantity)
-	return totalQuantity, avgUnitPrice
-}
-
-func CalcRemainingTransactionRecords(trs []*TransactionRecord) ([]*TransactionRecord, error) {
-	var remainingTrs []*TransactionRecord
-	for _, tr := range trs {
-		if tr.TranType > 0 {
-			remainingTrs = append(remainingTrs, tr)
-		} else {
-			qty := tr.Quantity
-			for qty > 0 && len(remainingTrs) > 0 {
-				var remove *TransactionRecord
-				remove, remainingTrs = remainingTrs[0], remainingTrs[1:]
-				qty -= remove.Quantity
-				if qty < 0 {
-					return nil, fmt.Errorf("error qty < 0")
-
-				}
-			}
-		}
+	if totalQuantity == 0 {
+		return 0, DecimalZero
 	}
-	return remainingTrs, nil
+	avgUnitPrice := totalAmount.DivInt(totalQuantity)
+	return totalQuantity, avgUnitPrice
 }
 
 // Transaction represents a share transaction.
@@ -70,16 +66,27 @@ type Transaction struct {
 	StockNo      string       `gorm:"column:stockNo"`
 	TranType     int          `gorm:"column:tranType"`
 	Quantity     int          `gorm:"column:quantity"`
-	UnitPrice    float64      `gorm:"column:unitPrice"`
-	TotalAmount  int          `gorm:"column:totalAmount"`
+	UnitPrice    Decimal      `gorm:"column:unitPrice"`
+	TotalAmount  Decimal      `gorm:"column:totalAmount"`
 	Taxes        int          `gorm:"column:taxes"`
+	Fee          int          `gorm:"column:fee"`
 	StockMapping StockMapping `gorm:"foreignKey:stockNo;references:stockNo"`
+
+	// DayTrade marks a sell of shares bought on the same day (當沖).
+	DayTrade bool `gorm:"-"`
+	// FeeSchedule calculates Fee, DefaultFeeSchedule is used if it is nil.
+	FeeSchedule FeeSchedule `gorm:"-"`
+	// TaxSchedule calculates Taxes, DefaultTaxSchedule is used if it is nil.
+	TaxSchedule TaxSchedule `gorm:"-"`
+	// LotIDs are the inventory lots a sell writes off, in order, by the
+	// specific lot cost basis.
+	LotIDs []int `gorm:"-"`
 }
 
 // NewTransactionFromDB creates a new Transaction object from database records.
 func NewTransactionFromDB(
 	id int, stockNo string, date string, quantity int, tranType int,
-	unitPrice float64, totalAmount int, taxes int) *Transaction {
+	unitPrice Decimal, totalAmount Decimal, taxes int, fee int) *Transaction {
 	return &Transaction{
 		ID:          id,
 		StockNo:     stockNo,
@@ -89,25 +96,29 @@ func NewTransactionFromDB(
 		UnitPrice:   unitPrice,
 		TotalAmount: totalAmount,
 		Taxes:       taxes,
+		Fee:         fee,
 	}
 }
 
 // NewTransactionFromInput creates a new Transaction object from input.
-// It initializes the transaction with inputs. Additionally, the total amount
-// and taxes are recalculated based on the new transaction details.
+// It initializes the transaction with inputs. Additionally, the total amount,
+// taxes and fee are recalculated based on the new transaction details. The
+// fee follows feeSchedule and the taxes follow taxSchedule, or their default
+// if nil.
 func NewTransactionFromInput(
 	date string, time string, stockNo string, tranType int, quantity int,
-	unitPrice float64) *Transaction {
+	unitPrice Decimal, feeSchedule FeeSchedule, taxSchedule TaxSchedule) *Transaction {
 	t := &Transaction{
-		Date:      date,
-		Time:      time,
-		StockNo:   stockNo,
-		TranType:  tranType,
-		Quantity:  quantity,
-		UnitPrice: unitPrice,
+		Date:        date,
+		Time:        time,
+		StockNo:     stockNo,
+		TranType:    tranType,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+		FeeSchedule: feeSchedule,
+		TaxSchedule: taxSchedule,
 	}
-	t.calculateTotalAmount()
-	t.calculateTaxes()
+	t.recalculate()
 	return t
 }
 
@@ -116,44 +127,102 @@ func (t *Transaction) TableName() string {
 }
 
 // calculateTotalAmount calculates the total amount based on transaction details.
+// It is exact, the rounding to the dollar only applies to the fee and taxes.
 func (t *Transaction) calculateTotalAmount() {
-	t.TotalAmount = int(float64(t.Quantity) * t.UnitPrice)
+	t.TotalAmount = t.UnitPrice.MulInt(t.Quantity)
 }
 
-// calculateTotalAmount calculates the taxes based on transaction details.
+// calculateTaxes calculates the taxes based on the tax schedule.
 func (t *Transaction) calculateTaxes() {
-	var taxRate float64 = 0.003
-	t.Taxes = int(float64(t.TotalAmount) * taxRate)
+	taxSchedule := t.TaxSchedule
+	if taxSchedule == nil {
+		taxSchedule = DefaultTaxSchedule()
+	}
+	t.Taxes = taxSchedule.Taxes(t)
+}
+
+// calculateFee calculates the broker commission based on the fee schedule.
+func (t *Transaction) calculateFee() {
+	feeSchedule := t.FeeSchedule
+	if feeSchedule == nil {
+		feeSchedule = DefaultFeeSchedule()
+	}
+	t.Fee = feeSchedule.Fee(t)
 }
 
 // SetUnitPrice updates the unit price of the transaction.
-// It recalculates the total amount and taxes based on the updated unit price.
-// The calculation of total amount and taxes are interdependent.
-func (t *Transaction) SetUnitPrice(unitPrice float64) {
+// It recalculates the total amount, taxes and fee based on the updated unit
+// price. The calculation of total amount, taxes and fee are interdependent.
+func (t *Transaction) SetUnitPrice(unitPrice Decimal) {
 	t.UnitPrice = unitPrice
 
 	t.recalculate()
 }
 
 // SetQuantity updates the quantity of the transaction.
-// It recalculates the total amount and taxes based on the quantity.
-// The calculation of total amount and taxes are interdependent.
+// It recalculates the total amount, taxes and fee based on the quantity.
+// The calculation of total amount, taxes and fee are interdependent.
 func (t *Transaction) SetQuantity(quantity int) {
 	t.Quantity = quantity
 
 	t.recalculate()
 }
 
-// recalculate total amount and taxes of the transaction.
-// It will recalculates the total amount and taxes based on the model.
+// ProratedFee returns the part of the fee and taxes recorded on the
+// transaction for quantity of its shares, after closed of them were written
+// off. The parts are rounded down and the rounding carried to the next one, so
+// the parts of all the shares add up to the fee and taxes recorded.
+func (t *Transaction) ProratedFee(closed, quantity int) (fee, taxes int) {
+	if t.Quantity == 0 {
+		return 0, 0
+	}
+	part := func(amount int) int {
+		return amount*(closed+quantity)/t.Quantity - amount*closed/t.Quantity
+	}
+	return part(t.Fee), part(t.Taxes)
+}
+
+// Part returns a copy of the transaction for quantity of its shares, after
+// closed of them, with the fee and taxes prorated to them, see ProratedFee.
+func (t *Transaction) Part(closed, quantity int) *Transaction {
+	part := *t
+	part.Quantity = quantity
+	part.Fee, part.Taxes = t.ProratedFee(closed, quantity)
+	part.calculateTotalAmount()
+	return &part
+}
+
+// WriteOff writes quantity shares off the lot. The rest keeps the fee and
+// taxes recorded less the ones prorated to the shares written off, see
+// ProratedFee, instead of recalculating them.
+func (t *Transaction) WriteOff(quantity int) {
+	fee, taxes := t.ProratedFee(0, quantity)
+	t.Quantity -= quantity
+	t.Fee -= fee
+	t.Taxes -= taxes
+	t.calculateTotalAmount()
+}
+
+// SetDayTrade marks the transaction as a day trade or not.
+// It recalculates the taxes, as a day-trade sell has a reduced tax rate.
+func (t *Transaction) SetDayTrade(dayTrade bool) {
+	t.DayTrade = dayTrade
+
+	t.recalculate()
+}
+
+// recalculate total amount, taxes and fee of the transaction.
+// It will recalculates the total amount, taxes and fee based on the model.
 func (t *Transaction) recalculate() {
 	t.calculateTotalAmount()
 	t.calculateTaxes()
+	t.calculateFee()
 }
 
 type StockMapping struct {
-	StockNo   string `gorm:"column:stockNo"`
-	StockName string `gorm:"column:stockName"`
+	StockNo        string         `gorm:"column:stockNo"`
+	StockName      string         `gorm:"column:stockName"`
+	InstrumentType InstrumentType `gorm:"column:instrumentType"`
 }
 
 func (sp *StockMapping) TableName() string {
@@ -191,6 +260,7 @@ func (t *Transaction) MarshalJSON() ([]byte, error) {
 	m["UnitPrice"] = t.UnitPrice
 	m["TotalAmount"] = t.TotalAmount
 	m["Taxes"] = t.Taxes
+	m["Fee"] = t.Fee
 
 	return json.Marshal(m)
 }
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// CashFlow is the cash paid, negative, or received, positive, by the
+// investor on a date.
+type CashFlow struct {
+	Date   string
+	Amount Decimal
+}
+
+// ErrNoXIRR is returned if the cash flows have no internal rate of return,
+// e.g. they are all payments.
+var ErrNoXIRR = errors.New("no internal rate of return")
+
+const (
+	xirrGuess         = 0.1
+	xirrTolerance     = 1e-10
+	xirrMaxIterations = 100
+)
+
+// XIRR returns the annual internal rate of return of the cash flows, the
+// rate r for which the sum of amount / (1 + r)^(days / 365) is 0, with the
+// days since the first flow, like XIRR of spreadsheets. It is solved by
+// Newton's method, or by bisection if that does not converge.
+func XIRR(flows []CashFlow) (float64, error) {
+	dates := make([]time.Time, len(flows))
+	amounts := make([]float64, len(flows))
+	var hasPayment, hasReceipt bool
+	for i, f := range flows {
+		date, err := time.Parse(time.DateOnly, f.Date)
+		if err != nil {
+			return 0, err
+		}
+		dates[i] = date
+		amounts[i] = f.Amount.Float64()
+		hasPayment = hasPayment || amounts[i] < 0
+		hasReceipt = hasReceipt || amounts[i] > 0
+	}
+	if !hasPayment || !hasReceipt {
+		return 0, ErrNoXIRR
+	}
+
+	first := dates[0]
+	for _, date := range dates {
+		if date.Before(first) {
+			first = date
+		}
+	}
+	years := make([]float64, len(flows))
+	for i, date := range dates {
+		years[i] = date.Sub(first).Hours() / 24 / 365
+	}
+
+	npv := func(rate float64) float64 {
+		var sum float64
+		for i, amount := range amounts {
+			sum += amount / math.Pow(1+rate, years[i])
+		}
+		return sum
+	}
+	derivative := func(rate float64) float64 {
+		var sum float64
+		for i, amount := range amounts {
+			sum -= years[i] * amount / math.Pow(1+rate, years[i]+1)
+		}
+		return sum
+	}
+
+	rate := xirrGuess
+	for i := 0; i < xirrMaxIterations; i++ {
+		d := derivative(rate)
+		if d == 0 || math.IsNaN(d) {
+			break
+		}
+		next := rate - npv(rate)/d
+		if next <= -1 || math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+		if math.Abs(next-rate) < xirrTolerance {
+			return next, nil
+		}
+		rate = next
+	}
+
+	return xirrBisection(npv)
+}
+
+// xirrBisection finds the root of npv between -100% and the first rate
+// where npv changes its sign, doubling up to 1e9%.
+func xirrBisection(npv func(float64) float64) (float64, error) {
+	low, high := -1+1e-9, 1.0
+	for npv(low)*npv(high) > 0 {
+		high *= 2
+		if high > 1e7 {
+			return 0, ErrNoXIRR
+		}
+	}
+
+	for i := 0; i < 1000 && high-low > xirrTolerance; i++ {
+		mid := (low + high) / 2
+		if npv(low)*npv(mid) <= 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+
+	return (low + high) / 2, nil
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestXIRR(t *testing.T) {
+	tests := []struct {
+		name    string
+		flows   []CashFlow
+		want    float64
+		wantErr error
+	}{
+		{
+			name: "a year at 10%",
+			flows: []CashFlow{
+				{"2023-01-01", NewDecimalFromInt(-1000)},
+				{"2024-01-01", NewDecimalFromInt(1100)},
+			},
+			want: 0.1,
+		},
+		{
+			// the example of XIRR in the spreadsheets
+			name: "irregular flows",
+			flows: []CashFlow{
+				{"2008-01-01", NewDecimalFromInt(-10000)},
+				{"2008-03-01", NewDecimalFromInt(2750)},
+				{"2008-10-30", NewDecimalFromInt(4250)},
+				{"2009-02-15", NewDecimalFromInt(3250)},
+				{"2009-04-01", NewDecimalFromInt(2750)},
+			},
+			want: 0.373362535,
+		},
+		{
+			name: "a loss",
+			flows: []CashFlow{
+				{"2023-01-01", NewDecimalFromInt(-1000)},
+				{"2023-07-02", NewDecimalFromInt(-1000)},
+				{"2024-01-01", NewDecimalFromInt(1500)},
+			},
+			want: -0.3226,
+		},
+		{
+			name: "a total loss",
+			flows: []CashFlow{
+				{"2023-01-01", NewDecimalFromInt(-1000)},
+				{"2024-01-01", MustParseDecimal("0.01")},
+			},
+			want: -0.99999,
+		},
+		{
+			name: "a day at 1% is far beyond 100% a year",
+			flows: []CashFlow{
+				{"2024-01-02", NewDecimalFromInt(-1000)},
+				{"2024-01-03", NewDecimalFromInt(1010)},
+			},
+			want: math.Pow(1.01, 365) - 1,
+		},
+		{
+			name: "the flows unordered",
+			flows: []CashFlow{
+				{"2024-01-01", NewDecimalFromInt(1100)},
+				{"2023-01-01", NewDecimalFromInt(-1000)},
+			},
+			want: 0.1,
+		},
+		{
+			name:    "payments only",
+			flows:   []CashFlow{{"2023-01-01", NewDecimalFromInt(-1000)}, {"2024-01-01", NewDecimalFromInt(-1000)}},
+			wantErr: ErrNoXIRR,
+		},
+		{
+			name:    "no flows",
+			wantErr: ErrNoXIRR,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := XIRR(tt.flows)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("XIRR() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("XIRR() error = %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-4*math.Max(1, math.Abs(tt.want)) {
+				t.Errorf("XIRR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package quote
+
+import (
+	"HermInvest/pkg/model"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileProvider reads the STOCK_DAY JSON of TWSE saved in a directory, a file
+// per month named like STOCK_DAY_2330_202401.json. A month without a file has
+// no prices. It stands in for HTTPProvider in tests and offline.
+type FileProvider struct {
+	Dir string
+}
+
+// NewFileProvider creates a provider of the STOCK_DAY files in dir.
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{Dir: dir}
+}
+
+// DailyPrices reads the files of the months between the dates from and to.
+func (p *FileProvider) DailyPrices(stockNo, from, to string) ([]*model.Price, error) {
+	firstDays, err := months(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []*model.Price
+	for _, firstDay := range firstDays {
+		path := filepath.Join(p.Dir, fmt.Sprintf("STOCK_DAY_%s_%s.json", stockNo, firstDay.Format("200601")))
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		monthPrices, err := parseStockDay(data, stockNo)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		prices = append(prices, monthPrices...)
+	}
+
+	return filterDates(prices, from, to), nil
+}
@@ -0,0 +1,138 @@
+package quote
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// stockDayPath is the path of STOCK_DAY under the base URL.
+const stockDayPath = "/rwd/zh/afterTrading/STOCK_DAY"
+
+// minRetryDelay is the delay of the first retry without an interval.
+const minRetryDelay = time.Second
+
+// HTTPProvider fetches the STOCK_DAY JSON of TWSE, a request per month. The
+// requests are apart by Interval, TWSE blocks more than about 3 requests in 5
+// seconds, and a request failed by the network or the server is retried
+// after Interval, at least minRetryDelay, doubled each retry.
+type HTTPProvider struct {
+	BaseURL  string // e.g. https://www.twse.com.tw, or a local stand-in server
+	Interval time.Duration
+	Retries  int
+	Client   *http.Client
+
+	lastRequest time.Time
+	sleep       func(time.Duration) // time.Sleep, replaced by tests
+}
+
+// NewHTTPProvider creates a provider of the STOCK_DAY under baseURL.
+func NewHTTPProvider(baseURL string, interval time.Duration, retries int) *HTTPProvider {
+	return &HTTPProvider{
+		BaseURL:  baseURL,
+		Interval: interval,
+		Retries:  retries,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// DailyPrices fetches the months between the dates from and to.
+func (p *HTTPProvider) DailyPrices(stockNo, from, to string) ([]*model.Price, error) {
+	firstDays, err := months(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []*model.Price
+	for _, firstDay := range firstDays {
+		data, err := p.fetchStockDay(stockNo, firstDay)
+		if err != nil {
+			return nil, err
+		}
+
+		monthPrices, err := parseStockDay(data, stockNo)
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", firstDay.Format("2006-01"), stockNo, err)
+		}
+		prices = append(prices, monthPrices...)
+	}
+
+	return filterDates(prices, from, to), nil
+}
+
+// fetchStockDay requests the STOCK_DAY of the month, retrying the failures
+// of the network and the server.
+func (p *HTTPProvider) fetchStockDay(stockNo string, firstDay time.Time) ([]byte, error) {
+	query := url.Values{}
+	query.Set("response", "json")
+	query.Set("date", firstDay.Format("20060102"))
+	query.Set("stockNo", stockNo)
+	u := p.BaseURL + stockDayPath + "?" + query.Encode()
+
+	delay := p.Interval
+	if delay < minRetryDelay {
+		delay = minRetryDelay
+	}
+	var err error
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		if attempt > 0 {
+			p.pause(delay)
+			delay *= 2
+		}
+
+		var data []byte
+		var retry bool
+		data, retry, err = p.get(u)
+		if err == nil {
+			return data, nil
+		}
+		if !retry {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("STOCK_DAY of %s: %w", firstDay.Format("2006-01"), err)
+}
+
+// get requests the URL, apart from the last request by Interval. It
+// reports whether a failed request is worth retrying.
+func (p *HTTPProvider) get(u string) ([]byte, bool, error) {
+	if wait := p.Interval - time.Since(p.lastRequest); wait > 0 {
+		p.pause(wait)
+	}
+	p.lastRequest = time.Now()
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return data, false, nil
+}
+
+// pause sleeps for d, or calls the sleep of tests.
+func (p *HTTPProvider) pause(d time.Duration) {
+	if p.sleep != nil {
+		p.sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
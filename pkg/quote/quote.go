@@ -0,0 +1,92 @@
+// Package quote provides the daily prices of the stocks from the market, to
+// fill the price store without downloading the files by hand.
+package quote
+
+import (
+	"HermInvest/pkg/importer"
+	"HermInvest/pkg/model"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuoteProvider provides the daily prices of a stock.
+type QuoteProvider interface {
+	// DailyPrices returns the prices of the stock on the days traded between
+	// the dates from and to, inclusive, ordered by date.
+	DailyPrices(stockNo, from, to string) ([]*model.Price, error)
+}
+
+// stockDayResponse is the daily trading of a stock in a month, the STOCK_DAY
+// JSON of TWSE, e.g.
+//
+//	{"stat": "OK", "title": "113年01月 2330 台積電 各日成交資訊",
+//	 "fields": ["日期", "成交股數", ...], "data": [["113/01/02", "26,059,058", ...]]}
+type stockDayResponse struct {
+	Stat   string     `json:"stat"`
+	Title  string     `json:"title"`
+	Fields []string   `json:"fields"`
+	Data   [][]string `json:"data"`
+}
+
+// stockDayStatOK is the stat of a response with data.
+const stockDayStatOK = "OK"
+
+// stockDayStatNoData is in the stat of a month without trades, e.g. before
+// the stock was listed: "很抱歉，沒有符合條件的資料!".
+const stockDayStatNoData = "沒有符合條件的資料"
+
+// parseStockDay parses the STOCK_DAY JSON into the prices of the stock. A
+// month without trades has no prices.
+func parseStockDay(data []byte, stockNo string) ([]*model.Price, error) {
+	var resp stockDayResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("parsing STOCK_DAY: %w", err)
+	}
+
+	if resp.Stat != stockDayStatOK {
+		if strings.Contains(resp.Stat, stockDayStatNoData) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("STOCK_DAY of %s: %s", stockNo, resp.Stat)
+	}
+
+	return importer.ParseStockDayRows(resp.Fields, resp.Data, stockNo)
+}
+
+// months returns the first day of the months between the dates from and to,
+// inclusive, the months of STOCK_DAY to request.
+func months(from, to string) ([]time.Time, error) {
+	fromDate, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%s': %w", from, err)
+	}
+	toDate, err := time.Parse(time.DateOnly, to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%s': %w", to, err)
+	}
+	if toDate.Before(fromDate) {
+		return nil, fmt.Errorf("date '%s' after '%s'", from, to)
+	}
+
+	var firstDays []time.Time
+	month := time.Date(fromDate.Year(), fromDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(toDate) {
+		firstDays = append(firstDays, month)
+		month = month.AddDate(0, 1, 0)
+	}
+
+	return firstDays, nil
+}
+
+// filterDates returns the prices between the dates from and to, inclusive.
+func filterDates(prices []*model.Price, from, to string) []*model.Price {
+	var filtered []*model.Price
+	for _, p := range prices {
+		if p.Date >= from && p.Date <= to {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,135 @@
+package quote
+
+import (
+	"HermInvest/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// wantDates checks the dates of the prices of 2330.
+func wantDates(t *testing.T, prices []*model.Price, dates ...string) {
+	t.Helper()
+
+	if len(prices) != len(dates) {
+		t.Fatalf("DailyPrices() = %d prices, want %d", len(prices), len(dates))
+	}
+	for i, p := range prices {
+		if p.StockNo != "2330" || p.Date != dates[i] {
+			t.Errorf("price %d = %s %s, want 2330 %s", i, p.StockNo, p.Date, dates[i])
+		}
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	p := NewFileProvider("testdata")
+
+	prices, err := p.DailyPrices("2330", "2024-01-03", "2024-03-31")
+	if err != nil {
+		t.Fatalf("DailyPrices() error = %v", err)
+	}
+	wantDates(t, prices, "2024-01-03", "2024-01-31", "2024-02-01", "2024-02-02")
+	if prices[0].Close.Cmp(model.NewDecimalFromInt(578)) != 0 || prices[0].Volume != 37106763 {
+		t.Errorf("price of 2024-01-03 = %+v, want the close 578", prices[0])
+	}
+
+	if _, err := p.DailyPrices("2330", "2024-02-01", "2024-01-01"); err == nil {
+		t.Errorf("DailyPrices() from after to succeeded, want an error")
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	var requests []string
+	failures := 1 // the first request fails
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("date"))
+		if r.URL.Path != stockDayPath || r.URL.Query().Get("stockNo") != "2330" {
+			http.NotFound(w, r)
+			return
+		}
+		if failures > 0 {
+			failures--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		month := r.URL.Query().Get("date")[:6]
+		data, err := os.ReadFile(filepath.Join("testdata", "STOCK_DAY_2330_"+month+".json"))
+		if err != nil {
+			w.Write([]byte(`{"stat":"很抱歉，沒有符合條件的資料!","total":0}`))
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	p := NewHTTPProvider(server.URL, 2*time.Second, 2)
+	p.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	prices, err := p.DailyPrices("2330", "2023-12-15", "2024-02-01")
+	if err != nil {
+		t.Fatalf("DailyPrices() error = %v", err)
+	}
+	wantDates(t, prices, "2024-01-02", "2024-01-03", "2024-01-31", "2024-02-01")
+
+	wantRequests := []string{"20231201", "20231201", "20240101", "20240201"}
+	if len(requests) != len(wantRequests) {
+		t.Fatalf("requests = %v, want %v", requests, wantRequests)
+	}
+	for i := range requests {
+		if requests[i] != wantRequests[i] {
+			t.Errorf("requests = %v, want %v", requests, wantRequests)
+			break
+		}
+	}
+
+	// The retry waits the interval, and each request waits for the interval
+	// since the last one
+	if len(sleeps) < 3 || sleeps[0] != 2*time.Second {
+		t.Errorf("sleeps = %v, want the retry delay then the waits between requests", sleeps)
+	}
+	for _, d := range sleeps[1:] {
+		if d <= 0 || d > 2*time.Second {
+			t.Errorf("sleeps = %v, want waits up to the interval", sleeps)
+		}
+	}
+}
+
+func TestHTTPProviderErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantRequests int
+	}{
+		{"server error retried", http.StatusInternalServerError, "", 3},
+		{"too many requests retried", http.StatusTooManyRequests, "", 3},
+		{"not found not retried", http.StatusNotFound, "", 1},
+		{"stat not OK", http.StatusOK, `{"stat":"查詢日期小於81年1月4日，請重新查詢!"}`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			p := NewHTTPProvider(server.URL, 0, 2)
+			p.sleep = func(time.Duration) {}
+
+			if _, err := p.DailyPrices("2330", "2024-01-01", "2024-01-31"); err == nil {
+				t.Errorf("DailyPrices() succeeded, want an error")
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -4,53 +4,130 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func GetDBConnection() *gorm.DB {
-	// TODO: extract DB connection to configuration
-	// TODO: TestCase check db file, if not exist, exit.
-	var dbPath = "./internal/app/database/dev-database.db"
+// Errors returned by GetDBConnection, test them with errors.Is.
+var (
+	ErrDBNotFound    = errors.New("database not found")
+	ErrNotSQLite     = errors.New("not a usable SQLite database")
+	ErrSchemaCorrupt = errors.New("database schema is corrupt")
+	ErrSchemaVersion = errors.New("database schema version mismatch")
+	ErrSchemaMigrate = errors.New("failed to migrate database schema")
+)
+
+// DBError describes why the database at Path can't be used. Kind is one of
+// the errors above, Err is the underlying cause.
+type DBError struct {
+	Path string
+	Kind error
+	Err  error
+}
+
+func (e *DBError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *DBError) Is(target error) bool {
+	return target == e.Kind
+}
 
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// GetDBConnection opens the SQLite database at dbPath and checks it is usable.
+// If the schema version of the database is behind the binary, it migrates the
+// database when autoMigrate is set, otherwise it refuses to connect.
+//
+// The returned error is a *DBError.
+func GetDBConnection(dbPath string, autoMigrate bool) (*gorm.DB, error) {
 	err := isFileExist(dbPath)
 	if err != nil {
-		fmt.Println("[Error] Datebase path is invalid:", err)
-		fmt.Println("\n* Please make sure the database file exists.")
-		os.Exit(1)
-	}
-
-	// Reference: https://gorm.io/docs/logger.html
-	// GORM defined log levels: Silent (default), Error, Warn, Info.
-	gormConfig := &gorm.Config{
-		// Logger: logger.Default.LogMode(logger.Silent),
-		Logger: logger.Default.LogMode(logger.Info),
+		return nil, &DBError{Path: dbPath, Kind: ErrDBNotFound, Err: err}
 	}
 
-	db, err := gorm.Open(sqlite.Open(dbPath), gormConfig)
+	db, err := gorm.Open(sqlite.Open(dbPath), gormConfig())
 	if err != nil {
-		fmt.Println("[Error] Failed to open database:", err)
-		os.Exit(1)
+		return nil, &DBError{Path: dbPath, Kind: ErrNotSQLite, Err: err}
 	}
 
 	// Reference: https://stackoverflow.com/questions/3888529/how-to-tell-if-sqlite-database-file-is-valid-or-not
 	err = isSQLiteFile(db)
 	if err != nil {
-		fmt.Println("[Error] Unable to use database:", err)
-		fmt.Printf("\n* The database path is: '%s'.\n", dbPath)
-		os.Exit(1)
+		return nil, &DBError{Path: dbPath, Kind: ErrNotSQLite, Err: err}
 	}
 
 	err = checkDBSchema(db)
 	if err != nil {
-		fmt.Println("[Error] Unable to ensure database schema integrity:", err)
-		fmt.Println("\n* Please check schema or consider rebuilding the database.")
-		os.Exit(1)
+		return nil, &DBError{Path: dbPath, Kind: ErrSchemaCorrupt, Err: err}
+	}
+
+	err = checkDBVersion(db)
+	if errors.Is(err, errSchemaBehind) && autoMigrate {
+		_, err = Migrate(db)
+		if err != nil {
+			return nil, &DBError{Path: dbPath, Kind: ErrSchemaMigrate, Err: err}
+		}
+	} else if err != nil {
+		return nil, &DBError{Path: dbPath, Kind: ErrSchemaVersion, Err: err}
+	}
+
+	return db, nil
+}
+
+// OpenExistingDB opens the SQLite database at dbPath without checking its
+// schema, so it can be inspected or rolled back. Unlike OpenDB it doesn't
+// create a missing file.
+//
+// The returned error is a *DBError.
+func OpenExistingDB(dbPath string) (*gorm.DB, error) {
+	err := isFileExist(dbPath)
+	if err != nil {
+		return nil, &DBError{Path: dbPath, Kind: ErrDBNotFound, Err: err}
+	}
+
+	db, err := gorm.Open(sqlite.Open(dbPath), gormConfig())
+	if err != nil {
+		return nil, &DBError{Path: dbPath, Kind: ErrNotSQLite, Err: err}
+	}
+
+	err = isSQLiteFile(db)
+	if err != nil {
+		return nil, &DBError{Path: dbPath, Kind: ErrNotSQLite, Err: err}
+	}
+
+	return db, nil
+}
+
+// OpenDB opens the SQLite database at dbPath without any check, creating the
+// file and its directory if needed. It is used to initialize and migrate the
+// database.
+func OpenDB(dbPath string) (*gorm.DB, error) {
+	err := os.MkdirAll(filepath.Dir(dbPath), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create database directory: %w", err)
 	}
 
-	return db
+	db, err := gorm.Open(sqlite.Open(dbPath), gormConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return db, nil
+}
+
+func gormConfig() *gorm.Config {
+	// Reference: https://gorm.io/docs/logger.html
+	// GORM defined log levels: Silent (default), Error, Warn, Info.
+	return &gorm.Config{
+		// Logger: logger.Default.LogMode(logger.Silent),
+		Logger: logger.Default.LogMode(logger.Info),
+	}
 }
 
 func isFileExist(path string) error {
@@ -97,3 +174,28 @@ func checkDBSchema(db *gorm.DB) error {
 
 	return nil
 }
+
+// errSchemaBehind tells the database can be fixed by migrating it.
+var errSchemaBehind = errors.New("database version is behind the binary")
+
+func checkDBVersion(db *gorm.DB) error {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		return fmt.Errorf("database version %d is newer than the binary (version %d)", current, latest)
+	}
+
+	if current < latest {
+		return fmt.Errorf("%w (database version %d, binary version %d)", errSchemaBehind, current, latest)
+	}
+
+	return nil
+}
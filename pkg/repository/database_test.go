@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetDBConnectionErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	textFile := filepath.Join(dir, "text.db")
+	if err := os.WriteFile(textFile, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyFile := filepath.Join(dir, "empty.db")
+	if err := os.WriteFile(emptyFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outdated := filepath.Join(dir, "outdated.db")
+	db, err := OpenDB(outdated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE tblLegacy (id INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		dbPath      string
+		autoMigrate bool
+		wantErr     error
+	}{
+		{name: "Not exist", dbPath: filepath.Join(dir, "missing.db"), wantErr: ErrDBNotFound},
+		{name: "Directory", dbPath: dir, wantErr: ErrDBNotFound},
+		{name: "Not SQLite", dbPath: textFile, wantErr: ErrNotSQLite},
+		{name: "Empty SQLite", dbPath: emptyFile, wantErr: ErrNotSQLite},
+		{name: "Outdated schema", dbPath: outdated, wantErr: ErrSchemaVersion},
+		{name: "Auto migrate", dbPath: outdated, autoMigrate: true, wantErr: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr == ErrDBNotFound || tt.wantErr == ErrNotSQLite {
+				_, err := OpenExistingDB(tt.dbPath)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("OpenExistingDB(%s) error = %v, want %v", tt.dbPath, err, tt.wantErr)
+				}
+			}
+
+			_, err := GetDBConnection(tt.dbPath, tt.autoMigrate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetDBConnection(%s) error = %v, want %v", tt.dbPath, err, tt.wantErr)
+			}
+
+			var dbErr *DBError
+			if tt.wantErr != nil && (!errors.As(err, &dbErr) || dbErr.Path != tt.dbPath) {
+				t.Errorf("GetDBConnection(%s) error = %#v, want *DBError with path", tt.dbPath, err)
+			}
+		})
+	}
+
+	// Opening a missing database doesn't create it
+	if _, err := os.Stat(filepath.Join(dir, "missing.db")); !os.IsNotExist(err) {
+		t.Errorf("missing.db exists after opening it, error = %v", err)
+	}
+}
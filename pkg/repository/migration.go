@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations are embedded SQL files named "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql". Versions are applied in ascending order and
+// must never be edited once released; add a new version instead.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+const migrationTable = "schema_migrations"
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum returns the checksum of the up step, used to detect migrations
+// edited after being applied.
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// appliedMigration is a row of the schema_migrations table.
+type appliedMigration struct {
+	Version   int    `gorm:"column:version"`
+	Name      string `gorm:"column:name"`
+	Checksum  string `gorm:"column:checksum"`
+	AppliedAt string `gorm:"column:appliedAt"`
+}
+
+func (am *appliedMigration) TableName() string {
+	return migrationTable
+}
+
+// MigrationStatus reports whether a migration is applied to the database.
+type MigrationStatus struct {
+	Migration *Migration
+	Applied   bool
+	AppliedAt string
+	// Modified is true if the applied checksum differs from the embedded one.
+	Modified bool
+}
+
+// LoadMigrations returns the embedded migrations ordered by version.
+func LoadMigrations() ([]*Migration, error) {
+	entries, err := migrationFS.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration '%s' must end with .up.sql or .down.sql", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("migration '%s' must be named <version>_<name>", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration '%s' has invalid version: %w", fileName, err)
+		}
+
+		content, err := migrationFS.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration '%s': %w", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration version %d has conflicting names '%s' and '%s'", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []*Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down steps", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// LatestVersion returns the schema version expected by this binary.
+func LatestVersion() (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// SchemaVersion returns the latest migration version applied to the
+// database, 0 if none is applied.
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(migrationTable) {
+		return 0, nil
+	}
+
+	var version int
+	err := db.Table(migrationTable).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to query schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Migrate applies every pending migration, each in its own transaction, and
+// returns the applied ones. It refuses to run if an applied migration was
+// modified afterwards.
+func Migrate(db *gorm.DB) ([]*Migration, error) {
+	err := ensureMigrationTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := QueryMigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+	for _, s := range statuses {
+		if s.Modified {
+			return applied, fmt.Errorf("migration %04d_%s was modified after being applied", s.Migration.Version, s.Migration.Name)
+		}
+		if s.Applied {
+			continue
+		}
+
+		m := s.Migration
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+
+			return tx.Create(&appliedMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				Checksum:  m.Checksum(),
+				AppliedAt: time.Now().Format(time.DateTime),
+			}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// RollbackPlan returns the migrations Rollback reverts, the latest applied
+// ones, at most steps of them, latest first.
+func RollbackPlan(db *gorm.DB, steps int) ([]*Migration, error) {
+	statuses, err := QueryMigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []*Migration
+	for i := len(statuses) - 1; i >= 0 && len(plan) < steps; i-- {
+		if statuses[i].Applied {
+			plan = append(plan, statuses[i].Migration)
+		}
+	}
+
+	return plan, nil
+}
+
+// Rollback reverts the latest applied migrations, at most steps of them,
+// and returns the reverted ones.
+func Rollback(db *gorm.DB, steps int) ([]*Migration, error) {
+	plan, err := RollbackPlan(db, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []*Migration
+	for _, m := range plan {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+
+			return tx.Delete(&appliedMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to roll back migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		reverted = append(reverted, m)
+	}
+
+	return reverted, nil
+}
+
+// QueryMigrationStatus returns the status of every embedded migration. It
+// fails if the database has applied a version unknown to this binary.
+func QueryMigrationStatus(db *gorm.DB) ([]*MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*appliedMigration
+	if db.Migrator().HasTable(migrationTable) {
+		if err := db.Order("version").Find(&applied).Error; err != nil {
+			return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+		}
+	}
+
+	appliedByVersion := map[int]*appliedMigration{}
+	for _, am := range applied {
+		appliedByVersion[am.Version] = am
+	}
+
+	var statuses []*MigrationStatus
+	for _, m := range migrations {
+		s := &MigrationStatus{Migration: m}
+		if am, ok := appliedByVersion[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = am.AppliedAt
+			s.Modified = am.Checksum != m.Checksum()
+			delete(appliedByVersion, m.Version)
+		}
+		statuses = append(statuses, s)
+	}
+
+	for version := range appliedByVersion {
+		return nil, fmt.Errorf("database has migration %d applied which is unknown to this binary", version)
+	}
+
+	return statuses, nil
+}
+
+func ensureMigrationTable(db *gorm.DB) error {
+	err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + migrationTable + ` (
+			version INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			appliedAt TEXT NOT NULL,
+			PRIMARY KEY(version)
+		)
+	`).Error
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", migrationTable, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateAndRollback(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+
+	applied, err := Migrate(db)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if len(applied) == 0 {
+		t.Fatalf("Migrate() applied nothing on an empty database")
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil || version != latest {
+		t.Fatalf("SchemaVersion() = %d, %v, want %d", version, err, latest)
+	}
+
+	applied, err = Migrate(db)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Migrate() twice = %d applied, %v, want 0 applied", len(applied), err)
+	}
+
+	reverted, err := Rollback(db, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != latest {
+		t.Fatalf("Rollback(1) = %v, %v, want version %d reverted", reverted, err, latest)
+	}
+
+	version, err = SchemaVersion(db)
+	if err != nil || version >= latest {
+		t.Fatalf("SchemaVersion() after rollback = %d, %v, want < %d", version, err, latest)
+	}
+}
+
+func TestMigrateRefusesModifiedMigration(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	err = db.Table(migrationTable).Where("version = ?", 1).Update("checksum", "tampered").Error
+	if err != nil {
+		t.Fatalf("failed to tamper checksum: %v", err)
+	}
+
+	if _, err := Migrate(db); err == nil {
+		t.Errorf("Migrate() error = nil, want error for modified migration")
+	}
+}
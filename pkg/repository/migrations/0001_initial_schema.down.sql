@@ -0,0 +1,10 @@
+DROP VIEW IF EXISTS "vvTransactionCash";
+DROP VIEW IF EXISTS "vvTransactionInventory";
+DROP TABLE IF EXISTS tblTransactionHistory;
+DROP TABLE IF EXISTS tblTransaction;
+DROP TABLE IF EXISTS tblStockMapping;
+DROP TABLE IF EXISTS "tblTransactionCash";
+DROP TABLE IF EXISTS tblDividend;
+DROP TABLE IF EXISTS tblCapitalReduction;
+DROP TABLE IF EXISTS "tblTransactionRecordSys";
+DROP TABLE IF EXISTS "tblTransactionRecord";
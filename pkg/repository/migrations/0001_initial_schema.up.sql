@@ -0,0 +1,108 @@
+-- Initial schema, formerly created by cmd/internal/createDBSchema.
+-- "IF NOT EXISTS" lets databases created before versioning adopt it.
+
+CREATE TABLE IF NOT EXISTS "tblTransactionRecord" (
+	"date"	TEXT NOT NULL,
+	"time"	TEXT NOT NULL,
+	"stockNo"	TEXT NOT NULL,
+	"stockName"	TEXT NOT NULL,
+	"tranType"	INTEGER NOT NULL,
+	"quantity"	INTEGER NOT NULL,
+	"unitPrice"	REAL NOT NULL,
+	"source"	INTEGER NOT NULL,
+	PRIMARY KEY("date","time")
+);
+
+CREATE TABLE IF NOT EXISTS "tblTransactionRecordSys" (
+	"date"	TEXT NOT NULL,
+	"time"	TEXT NOT NULL,
+	"stockNo"	TEXT NOT NULL,
+	"tranType"	INTEGER NOT NULL,
+	"quantity"	INTEGER NOT NULL,
+	"unitPrice"	REAL NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tblCapitalReduction (
+	YQ TEXT NOT NULL,
+	stockNo TEXT NOT NULL,
+	capitalReductionDate TEXT NOT NULL,
+	distributionDate TEXT NOT NULL,
+	cash REAL,
+	ratio REAL,
+	newStockNo TEXT
+);
+
+CREATE TABLE IF NOT EXISTS tblDividend (
+	YQ TEXT NOT NULL,
+	stockNo TEXT NOT NULL,
+	ExDividendDate TEXT NOT NULL,
+	distributionDate TEXT NOT NULL,
+	cashDividend REAL,
+	stockDividend REAL
+);
+
+CREATE TABLE IF NOT EXISTS "tblTransactionCash" (
+	"YQ" TEXT NOT NULL,
+	"stockNo"	TEXT NOT NULL,
+	"exDividendDate"	TEXT NOT NULL,
+	"distributionDate"	TEXT NOT NULL,
+	"cashDividend"	REAL NOT NULL,
+	"stockDividend"	REAL,
+	"quantity"	INTEGER NOT NULL,
+	"totalAmount"	INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tblStockMapping (
+	stockNo TEXT NOT NULL UNIQUE,
+	stockName TEXT NOT NULL,
+	PRIMARY KEY(stockNo)
+);
+
+CREATE TABLE IF NOT EXISTS tblTransaction (
+	id INTEGER,
+	date TEXT NOT NULL,
+	time TEXT NOT NULL,
+	stockNo TEXT NOT NULL,
+	tranType INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	unitPrice REAL NOT NULL,
+	totalAmount INTEGER NOT NULL,
+	taxes INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE IF NOT EXISTS tblTransactionHistory (
+	id INTEGER,
+	date TEXT NOT NULL,
+	time TEXT NOT NULL,
+	stockNo TEXT NOT NULL,
+	tranType INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	unitPrice REAL NOT NULL,
+	totalAmount INTEGER NOT NULL,
+	taxes INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE VIEW IF NOT EXISTS "vvTransactionInventory" AS
+SELECT
+	stockNo, stockName, tranType, sum(quantity),
+	sum(totalAmount)/sum(quantity) as avgUnitPrice,
+	sum(totalAmount), sum(taxes)
+FROM (
+	SELECT a.*, b.stockName
+	FROM tblTransaction	a
+	JOIN tblStockMapping b on a.stockNo = b.stockNo
+)
+GROUP by stockNo;
+
+CREATE VIEW IF NOT EXISTS "vvTransactionCash" AS
+SELECT
+	YQ, stockNo, stockName, distributionDate,
+	cashDividend, quantity, totalAmount
+FROM (
+	SELECT a.*, b.stockName
+	FROM tblTransactionCash	a
+	JOIN tblStockMapping b on a.stockNo = b.stockNo
+)
+ORDER BY stockNo, distributionDate;
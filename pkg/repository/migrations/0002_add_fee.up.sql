@@ -0,0 +1,18 @@
+-- Broker commission (手續費) of each transaction. Existing rows are left 0,
+-- rebuild the inventory to recalculate them.
+
+ALTER TABLE tblTransaction ADD COLUMN fee INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tblTransactionHistory ADD COLUMN fee INTEGER NOT NULL DEFAULT 0;
+
+DROP VIEW IF EXISTS "vvTransactionInventory";
+CREATE VIEW "vvTransactionInventory" AS
+SELECT
+	stockNo, stockName, tranType, sum(quantity),
+	sum(totalAmount)/sum(quantity) as avgUnitPrice,
+	sum(totalAmount), sum(taxes), sum(fee)
+FROM (
+	SELECT a.*, b.stockName
+	FROM tblTransaction	a
+	JOIN tblStockMapping b on a.stockNo = b.stockNo
+)
+GROUP by stockNo;
@@ -0,0 +1 @@
+ALTER TABLE tblStockMapping DROP COLUMN instrumentType;
@@ -0,0 +1,10 @@
+-- Instrument type of each stock, deciding its securities transaction tax.
+-- Existing stocks are guessed by the TWSE numbering, as the model does.
+
+ALTER TABLE tblStockMapping ADD COLUMN instrumentType TEXT NOT NULL DEFAULT 'stock';
+
+UPDATE tblStockMapping SET instrumentType = CASE
+	WHEN stockNo LIKE '00%B' THEN 'bondETF'
+	WHEN stockNo LIKE '00%' THEN 'etf'
+	ELSE 'stock'
+END;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idxRealizedPnLSellDate";
+DROP TABLE IF EXISTS "tblRealizedPnL";
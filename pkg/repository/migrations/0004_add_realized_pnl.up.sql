@@ -0,0 +1,23 @@
+-- Realized profit and loss (已實現損益) of each closing trade, one row per
+-- lot it writes off. Filled by write-offs, rebuild the inventory to fill it
+-- for existing trades.
+
+CREATE TABLE IF NOT EXISTS "tblRealizedPnL" (
+	"id"	INTEGER NOT NULL,
+	"stockNo"	TEXT NOT NULL,
+	"buyDate"	TEXT NOT NULL,
+	"buyTime"	TEXT NOT NULL,
+	"buyUnitPrice"	REAL NOT NULL,
+	"sellDate"	TEXT NOT NULL,
+	"sellTime"	TEXT NOT NULL,
+	"sellUnitPrice"	REAL NOT NULL,
+	"quantity"	INTEGER NOT NULL,
+	"proceeds"	REAL NOT NULL,
+	"cost"	REAL NOT NULL,
+	"fee"	INTEGER NOT NULL,
+	"taxes"	INTEGER NOT NULL,
+	"gain"	REAL NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE INDEX IF NOT EXISTS "idxRealizedPnLSellDate" ON "tblRealizedPnL" ("sellDate", "stockNo");
@@ -0,0 +1,11 @@
+-- Fingerprints of the rows imported by stock import, so that importing the
+-- same file again skips the rows already imported.
+
+CREATE TABLE IF NOT EXISTS "tblImportFingerprint" (
+	"fingerprint"	TEXT NOT NULL,
+	"date"	TEXT NOT NULL,
+	"time"	TEXT NOT NULL,
+	"stockNo"	TEXT NOT NULL,
+	"importedAt"	TEXT NOT NULL,
+	PRIMARY KEY("fingerprint")
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "idxTransactionRecordBatchId";
+ALTER TABLE tblTransactionRecord DROP COLUMN batchId;
+DROP INDEX IF EXISTS "idxImportBatchFileHash";
+DROP TABLE IF EXISTS "tblImportBatch";
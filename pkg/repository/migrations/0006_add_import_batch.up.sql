@@ -0,0 +1,19 @@
+-- Import batches, the files imported into the ledger. Each row of the ledger
+-- references the batch which imported it, NULL for the rows imported before
+-- batches or entered by hand, so a batch can be reverted as a whole.
+
+CREATE TABLE IF NOT EXISTS "tblImportBatch" (
+	"id"	INTEGER NOT NULL,
+	"fileName"	TEXT NOT NULL,
+	"fileHash"	TEXT NOT NULL,
+	"format"	TEXT NOT NULL,
+	"importedAt"	TEXT NOT NULL,
+	"rowCount"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE INDEX IF NOT EXISTS "idxImportBatchFileHash" ON "tblImportBatch" ("fileHash");
+
+ALTER TABLE tblTransactionRecord ADD COLUMN batchId INTEGER; -- tblImportBatch.id
+
+CREATE INDEX IF NOT EXISTS "idxTransactionRecordBatchId" ON "tblTransactionRecord" ("batchId");
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idxTransactionRecordSysSource";
+ALTER TABLE tblTransactionRecordSys DROP COLUMN source;
@@ -0,0 +1,19 @@
+-- Source of each rebuilt record: the source of its ledger row, or 5 for the
+-- records generated by the corporate actions, so the ledger can list them.
+
+ALTER TABLE tblTransactionRecordSys ADD COLUMN source INTEGER NOT NULL DEFAULT 5;
+
+UPDATE tblTransactionRecordSys SET source = (
+	SELECT r.source FROM tblTransactionRecord r
+	WHERE r.date = tblTransactionRecordSys.date
+		AND r.time = tblTransactionRecordSys.time
+		AND r.stockNo = tblTransactionRecordSys.stockNo
+)
+WHERE EXISTS (
+	SELECT 1 FROM tblTransactionRecord r
+	WHERE r.date = tblTransactionRecordSys.date
+		AND r.time = tblTransactionRecordSys.time
+		AND r.stockNo = tblTransactionRecordSys.stockNo
+);
+
+CREATE INDEX IF NOT EXISTS "idxTransactionRecordSysSource" ON "tblTransactionRecordSys" ("source");
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idxImportFingerprintBatchId";
+ALTER TABLE tblImportFingerprint DROP COLUMN batchId;
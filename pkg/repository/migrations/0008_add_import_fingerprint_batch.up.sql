@@ -0,0 +1,7 @@
+-- The rows imported by stock import are added to the ledger as an import
+-- batch. Each fingerprint references the batch of its row, NULL for the rows
+-- imported into the inventory only, so reverting the batch forgets them.
+
+ALTER TABLE tblImportFingerprint ADD COLUMN batchId INTEGER; -- tblImportBatch.id
+
+CREATE INDEX IF NOT EXISTS "idxImportFingerprintBatchId" ON "tblImportFingerprint" ("batchId");
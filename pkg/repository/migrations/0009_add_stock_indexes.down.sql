@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS "idxTransactionCashStockNo";
+DROP INDEX IF EXISTS "idxRealizedPnLStockNo";
+DROP INDEX IF EXISTS "idxTransactionHistoryStockNo";
+DROP INDEX IF EXISTS "idxTransactionStockNo";
+DROP INDEX IF EXISTS "idxTransactionRecordSysStockNo";
+DROP INDEX IF EXISTS "idxTransactionRecordStockNo";
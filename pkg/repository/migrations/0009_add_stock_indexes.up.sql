@@ -0,0 +1,9 @@
+-- A rebuild scoped by stock reads and replaces the rows of a stock from a
+-- date on, index them by stock and time.
+
+CREATE INDEX IF NOT EXISTS "idxTransactionRecordStockNo" ON "tblTransactionRecord" ("stockNo", "date", "time");
+CREATE INDEX IF NOT EXISTS "idxTransactionRecordSysStockNo" ON "tblTransactionRecordSys" ("stockNo", "date", "time");
+CREATE INDEX IF NOT EXISTS "idxTransactionStockNo" ON "tblTransaction" ("stockNo");
+CREATE INDEX IF NOT EXISTS "idxTransactionHistoryStockNo" ON "tblTransactionHistory" ("stockNo", "date", "time");
+CREATE INDEX IF NOT EXISTS "idxRealizedPnLStockNo" ON "tblRealizedPnL" ("stockNo", "sellDate", "sellTime");
+CREATE INDEX IF NOT EXISTS "idxTransactionCashStockNo" ON "tblTransactionCash" ("stockNo", "exDividendDate");
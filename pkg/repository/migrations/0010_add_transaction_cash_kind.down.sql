@@ -0,0 +1 @@
+ALTER TABLE tblTransactionCash DROP COLUMN kind;
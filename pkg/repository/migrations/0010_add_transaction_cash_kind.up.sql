@@ -0,0 +1,5 @@
+-- tblTransactionCash also keeps the cash refunded by the capital reductions,
+-- with the cash in lieu of the fractional shares: 0 for a cash dividend, 1
+-- for a capital reduction.
+
+ALTER TABLE tblTransactionCash ADD COLUMN kind INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- Daily quotes of the stocks, e.g. imported from the STOCK_DAY files of TWSE
+-- and TPEx, to value the inventory at the last close.
+
+CREATE TABLE IF NOT EXISTS "tblPrice" (
+	"stockNo"	TEXT NOT NULL,
+	"date"	TEXT NOT NULL,
+	"open"	REAL,
+	"high"	REAL,
+	"low"	REAL,
+	"close"	REAL NOT NULL,
+	"volume"	INTEGER, -- shares traded
+	PRIMARY KEY("stockNo","date")
+);
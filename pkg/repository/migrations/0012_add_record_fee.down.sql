@@ -0,0 +1,2 @@
+ALTER TABLE tblTransactionRecord DROP COLUMN taxes;
+ALTER TABLE tblTransactionRecord DROP COLUMN fee;
@@ -0,0 +1,6 @@
+-- Broker commission (手續費) and taxes paid on each trade of the ledger, as
+-- the inventory charged them, so the cash flows keep them when the schedules
+-- change. Existing rows are left 0, rebuild the inventory to record them.
+
+ALTER TABLE tblTransactionRecord ADD COLUMN fee INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tblTransactionRecord ADD COLUMN taxes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+ALTER TABLE tblTransactionRecord RENAME COLUMN fee TO feeRecorded;
+ALTER TABLE tblTransactionRecord RENAME COLUMN taxes TO taxesRecorded;
+ALTER TABLE tblTransactionRecord ADD COLUMN fee INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tblTransactionRecord ADD COLUMN taxes INTEGER NOT NULL DEFAULT 0;
+
+UPDATE tblTransactionRecord SET fee = COALESCE(feeRecorded, 0), taxes = COALESCE(taxesRecorded, 0);
+
+ALTER TABLE tblTransactionRecord DROP COLUMN feeRecorded;
+ALTER TABLE tblTransactionRecord DROP COLUMN taxesRecorded;
@@ -0,0 +1,14 @@
+-- The fee and taxes of a ledger row are NULL until the trade is added to the
+-- inventory, rather than 0, so a rebuild tells the ones recorded from the
+-- ones missing. The rows left 0 by 0012 are missing.
+
+ALTER TABLE tblTransactionRecord RENAME COLUMN fee TO feeRecorded;
+ALTER TABLE tblTransactionRecord RENAME COLUMN taxes TO taxesRecorded;
+ALTER TABLE tblTransactionRecord ADD COLUMN fee INTEGER;
+ALTER TABLE tblTransactionRecord ADD COLUMN taxes INTEGER;
+
+UPDATE tblTransactionRecord SET fee = feeRecorded, taxes = taxesRecorded
+WHERE feeRecorded <> 0 OR taxesRecorded <> 0;
+
+ALTER TABLE tblTransactionRecord DROP COLUMN feeRecorded;
+ALTER TABLE tblTransactionRecord DROP COLUMN taxesRecorded;
@@ -0,0 +1,2 @@
+ALTER TABLE tblTransactionRecord DROP COLUMN lots;
+ALTER TABLE tblTransactionRecord DROP COLUMN costBasis;
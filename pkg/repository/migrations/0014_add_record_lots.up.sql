@@ -0,0 +1,7 @@
+-- The cost basis method each trade of the ledger was added with, and the
+-- lots a sell of the specific lot method wrote off, by their acquisition
+-- time, so a rebuild writes off the same lots. Existing rows are left empty
+-- and replayed by the configured method.
+
+ALTER TABLE tblTransactionRecord ADD COLUMN costBasis TEXT NOT NULL DEFAULT '';
+ALTER TABLE tblTransactionRecord ADD COLUMN lots TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE tblTransactionRecordSys DROP COLUMN acquiredTime;
+ALTER TABLE tblTransactionRecordSys DROP COLUMN acquiredDate;
@@ -0,0 +1,6 @@
+-- The acquisition date and time of the lot a record of a capital reduction
+-- distributes the shares left of, so the lots written off first are the ones
+-- of the inventory. Existing rows are left empty until the next rebuild.
+
+ALTER TABLE tblTransactionRecordSys ADD COLUMN acquiredDate TEXT NOT NULL DEFAULT '';
+ALTER TABLE tblTransactionRecordSys ADD COLUMN acquiredTime TEXT NOT NULL DEFAULT '';
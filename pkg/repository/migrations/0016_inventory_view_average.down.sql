@@ -0,0 +1,12 @@
+DROP VIEW IF EXISTS "vvTransactionInventory";
+CREATE VIEW "vvTransactionInventory" AS
+SELECT
+	stockNo, stockName, tranType, sum(quantity),
+	sum(totalAmount)/sum(quantity) as avgUnitPrice,
+	sum(totalAmount), sum(taxes), sum(fee)
+FROM (
+	SELECT a.*, b.stockName
+	FROM tblTransaction	a
+	JOIN tblStockMapping b on a.stockNo = b.stockNo
+)
+GROUP by stockNo;
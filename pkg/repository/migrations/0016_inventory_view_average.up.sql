@@ -0,0 +1,15 @@
+-- The average unit price of the inventory, without truncating the division
+-- of the integer sums.
+
+DROP VIEW IF EXISTS "vvTransactionInventory";
+CREATE VIEW "vvTransactionInventory" AS
+SELECT
+	stockNo, stockName, tranType, sum(quantity),
+	CAST(sum(totalAmount) AS REAL)/sum(quantity) as avgUnitPrice,
+	sum(totalAmount), sum(taxes), sum(fee)
+FROM (
+	SELECT a.*, b.stockName
+	FROM tblTransaction	a
+	JOIN tblStockMapping b on a.stockNo = b.stockNo
+)
+GROUP by stockNo;
@@ -2,9 +2,11 @@ package repository
 
 import (
 	"HermInvest/pkg/model"
+	"errors"
 	"fmt"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type repository struct {
@@ -31,6 +33,20 @@ func (repo *repository) Rollback() *gorm.DB {
 	return repo.db.Rollback()
 }
 
+// translateError maps GORM errors to the domain errors of the model, so the
+// callers don't depend on GORM.
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.ErrNotFound
+	}
+
+	return err
+}
+
+// createBatchSize is the rows inserted by a statement of the bulk inserts,
+// well below the limit of the variables of a statement of SQLite.
+const createBatchSize = 500
+
 // echo "Transaction Table" | boxes -a c -s 80 -d cc
 
 /******************************************************************************
@@ -67,7 +83,7 @@ func (repo *repository) FindEarliestTransactionByStockNo(stockNo string) (*model
 	err := repo.db.Where("stockNo = ?", stockNo).
 		Order("date ASC, time ASC").First(&transaction).Error
 	if err != nil {
-		return &model.Transaction{}, err
+		return &model.Transaction{}, translateError(err)
 	}
 
 	return &transaction, nil
@@ -88,7 +104,7 @@ func (repo *repository) QueryTransactionByID(id int) (*model.Transaction, error)
 	var transaction *model.Transaction
 	err := repo.db.Take(&transaction, id).Error
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	return transaction, nil
 }
@@ -97,38 +113,53 @@ func (repo *repository) QueryTransactionByID(id int) (*model.Transaction, error)
 func (repo *repository) QueryTransactionByDetails(stockNo string, tranType int, date string) ([]*model.Transaction, error) {
 	var transactions []*model.Transaction
 
+	// Chain on a local query, or the conditions leak into later queries
+	query := repo.db
 	if stockNo != "" {
-		repo.db = repo.db.Where("stockNo = ?", stockNo)
+		query = query.Where("stockNo = ?", stockNo)
 	}
 	if tranType != 0 {
-		repo.db = repo.db.Where("tranType = ?", tranType)
+		query = query.Where("tranType = ?", tranType)
 	}
 	if date != "" {
-		repo.db = repo.db.Where("date = ?", date)
+		query = query.Where("date = ?", date)
 	}
 
-	err := repo.db.Find(&transactions).Error
+	err := query.Find(&transactions).Error
 	if err != nil {
 		return nil, err
 	}
 	return transactions, nil
 }
 
-// QueryTransactionInventory
+// QueryTransactionInventory sums up the lots of the inventory per stock,
+// ordered by stock number. The unit price is the average of the total amount
+// over the shares, summed up in Go rather than in SQL, where the division of
+// the integer sums would truncate it.
 func (repo *repository) QueryTransactionInventory() ([]*model.Transaction, error) {
-	var transactions []*model.Transaction
-
-	selectColumns := `stockNo, 
-	sum(quantity) AS quantity, 
-	sum(totalAmount)/sum(quantity) AS unitPrice, 
-	sum(totalAmount) AS totalAmount, 
-	sum(taxes) AS taxes`
-
-	err := repo.db.Preload("StockMapping").
-		Select(selectColumns).Group("stockNo").Find(&transactions).Error
+	var lots []*model.Transaction
+	err := repo.db.Preload("StockMapping").Order("stockNo").Order("id").Find(&lots).Error
 	if err != nil {
 		return nil, err
 	}
+
+	var transactions []*model.Transaction
+	for _, lot := range lots {
+		n := len(transactions)
+		if n == 0 || transactions[n-1].StockNo != lot.StockNo {
+			transactions = append(transactions, &model.Transaction{StockNo: lot.StockNo, StockMapping: lot.StockMapping})
+			n++
+		}
+		t := transactions[n-1]
+		t.Quantity += lot.Quantity
+		t.TotalAmount = t.TotalAmount.Add(lot.TotalAmount)
+		t.Taxes += lot.Taxes
+		t.Fee += lot.Fee
+	}
+	for _, t := range transactions {
+		t.UnitPrice = t.TotalAmount.DivInt(t.Quantity)
+	}
+
 	return transactions, nil
 }
 
@@ -155,7 +186,14 @@ func (repo *repository) UpdateTransaction(id int, t *model.Transaction) error {
 
 func (repo *repository) DeleteTransaction(id int) error {
 	result := repo.db.Delete(&model.Transaction{ID: id})
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
 }
 
 func (repo *repository) DeleteTransactions(ids []int) error {
@@ -163,6 +201,30 @@ func (repo *repository) DeleteTransactions(ids []int) error {
 	return result.Error
 }
 
+// DeleteStockInventory deletes the lots of the stock, and its history and
+// realized profit and loss of the sells after the date and time, or all of
+// them if date is empty.
+func (repo *repository) DeleteStockInventory(stockNo, date, time string) error {
+	err := repo.db.Where("stockNo = ?", stockNo).Delete(&model.Transaction{}).Error
+	if err != nil {
+		return err
+	}
+
+	history := repo.db.Table("tblTransactionHistory").Where("stockNo = ?", stockNo)
+	pnls := repo.db.Where("stockNo = ?", stockNo)
+	if date != "" {
+		history = history.Where("(date > ? OR (date = ? AND time > ?))", date, date, time)
+		pnls = pnls.Where("(sellDate > ? OR (sellDate = ? AND sellTime > ?))", date, date, time)
+	}
+
+	err = history.Delete(&model.Transaction{}).Error
+	if err != nil {
+		return err
+	}
+
+	return pnls.Delete(&model.RealizedPnL{}).Error
+}
+
 /******************************************************************************
  *                         Transaction History Table                          *
  ******************************************************************************/
@@ -181,6 +243,42 @@ func (repo *repository) CreateTransactionHistory(t *model.Transaction) (int, err
 	return t.ID, nil
 }
 
+/******************************************************************************
+ *                             Realized PnL Table                             *
+ ******************************************************************************/
+
+// CreateRealizedPnL
+func (repo *repository) CreateRealizedPnL(pnl *model.RealizedPnL) error {
+	if err := repo.db.Create(pnl).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// QueryRealizedPnL queries the realized profit and loss of the trades closed
+// between the dates from and to, inclusive. Empty conditions are ignored.
+func (repo *repository) QueryRealizedPnL(from, to, stockNo string) ([]*model.RealizedPnL, error) {
+	var pnls []*model.RealizedPnL
+
+	query := repo.db
+	if from != "" {
+		query = query.Where("sellDate >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("sellDate <= ?", to)
+	}
+	if stockNo != "" {
+		query = query.Where("stockNo = ?", stockNo)
+	}
+
+	err := query.Order("sellDate ASC, sellTime ASC, id ASC").Find(&pnls).Error
+	if err != nil {
+		return nil, err
+	}
+	return pnls, nil
+}
+
 /******************************************************************************
  *                                   Common                                   *
  ******************************************************************************/
@@ -194,6 +292,7 @@ func (repo *repository) DropTable(tablename string) error {
 		"tblTransactionHistory",
 		"tblTransactionCash",
 		"tblTransactionRecordSys",
+		"tblRealizedPnL",
 	}
 
 	// Check if the tablename is in the whitelist
@@ -219,6 +318,45 @@ func (repo *repository) DropTable(tablename string) error {
 	return nil
 }
 
+/******************************************************************************
+ *                            Stock Mapping Table                             *
+ ******************************************************************************/
+
+// QueryStockMappingAll
+func (repo *repository) QueryStockMappingAll() ([]*model.StockMapping, error) {
+	var stockMappings []*model.StockMapping
+	if err := repo.db.Find(&stockMappings).Error; err != nil {
+		return nil, err
+	}
+
+	return stockMappings, nil
+}
+
+// FindStockMapping returns model.ErrNotFound if the stock is not mapped.
+func (repo *repository) FindStockMapping(stockNo string) (*model.StockMapping, error) {
+	var sm model.StockMapping
+	err := repo.db.Where("stockNo = ?", stockNo).Take(&sm).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &sm, nil
+}
+
+// UpsertStockMapping inserts the stock, or updates its name if it exists.
+// The instrument type of an existing stock is kept.
+func (repo *repository) UpsertStockMapping(sm *model.StockMapping) error {
+	err := repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stockNo"}},
+		DoUpdates: clause.AssignmentColumns([]string{"stockName"}),
+	}).Create(sm).Error
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 /******************************************************************************
  *                          Capital Reduction Table                           *
  ******************************************************************************/
@@ -256,6 +394,26 @@ func (repo *repository) CreateTransactionRecordSys(tr *model.TransactionRecord)
 	return nil
 }
 
+// CreateTransactionRecordSysBatch inserts the records in batches.
+func (repo *repository) CreateTransactionRecordSysBatch(trs []*model.TransactionRecord) error {
+	if len(trs) == 0 {
+		return nil
+	}
+
+	return repo.db.CreateInBatches(trs, createBatchSize).Error
+}
+
+// DeleteTransactionRecordSys deletes the records of the stock on or after the
+// date from, or all of them if from is empty.
+func (repo *repository) DeleteTransactionRecordSys(stockNo, from string) error {
+	query := repo.db.Where("stockNo = ?", stockNo)
+	if from != "" {
+		query = query.Where("date >= ?", from)
+	}
+
+	return query.Delete(&model.TransactionRecord{}).Error
+}
+
 // CreateCashDividendRecord
 func (repo *repository) CreateCashDividendRecord(cd *model.ExDividend) error {
 	if err := repo.db.Table("tblTransactionCash").Create(cd).Error; err != nil {
@@ -265,93 +423,304 @@ func (repo *repository) CreateCashDividendRecord(cd *model.ExDividend) error {
 	return nil
 }
 
-// QueryTransactionRecordAll
-func (repo *repository) QueryTransactionRecordAll() ([]*model.TransactionRecord, error) {
-	var transactionRecords []*model.TransactionRecord
-	err := repo.db.Table("tblTransactionRecord").Find(&transactionRecords).Error
+// CreateCashDividendRecords inserts the cash dividends in batches.
+func (repo *repository) CreateCashDividendRecords(cds []*model.ExDividend) error {
+	if len(cds) == 0 {
+		return nil
+	}
+
+	return repo.db.Table("tblTransactionCash").CreateInBatches(cds, createBatchSize).Error
+}
+
+// DeleteCashDividendRecords deletes the cash dividends of the stock on or
+// after the ex-dividend date from, or all of them if from is empty.
+func (repo *repository) DeleteCashDividendRecords(stockNo, from string) error {
+	query := repo.db.Table("tblTransactionCash").Where("stockNo = ?", stockNo)
+	if from != "" {
+		query = query.Where("exDividendDate >= ?", from)
+	}
+
+	return query.Delete(&model.ExDividend{}).Error
+}
+
+// QueryCashDividendAll queries the cash dividends of tblTransactionCash.
+func (repo *repository) QueryCashDividendAll() ([]*model.ExDividend, error) {
+	var cashDividends []*model.ExDividend
+	err := repo.db.Table("tblTransactionCash").Order("exDividendDate").Find(&cashDividends).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return cashDividends, nil
+}
+
+// CreateLedgerEntry
+func (repo *repository) CreateLedgerEntry(le *model.LedgerEntry) error {
+	// The trades of the ledger are acquired at their own time
+	if err := repo.db.Omit("acquiredDate", "acquiredTime").Create(le).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateLedgerEntryFee records the fee and taxes of the trade of the stock on
+// the date and time in the ledger.
+func (repo *repository) UpdateLedgerEntryFee(date, time, stockNo string, fee, taxes int) error {
+	return repo.db.Model(&model.LedgerEntry{}).
+		Where("date = ? AND time = ? AND stockNo = ?", date, time, stockNo).
+		Updates(map[string]interface{}{"fee": fee, "taxes": taxes}).Error
+}
+
+// UpdateLedgerEntryLots records the cost basis method of the trade of the
+// stock on the date and time in the ledger, and the lots it wrote off.
+func (repo *repository) UpdateLedgerEntryLots(date, time, stockNo, costBasis, lots string) error {
+	return repo.db.Model(&model.LedgerEntry{}).
+		Where("date = ? AND time = ? AND stockNo = ?", date, time, stockNo).
+		Updates(map[string]interface{}{"costBasis": costBasis, "lots": lots}).Error
+}
+
+// UpdateLedgerEntryUnitPrice sets the unit price of the trade on the date
+// and time in the ledger, and clears its fee and taxes to be charged again.
+func (repo *repository) UpdateLedgerEntryUnitPrice(date, time string, unitPrice model.Decimal) error {
+	result := repo.db.Model(&model.LedgerEntry{}).
+		Where("date = ? AND time = ?", date, time).
+		Updates(map[string]interface{}{"unitPrice": unitPrice, "fee": nil, "taxes": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteLedgerEntry deletes the trade on the date and time from the ledger.
+func (repo *repository) DeleteLedgerEntry(date, time string) error {
+	result := repo.db.Where("date = ? AND time = ?", date, time).Delete(&model.LedgerEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// QueryLedger queries the ledger, tblTransactionRecord, merged with the
+// records generated by the corporate actions in tblTransactionRecordSys,
+// ordered by time. The records of the corporate actions are named by the
+// stock mapping. Empty conditions are ignored.
+func (repo *repository) QueryLedger(from, to, stockNo string) ([]*model.LedgerEntry, error) {
+	// Most ORMs don't support UNION, combine the queries built by GORM in raw
+	// SQL, see https://github.com/go-gorm/gorm/issues/3781
+	ledger := repo.db.Table("tblTransactionRecord").
+		Select("date, time, stockNo, stockName, tranType, quantity, unitPrice, source, " +
+			"'' AS acquiredDate, '' AS acquiredTime, batchId, fee, taxes, costBasis, lots")
+	corporateActions := repo.db.Table("tblTransactionRecordSys AS s").
+		Select("s.date, s.time, s.stockNo, COALESCE(m.stockName, 'N/A'), s.tranType, s.quantity, s.unitPrice, s.source, "+
+			"s.acquiredDate, s.acquiredTime, NULL, NULL, NULL, '', ''").
+		Joins("LEFT JOIN tblStockMapping AS m ON m.stockNo = s.stockNo").
+		Where("s.source IN ?", []model.RecordSource{model.SourceCorporateAction, model.SourceCapitalReduction})
+
+	if from != "" {
+		ledger = ledger.Where("date >= ?", from)
+		corporateActions = corporateActions.Where("s.date >= ?", from)
+	}
+	if to != "" {
+		ledger = ledger.Where("date <= ?", to)
+		corporateActions = corporateActions.Where("s.date <= ?", to)
+	}
+	if stockNo != "" {
+		ledger = ledger.Where("stockNo = ?", stockNo)
+		corporateActions = corporateActions.Where("s.stockNo = ?", stockNo)
+	}
 
+	var entries []*model.LedgerEntry
+	err := repo.db.Raw("? UNION ALL ? ORDER BY date, time", ledger, corporateActions).Scan(&entries).Error
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
-	return transactionRecords, nil
+	return entries, nil
 }
 
-// QueryTransactionRecordSysAll
-func (repo *repository) QueryTransactionRecordSysAll() ([]*model.TransactionRecord, error) {
-	var transactionRecords []*model.TransactionRecord
-	err := repo.db.Find(&transactionRecords).Error
+// QueryStockNoTradedFrom queries the stocks with an entry of the ledger or a
+// record on or after the date from, including the records of the entries
+// removed from the ledger since the last rebuild.
+func (repo *repository) QueryStockNoTradedFrom(from string) ([]string, error) {
+	ledger := repo.db.Table("tblTransactionRecord").Select("stockNo").Where("date >= ?", from)
+	records := repo.db.Table("tblTransactionRecordSys").Select("stockNo").Where("date >= ?", from)
 
+	var stockNos []string
+	err := repo.db.Raw("? UNION ? ORDER BY stockNo", ledger, records).Scan(&stockNos).Error
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
-	return transactionRecords, nil
+	return stockNos, nil
 }
 
 /******************************************************************************
- *                                    Note                                    *
+ *                             Import Batch Table                             *
  ******************************************************************************/
 
-// QueryUnionNote
-func (repo *repository) QueryUnionNote() {
-	// Most ORMs seem not support UNION keyword, due to its complexity.
-	// Faced with this situation, community suggest using "Raw" method to do this.
-	// > Reference:
-	// > * https://github.com/go-gorm/gorm/issues/3781
-	// > * https://stackoverflow.com/questions/67190972/how-to-use-mysql-union-all-on-gorm
-	// > * https://gorm.io/docs/sql_builder.html
+// CreateImportBatch: insert the batch and return inserted id
+func (repo *repository) CreateImportBatch(b *model.ImportBatch) (int, error) {
+	if err := repo.db.Create(b).Error; err != nil {
+		return 0, err
+	}
 
-	var transactionRecords []*model.TransactionRecord
+	return b.ID, nil
+}
 
-	// Method1: Use Raw SQL with scan to query
-	repo.db.Raw(`
-	SELECT date, time, stockNo, tranType, quantity, unitPrice
-	FROM tblTransactionRecord
-	UNION SELECT * FROM tblTransactionRecordSys
-	`).Scan(&transactionRecords)
+// QueryImportBatchAll
+func (repo *repository) QueryImportBatchAll() ([]*model.ImportBatch, error) {
+	var batches []*model.ImportBatch
+	err := repo.db.Order("id ASC").Find(&batches).Error
+	if err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
 
-	fmt.Println(transactionRecords[0], "\n\n---")
+// QueryImportBatchByID
+func (repo *repository) QueryImportBatchByID(id int) (*model.ImportBatch, error) {
+	var batch model.ImportBatch
+	err := repo.db.Take(&batch, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &batch, nil
+}
 
-	var transactionRecords2 []*model.TransactionRecord
-	// Method2: Combine GORM API build Raw SQL
-	repo.db.Raw("? UNION ?",
-		repo.db.Select("date, time, stockNo, tranType, quantity, unitPrice").Table("tblTransactionRecord"),
-		repo.db.Select("*").Table("tblTransactionRecordSys"),
-	).Scan(&transactionRecords2)
+// FindImportBatchByFileHash returns model.ErrNotFound if no file of the hash
+// has been imported.
+func (repo *repository) FindImportBatchByFileHash(fileHash string) (*model.ImportBatch, error) {
+	var batch model.ImportBatch
+	err := repo.db.Where("fileHash = ?", fileHash).Order("id ASC").First(&batch).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &batch, nil
+}
 
-	fmt.Println(transactionRecords2[0], "\n\n---")
+// DeleteImportBatch deletes the batch, and the ledger entries and the import
+// fingerprints of its rows.
+func (repo *repository) DeleteImportBatch(id int) error {
+	err := repo.db.Where("batchId = ?", id).Delete(&model.LedgerEntry{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = repo.db.Where("batchId = ?", id).Delete(&model.ImportFingerprint{}).Error
+	if err != nil {
+		return err
+	}
 
-	// ---
-	// Sometimes you would like to generate SQL without executing.
-	// The Debug function is not what you expect, you can do as below.
+	result := repo.db.Delete(&model.ImportBatch{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
 
-	// Method1: Use Raw SQL without scan
-	query := repo.db.Raw("SELECT * Error SQL Syntax")
+	return nil
+}
 
-	fmt.Println(query.Statement.SQL.String(), "\n\n---")
+/******************************************************************************
+ *                          Import Fingerprint Table                          *
+ ******************************************************************************/
 
-	// Method2: Use Raw SQL without scan
-	stmt := repo.db.Session(&gorm.Session{DryRun: true}).Select("*").
-		Table("Error SQL Syntax").Find(&model.TransactionRecord{}).Statement
+// CreateImportFingerprint
+func (repo *repository) CreateImportFingerprint(fp *model.ImportFingerprint) error {
+	if err := repo.db.Create(fp).Error; err != nil {
+		return err
+	}
 
-	fmt.Println(stmt.SQL.String())
-	fmt.Println(stmt.Vars, "\n\n---")
+	return nil
+}
 
-	// Method3: Use ToSQL
-	sql := repo.db.ToSQL(func(tx *gorm.DB) *gorm.DB {
-		return tx.Select("*").Table("Error SQL Syntax").Find(&model.TransactionRecord{})
-	})
+// FindImportFingerprint returns model.ErrNotFound if the row of the
+// fingerprint has not been imported.
+func (repo *repository) FindImportFingerprint(fingerprint string) (*model.ImportFingerprint, error) {
+	var fp model.ImportFingerprint
+	err := repo.db.Where("fingerprint = ?", fingerprint).Take(&fp).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
 
-	fmt.Println(sql)
+	return &fp, nil
 }
 
+/******************************************************************************
+ *                                Price Table                                 *
+ ******************************************************************************/
+
+// CreatePrices inserts the prices in batches, replacing the price of a stock
+// on a date already stored.
+func (repo *repository) CreatePrices(prices []*model.Price) error {
+	if len(prices) == 0 {
+		return nil
+	}
+
+	return repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stockNo"}, {Name: "date"}},
+		UpdateAll: true,
+	}).CreateInBatches(prices, createBatchSize).Error
+}
+
+// QueryLatestPriceAll queries the price of each stock on its latest date.
+func (repo *repository) QueryLatestPriceAll() ([]*model.Price, error) {
+	latest := repo.db.Table("tblPrice").Select("stockNo, MAX(date) AS date").Group("stockNo")
+
+	var prices []*model.Price
+	err := repo.db.Table("tblPrice AS p").Select("p.*").
+		Joins("JOIN (?) AS l ON l.stockNo = p.stockNo AND l.date = p.date", latest).
+		Order("p.stockNo").Find(&prices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// QueryPrices queries the prices between the dates from and to, inclusive,
+// of stockNo, ordered by date. Empty conditions are ignored.
+func (repo *repository) QueryPrices(from, to, stockNo string) ([]*model.Price, error) {
+	query := repo.db
+	if from != "" {
+		query = query.Where("date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("date <= ?", to)
+	}
+	if stockNo != "" {
+		query = query.Where("stockNo = ?", stockNo)
+	}
+
+	var prices []*model.Price
+	err := query.Order("date ASC, stockNo ASC").Find(&prices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+/******************************************************************************
+ *                                    Note                                    *
+ ******************************************************************************/
+
 // QueryTransactionRecordSys
 func (repo *repository) QueryTransactionPreload() ([]*model.Transaction, error) {
 	var transactions []*model.Transaction
 	err := repo.db.Preload("StockMapping").Take(&transactions).Error
 	if err != nil {
-		return nil, nil
+		return nil, translateError(err)
 	}
 
 	return transactions, nil
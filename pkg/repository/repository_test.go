@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"HermInvest/pkg/model"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueryTransactionInventory(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	repo := NewRepository(db)
+
+	if err := repo.UpsertStockMapping(&model.StockMapping{StockNo: "2330", StockName: "台積電"}); err != nil {
+		t.Fatalf("UpsertStockMapping() error = %v", err)
+	}
+	for _, lot := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 100, model.NewDecimalFromInt(10), nil, nil),
+		model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 50, model.MustParseDecimal("14.1"), nil, nil),
+		model.NewTransactionFromInput("2024-01-02", "09:00:10", "0050", 1, 1000, model.NewDecimalFromInt(100), nil, nil),
+	} {
+		if _, err := repo.CreateTransaction(lot); err != nil {
+			t.Fatalf("CreateTransaction() error = %v", err)
+		}
+	}
+
+	// 1705 over 150 shares, not truncated to 11
+	inventory, err := repo.QueryTransactionInventory()
+	if err != nil || len(inventory) != 2 {
+		t.Fatalf("QueryTransactionInventory() = %d stocks, %v, want 2", len(inventory), err)
+	}
+	if s := inventory[0]; s.StockNo != "0050" || s.Quantity != 1000 || s.UnitPrice.Cmp(model.NewDecimalFromInt(100)) != 0 {
+		t.Errorf("inventory[0] = %+v, want 1000 shares of 0050 at 100", s)
+	}
+	want := model.NewDecimalFromInt(1705).DivInt(150)
+	if s := inventory[1]; s.StockNo != "2330" || s.Quantity != 150 || s.TotalAmount.Cmp(model.NewDecimalFromInt(1705)) != 0 ||
+		s.UnitPrice.Cmp(want) != 0 || s.Fee != 40 || s.StockMapping.StockName != "台積電" {
+		t.Errorf("inventory[1] = %+v, want 150 shares of 2330 at %s, fee 40", s, want)
+	}
+
+	var avgUnitPrice float64
+	if err := db.Raw(`SELECT avgUnitPrice FROM vvTransactionInventory WHERE stockNo = '2330'`).Scan(&avgUnitPrice).Error; err != nil {
+		t.Fatalf("query vvTransactionInventory error = %v", err)
+	}
+	if avgUnitPrice < 11.366 || avgUnitPrice > 11.367 {
+		t.Errorf("vvTransactionInventory avgUnitPrice = %v, want 11.3667", avgUnitPrice)
+	}
+}
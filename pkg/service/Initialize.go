@@ -1,16 +1,44 @@
 package service
 
 import (
+	"HermInvest/pkg/config"
+	"HermInvest/pkg/model"
 	"HermInvest/pkg/repository"
 )
 
-func InitializeService() *service {
-	db := repository.GetDBConnection()
+// InitializeService connects to the database of cfg and builds the service.
+// The returned error is a *repository.DBError if the database is unusable.
+func InitializeService(cfg *config.Config) (*service, error) {
+	db, err := repository.GetDBConnection(cfg.DBPath, cfg.AutoMigrate)
+	if err != nil {
+		return nil, err
+	}
 
 	// init transactionRepository
 	repo := repository.NewRepository(db)
 
-	serv := NewService(repo)
+	feeSchedule := model.NewBrokerFeeSchedule(
+		model.NewDecimalFromFloat(cfg.Account.FeeRate),
+		model.NewDecimalFromFloat(cfg.Account.FeeDiscount),
+		cfg.Account.MinimumFee)
 
-	return serv
+	stockMappings, err := repo.QueryStockMappingAll()
+	if err != nil {
+		return nil, err
+	}
+
+	instrumentTypes := map[string]model.InstrumentType{}
+	for _, sm := range stockMappings {
+		instrumentTypes[sm.StockNo] = sm.InstrumentType
+	}
+	taxSchedule := model.NewTaxRuleEngine(model.DefaultTaxRules(), instrumentTypes)
+
+	lotMatcher, err := NewLotMatcher(cfg.CostBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	serv := NewService(repo, feeSchedule, taxSchedule, lotMatcher)
+
+	return serv, nil
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+)
+
+// QueryBenchmark compares the returns of the portfolio, or of stockNo, with
+// the ones of the benchmark, the stock benchmarkNo, invested with the same
+// cash flows, over the periods of QueryPerformance. The benchmark is valued
+// at its prices of tblPrice with its dividends of tblDividend reinvested, see
+// model.NewBenchmarkValues.
+func (serv *service) QueryBenchmark(benchmarkNo, from, to, stockNo string) ([]*model.BenchmarkComparison, error) {
+	days, err := serv.QueryPortfolioTimeSeries("", to, stockNo)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := performancePeriods(from, to, days)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := serv.cashFlows(periods[0].To, stockNo)
+	if err != nil {
+		return nil, err
+	}
+	benchmarkValues, err := serv.benchmarkValues(benchmarkNo, flows[stockNo], days)
+	if err != nil {
+		return nil, err
+	}
+	values := dailyValues(days, stockNo)
+
+	comparisons := make([]*model.BenchmarkComparison, len(periods))
+	for i, period := range periods {
+		comparisons[i] = &model.BenchmarkComparison{
+			Portfolio: model.NewPerformance(stockNo, period, values, flows[stockNo]),
+			Benchmark: model.NewPerformance(benchmarkNo, period, benchmarkValues, flows[stockNo]),
+		}
+	}
+
+	return comparisons, nil
+}
+
+// QueryBenchmarkTimeSeries values the benchmark, the stock benchmarkNo,
+// invested with the cash flows of the portfolio, or of stockNo, at the close
+// of each day of QueryPortfolioTimeSeries between the dates from and to.
+func (serv *service) QueryBenchmarkTimeSeries(benchmarkNo, from, to, stockNo string) ([]model.DailyValue, error) {
+	// The shares of from are bought by the flows before it
+	days, err := serv.QueryPortfolioTimeSeries("", to, stockNo)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := serv.cashFlows(to, stockNo)
+	if err != nil {
+		return nil, err
+	}
+	values, err := serv.benchmarkValues(benchmarkNo, flows[stockNo], days)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range values {
+		if v.Date >= from {
+			return values[i:], nil
+		}
+	}
+	return nil, nil
+}
+
+// benchmarkValues values the benchmark invested with the flows at the close
+// of each of the days.
+func (serv *service) benchmarkValues(benchmarkNo string, flows []model.CashFlow, days []*model.PortfolioDay) ([]model.DailyValue, error) {
+	dates := make([]string, len(days))
+	for i, d := range days {
+		dates[i] = d.Date
+	}
+
+	var to string
+	if len(dates) > 0 {
+		to = dates[len(dates)-1]
+	}
+	prices, err := serv.repo.QueryPrices("", to, benchmarkNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying prices: %v", err)
+	}
+
+	exDividends, err := serv.repo.QueryDividendAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying dividends: %v", err)
+	}
+	var dividends []*model.ExDividend
+	for _, ed := range exDividends {
+		if ed.StockNo == benchmarkNo {
+			dividends = append(dividends, ed)
+		}
+	}
+
+	values, err := model.NewBenchmarkValues(flows, prices, dividends, dates)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark %s: %w", benchmarkNo, err)
+	}
+	return values, nil
+}
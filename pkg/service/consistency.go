@@ -0,0 +1,63 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+)
+
+// Inconsistency is a row of the database left by an over-sell: a short lot
+// in the inventory, or a record selling more than held when replayed.
+type Inconsistency struct {
+	Table string
+	ID    int // inventory ID, 0 for a record
+	*model.OversellError
+}
+
+// CheckConsistency reports the over-sells in the database. It checks the
+// inventory for short lots and replays the ledger, including the records
+// generated by the corporate actions.
+func (serv *service) CheckConsistency() ([]*Inconsistency, error) {
+	var inconsistencies []*Inconsistency
+
+	transactions, err := serv.repo.QueryTransactionAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+
+	for _, t := range transactions {
+		if t.TranType < 0 {
+			inconsistencies = append(inconsistencies, &Inconsistency{
+				Table: "tblTransaction",
+				ID:    t.ID,
+				OversellError: &model.OversellError{
+					StockNo: t.StockNo, Date: t.Date, Time: t.Time, Held: 0, Requested: t.Quantity},
+			})
+		}
+	}
+
+	ledger, err := serv.repo.QueryLedger("", "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying ledger: %v", err)
+	}
+	trs := ledgerRecords(ledger, true)
+
+	// The net position of each stock, negative when short
+	positions := map[string]int{}
+	for _, tr := range trs {
+		position := positions[tr.StockNo]
+		if tr.TranType < 0 && tr.Quantity > position {
+			held := position
+			if held < 0 {
+				held = 0
+			}
+			inconsistencies = append(inconsistencies, &Inconsistency{
+				Table: "tblTransactionRecord",
+				OversellError: &model.OversellError{
+					StockNo: tr.StockNo, Date: tr.Date, Time: tr.Time, Held: held, Requested: tr.Quantity},
+			})
+		}
+		positions[tr.StockNo] = position + tr.TranType*tr.Quantity
+	}
+
+	return inconsistencies, nil
+}
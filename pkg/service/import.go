@@ -0,0 +1,279 @@
+package service
+
+import (
+	"HermInvest/pkg/importer"
+	"HermInvest/pkg/model"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ImportReport is the result of importing transactions into the ledger and
+// the inventory.
+type ImportReport struct {
+	Added        []*model.TransactionRecord // the records added to the ledger
+	Skipped      []*model.TransactionRecord // the records imported before
+	Transactions []*model.Transaction       // the lots modified by the added records
+	Changes      []*InventoryChange         // of the stocks traded
+	Rebuilt      bool                       // the inventory was rebuilt from the ledger
+	DryRun       bool
+}
+
+// InventoryChange is the shares and cost of a stock in the inventory before
+// and after an import. Short positions have negative shares.
+type InventoryChange struct {
+	StockNo        string
+	QuantityBefore int
+	QuantityAfter  int
+	CostBefore     model.Decimal
+	CostAfter      model.Decimal
+}
+
+// ImportTransactions adds the records to the ledger as the import batch, of
+// model.SourceCLI, and to the inventory, all or nothing. The records imported
+// before, by their fingerprint, are skipped, and no batch is created if all
+// of them are. A record before the last entry of its stock in the ledger, or
+// before one of its corporate actions, rebuilds the records and the inventory
+// of the stocks imported from the ledger instead, from their earliest record.
+// The records timed by the importer are timed after the entries of the
+// ledger on their date, their fingerprints are the ones of the file. A dry
+// run reports the same without changing the database.
+func (serv *service) ImportTransactions(batch *model.ImportBatch, trs []*model.TransactionRecord, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun}
+
+	tx := serv.repo.Begin()
+	s := serv.WithTrx(tx)
+
+	before, err := s.summarizeInventory()
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+
+	type row struct {
+		tr *model.TransactionRecord
+		fp *model.ImportFingerprint
+	}
+	var rows []row
+	fps := model.NewImportFingerprints(trs, batch.ImportedAt)
+	for i, tr := range trs {
+		_, err := s.repo.FindImportFingerprint(fps[i].Fingerprint)
+		if err == nil {
+			report.Skipped = append(report.Skipped, tr)
+			continue
+		}
+		if !errors.Is(err, model.ErrNotFound) {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to querying import fingerprint: %v", err)
+		}
+		rows = append(rows, row{tr: tr, fp: fps[i]})
+		report.Added = append(report.Added, tr)
+	}
+	if len(rows) == 0 {
+		serv.repo.WithTrx(tx).Rollback()
+		return report, nil
+	}
+
+	err = s.retimeImported(report.Added)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, err
+	}
+	for _, r := range rows {
+		r.fp.Time = r.tr.Time
+	}
+
+	// The inventory is added to in the order of the ledger
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].tr.Date != rows[j].tr.Date {
+			return rows[i].tr.Date < rows[j].tr.Date
+		}
+		return rows[i].tr.Time < rows[j].tr.Time
+	})
+
+	// Checked before the ledger changes, by the earliest record of each stock
+	earliest := map[string]string{}
+	for _, r := range rows {
+		if _, ok := earliest[r.tr.StockNo]; ok {
+			continue
+		}
+		earliest[r.tr.StockNo] = r.tr.Date
+
+		backdated, err := s.isBackdated(r.tr.StockNo, r.tr.Date, r.tr.Time)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, err
+		}
+		report.Rebuilt = report.Rebuilt || backdated
+	}
+
+	batch.RowCount = len(rows)
+	batchID, err := s.repo.CreateImportBatch(batch)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to creating import batch: %v", err)
+	}
+
+	for _, r := range rows {
+		tr := r.tr
+		err := s.addLedgerEntry(tr, model.SourceCLI, &batchID)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to import %s %s of %s: %w", tr.Date, tr.Time, tr.StockNo, err)
+		}
+
+		r.fp.BatchID = &batchID
+		err = s.repo.CreateImportFingerprint(r.fp)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to creating import fingerprint: %v", err)
+		}
+
+		if report.Rebuilt {
+			continue
+		}
+
+		newTransaction := model.NewTransactionFromInput(
+			tr.Date, tr.Time, tr.StockNo, tr.TranType, tr.Quantity, tr.UnitPrice, serv.feeSchedule, serv.taxSchedule)
+		t, err := s.addTransaction(newTransaction)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to import %s %s of %s: %w", tr.Date, tr.Time, tr.StockNo, err)
+		}
+		if t != nil {
+			report.Transactions = appendLot(report.Transactions, t)
+		}
+	}
+
+	if report.Rebuilt {
+		stockNos := make([]string, 0, len(earliest))
+		for stockNo := range earliest {
+			stockNos = append(stockNos, stockNo)
+		}
+		sort.Strings(stockNos)
+
+		// None of the records were added to the inventory, each stock is
+		// rebuilt from its earliest record
+		for _, stockNo := range stockNos {
+			_, err = s.rebuildStock("", stockNo, earliest[stockNo])
+			if err != nil {
+				serv.repo.WithTrx(tx).Rollback()
+				return nil, fmt.Errorf("failed to rebuilding %s: %w", stockNo, err)
+			}
+		}
+
+		for _, stockNo := range stockNos {
+			lots, err := s.repo.QueryTransactionByDetails(stockNo, 0, "")
+			if err != nil {
+				serv.repo.WithTrx(tx).Rollback()
+				return nil, fmt.Errorf("failed to querying inventory: %v", err)
+			}
+			report.Transactions = append(report.Transactions, lots...)
+		}
+	}
+
+	after, err := s.summarizeInventory()
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+	report.Changes = diffInventory(before, after, report.Added)
+
+	if dryRun {
+		serv.repo.WithTrx(tx).Rollback()
+	} else {
+		serv.repo.WithTrx(tx).Commit()
+	}
+
+	return report, nil
+}
+
+// retimeImported times the records timed by the importer after the latest
+// entry of the ledger on their date, see importer.Retime.
+func (serv *service) retimeImported(trs []*model.TransactionRecord) error {
+	latest := map[string]string{}
+	queried := map[string]bool{}
+	for _, tr := range trs {
+		if !tr.TimeGenerated || queried[tr.Date] {
+			continue
+		}
+		queried[tr.Date] = true
+
+		entries, err := serv.repo.QueryLedger(tr.Date, tr.Date, "")
+		if err != nil {
+			return fmt.Errorf("failed to querying ledger: %v", err)
+		}
+		for _, e := range entries {
+			if !e.Source.IsCorporateAction() && e.Time > latest[tr.Date] {
+				latest[tr.Date] = e.Time
+			}
+		}
+	}
+
+	err := importer.Retime(trs, latest)
+	if err != nil {
+		return fmt.Errorf("failed to timing records: %v", err)
+	}
+
+	return nil
+}
+
+// appendLot appends the lot, or replaces its earlier state.
+func appendLot(lots []*model.Transaction, lot *model.Transaction) []*model.Transaction {
+	for i, l := range lots {
+		if l.ID == lot.ID {
+			lots[i] = lot
+			return lots
+		}
+	}
+	return append(lots, lot)
+}
+
+// inventorySummary is the shares and cost of a stock in the inventory.
+type inventorySummary struct {
+	quantity int
+	cost     model.Decimal
+}
+
+// summarizeInventory sums up the lots of each stock in the inventory.
+func (serv *service) summarizeInventory() (map[string]inventorySummary, error) {
+	transactions, err := serv.repo.QueryTransactionAll()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := map[string]inventorySummary{}
+	for _, t := range transactions {
+		summary := summaries[t.StockNo]
+		summary.quantity += t.TranType * t.Quantity
+		summary.cost = summary.cost.Add(t.TotalAmount)
+		summaries[t.StockNo] = summary
+	}
+
+	return summaries, nil
+}
+
+// diffInventory returns the changes of the stocks of the records, ordered
+// by stock number.
+func diffInventory(before, after map[string]inventorySummary, trs []*model.TransactionRecord) []*InventoryChange {
+	stockNos := map[string]bool{}
+	for _, tr := range trs {
+		stockNos[tr.StockNo] = true
+	}
+
+	var changes []*InventoryChange
+	for stockNo := range stockNos {
+		changes = append(changes, &InventoryChange{
+			StockNo:        stockNo,
+			QuantityBefore: before[stockNo].quantity,
+			QuantityAfter:  after[stockNo].quantity,
+			CostBefore:     before[stockNo].cost,
+			CostAfter:      after[stockNo].cost,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].StockNo < changes[j].StockNo
+	})
+
+	return changes
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"HermInvest/pkg/config"
+	"HermInvest/pkg/model"
+	"fmt"
+	"sort"
+)
+
+// LotMatcher is a cost basis method. It decides which lots a sell writes off
+// first, and so the cost of the shares sold.
+type LotMatcher interface {
+	// Match returns the lots in the order a sell writes them off. lotIDs are
+	// the lots referenced by the sell, if any. Match may reprice the lots,
+	// e.g. to their moving average, the caller persists the new prices.
+	Match(lots []model.Lot, lotIDs []int) ([]model.Lot, error)
+	// Method returns the cost basis method of config, e.g.
+	// config.CostBasisFIFO, recorded on the ledger entries it matches.
+	Method() string
+}
+
+// NewLotMatcher returns the LotMatcher of a cost basis method of config,
+// e.g. config.CostBasisFIFO.
+func NewLotMatcher(method string) (LotMatcher, error) {
+	switch method {
+	case config.CostBasisFIFO:
+		return fifoMatcher{}, nil
+	case config.CostBasisLIFO:
+		return lifoMatcher{}, nil
+	case config.CostBasisAverage:
+		return averageMatcher{}, nil
+	case config.CostBasisSpecific:
+		return specificMatcher{}, nil
+	default:
+		return nil, config.ValidateCostBasis(method)
+	}
+}
+
+// fifoMatcher writes off the earliest lot first (先進先出).
+type fifoMatcher struct{}
+
+func (fifoMatcher) Method() string {
+	return config.CostBasisFIFO
+}
+
+func (fifoMatcher) Match(lots []model.Lot, lotIDs []int) ([]model.Lot, error) {
+	matched := make([]model.Lot, len(lots))
+	copy(matched, lots)
+
+	// Lots acquired at the same time keep the order of the inventory
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].AcquiredAt() != matched[j].AcquiredAt() {
+			return matched[i].AcquiredAt() < matched[j].AcquiredAt()
+		}
+		return matched[i].LotID() < matched[j].LotID()
+	})
+
+	return matched, nil
+}
+
+// lifoMatcher writes off the latest lot first (後進先出).
+type lifoMatcher struct{}
+
+func (lifoMatcher) Method() string {
+	return config.CostBasisLIFO
+}
+
+func (lifoMatcher) Match(lots []model.Lot, lotIDs []int) ([]model.Lot, error) {
+	matched, _ := fifoMatcher{}.Match(lots, lotIDs)
+
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+
+	return matched, nil
+}
+
+// averageMatcher reprices all lots to their moving average (移動平均) before
+// a sell, so every share sold costs the same. Buys change the average, sells
+// don't. The lots keep the fee and taxes paid, and are then written off first
+// in, first out.
+type averageMatcher struct{}
+
+func (averageMatcher) Method() string {
+	return config.CostBasisAverage
+}
+
+func (averageMatcher) Match(lots []model.Lot, lotIDs []int) ([]model.Lot, error) {
+	var quantity int
+	var amount model.Decimal
+	for _, lot := range lots {
+		quantity += lot.LotQuantity()
+		amount = amount.Add(lot.LotUnitPrice().MulInt(lot.LotQuantity()))
+	}
+
+	if quantity > 0 {
+		avgUnitPrice := amount.DivInt(quantity)
+		for _, lot := range lots {
+			if lot.LotUnitPrice().Cmp(avgUnitPrice) != 0 {
+				lot.Reprice(avgUnitPrice)
+			}
+		}
+	}
+
+	return fifoMatcher{}.Match(lots, lotIDs)
+}
+
+// specificMatcher writes off the lots referenced by the sell (指定批次), in
+// the given order. A sell without references, e.g. a replayed record, falls
+// back to first in, first out.
+type specificMatcher struct{}
+
+func (specificMatcher) Method() string {
+	return config.CostBasisSpecific
+}
+
+func (specificMatcher) Match(lots []model.Lot, lotIDs []int) ([]model.Lot, error) {
+	if len(lotIDs) == 0 {
+		return fifoMatcher{}.Match(lots, lotIDs)
+	}
+
+	lotByID := map[int]model.Lot{}
+	for _, lot := range lots {
+		lotByID[lot.LotID()] = lot
+	}
+
+	// The lots written off by an earlier match are gone, skip them
+	var matched []model.Lot
+	for _, id := range lotIDs {
+		if lot, ok := lotByID[id]; ok {
+			matched = append(matched, lot)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("none of the lots %v is in the inventory", lotIDs)
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"HermInvest/pkg/config"
+	"HermInvest/pkg/model"
+	"errors"
+	"testing"
+)
+
+func newLots() []*model.Transaction {
+	d := model.MustParseDecimal
+	return []*model.Transaction{
+		{ID: 1, Date: "2024-01-02", Time: "09:00:00", StockNo: "2330", TranType: 1, Quantity: 1000, UnitPrice: d("500")},
+		{ID: 3, Date: "2024-01-03", Time: "09:00:00", StockNo: "2330", TranType: 1, Quantity: 2000, UnitPrice: d("530")},
+		{ID: 2, Date: "2024-01-02", Time: "10:00:00", StockNo: "2330", TranType: 1, Quantity: 1000, UnitPrice: d("510")},
+	}
+}
+
+func TestLotMatcherMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		lotIDs    []int
+		wantIDs   []int
+		wantPrice string // unit price of the lots after matching, empty if unchanged
+		wantErr   bool
+	}{
+		{name: "fifo", method: config.CostBasisFIFO, wantIDs: []int{1, 2, 3}},
+		{name: "lifo", method: config.CostBasisLIFO, wantIDs: []int{3, 2, 1}},
+		// (500*1000 + 530*2000 + 510*1000) / 4000
+		{name: "average", method: config.CostBasisAverage, wantIDs: []int{1, 2, 3}, wantPrice: "517.5"},
+		{name: "specific", method: config.CostBasisSpecific, lotIDs: []int{3, 1}, wantIDs: []int{3, 1}},
+		{name: "specific skips written-off lots", method: config.CostBasisSpecific, lotIDs: []int{4, 2}, wantIDs: []int{2}},
+		{name: "specific without lots is fifo", method: config.CostBasisSpecific, wantIDs: []int{1, 2, 3}},
+		{name: "specific with no lot held", method: config.CostBasisSpecific, lotIDs: []int{4}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lotMatcher, err := NewLotMatcher(tt.method)
+			if err != nil {
+				t.Fatalf("NewLotMatcher(%q) error = %v", tt.method, err)
+			}
+
+			transactions := newLots()
+			var lots []model.Lot
+			for _, transaction := range transactions {
+				lots = append(lots, transaction)
+			}
+
+			matched, err := lotMatcher.Match(lots, tt.lotIDs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Match() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var gotIDs []int
+			for _, lot := range matched {
+				gotIDs = append(gotIDs, lot.LotID())
+			}
+			if !equalInts(gotIDs, tt.wantIDs) {
+				t.Errorf("Match() = lots %v, want %v", gotIDs, tt.wantIDs)
+			}
+
+			for i, transaction := range transactions {
+				want := newLots()[i].UnitPrice
+				if tt.wantPrice != "" {
+					want = model.MustParseDecimal(tt.wantPrice)
+				}
+				if transaction.UnitPrice.Cmp(want) != 0 {
+					t.Errorf("lot %d unit price = %s, want %s", transaction.ID, transaction.UnitPrice, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLotMatcherUnknown(t *testing.T) {
+	if _, err := NewLotMatcher("hifo"); err == nil {
+		t.Errorf("NewLotMatcher(%q) error = nil, want error", "hifo")
+	}
+}
+
+func TestCalcRemainingTransactionRecords(t *testing.T) {
+	d := model.MustParseDecimal
+	trs := []*model.TransactionRecord{
+		model.NewTransactionRecord("2024-01-02", "09:00:00", "2330", 1, 1000, d("500")),
+		model.NewTransactionRecord("2024-01-03", "09:00:00", "2330", 1, 1000, d("600")),
+		model.NewTransactionRecord("2024-01-04", "09:00:00", "2330", -1, 1500, d("650")),
+	}
+
+	tests := []struct {
+		method       string
+		wantQuantity int
+		wantAvgPrice string
+	}{
+		{method: config.CostBasisFIFO, wantQuantity: 500, wantAvgPrice: "600"},
+		{method: config.CostBasisLIFO, wantQuantity: 500, wantAvgPrice: "500"},
+		{method: config.CostBasisAverage, wantQuantity: 500, wantAvgPrice: "550"},
+		{method: config.CostBasisSpecific, wantQuantity: 500, wantAvgPrice: "600"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			lotMatcher, _ := NewLotMatcher(tt.method)
+			serv := NewService(nil, nil, nil, lotMatcher)
+
+			remainingTrs, err := serv.calcRemainingTransactionRecords(trs)
+			if err != nil {
+				t.Fatalf("calcRemainingTransactionRecords() error = %v", err)
+			}
+
+			quantity, avgUnitPrice := model.SumQuantityUnitPrice(remainingTrs)
+			if quantity != tt.wantQuantity || avgUnitPrice.Cmp(d(tt.wantAvgPrice)) != 0 {
+				t.Errorf("remaining = %d shares at %s, want %d at %s",
+					quantity, avgUnitPrice, tt.wantQuantity, tt.wantAvgPrice)
+			}
+
+			// The records themselves are kept for the ledger
+			if trs[0].Quantity != 1000 || trs[1].Quantity != 1000 || trs[1].UnitPrice.Cmp(d("600")) != 0 {
+				t.Errorf("calcRemainingTransactionRecords() modified the records")
+			}
+		})
+	}
+}
+
+func TestCalcRemainingTransactionRecordsShort(t *testing.T) {
+	d := model.MustParseDecimal
+	trs := []*model.TransactionRecord{
+		model.NewTransactionRecord("2024-01-02", "09:00:00", "2330", 1, 1000, d("500")),
+		model.NewTransactionRecord("2024-01-03", "09:00:00", "2330", -1, 1500, d("600")),
+	}
+
+	serv := NewService(nil, nil, nil, fifoMatcher{})
+	var oversellErr *model.OversellError
+	if _, err := serv.calcRemainingTransactionRecords(trs); !errors.As(err, &oversellErr) {
+		t.Fatalf("calcRemainingTransactionRecords() error = %v, want an OversellError", err)
+	}
+
+	// The excess is a short lot, covered by the next buy
+	serv = serv.WithAllowShort(true)
+	remainingTrs, err := serv.calcRemainingTransactionRecords(trs)
+	if err != nil || len(remainingTrs) != 1 || remainingTrs[0].TranType != -1 || remainingTrs[0].Quantity != 500 {
+		t.Fatalf("calcRemainingTransactionRecords() = %+v, %v, want a short lot of 500 shares", remainingTrs, err)
+	}
+
+	trs = append(trs, model.NewTransactionRecord("2024-01-04", "09:00:00", "2330", 1, 800, d("550")))
+	remainingTrs, err = serv.calcRemainingTransactionRecords(trs)
+	if err != nil || len(remainingTrs) != 1 || remainingTrs[0].TranType != 1 || remainingTrs[0].Quantity != 300 {
+		t.Fatalf("calcRemainingTransactionRecords() = %+v, %v, want a lot of 300 shares", remainingTrs, err)
+	}
+	if trs[1].Quantity != 1500 || trs[2].Quantity != 800 {
+		t.Errorf("calcRemainingTransactionRecords() modified the records")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
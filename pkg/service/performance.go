@@ -0,0 +1,150 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// QueryPerformance measures the money-weighted (XIRR) and the time-weighted
+// returns of the portfolio and of each stock traded, or of stockNo only, over
+// the period from the date from to the date to. Without from, they are
+// measured over the year to date, the year and since inception, see
+// model.StandardPeriods. The date to is the last day with a price or a
+// transaction if empty. The days are valued as QueryPortfolioTimeSeries does,
+// and the cash flows are the trades of the ledger, with the fee and taxes
+// recorded, and the cash received of tblTransactionCash.
+func (serv *service) QueryPerformance(from, to, stockNo string) ([]*model.Performance, error) {
+	days, err := serv.QueryPortfolioTimeSeries("", to, stockNo)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := performancePeriods(from, to, days)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := serv.cashFlows(periods[0].To, stockNo)
+	if err != nil {
+		return nil, err
+	}
+
+	stockNos := make([]string, 0, len(flows))
+	for s := range flows {
+		if s != "" {
+			stockNos = append(stockNos, s)
+		}
+	}
+	sort.Strings(stockNos)
+	if stockNo == "" {
+		stockNos = append([]string{""}, stockNos...) // the portfolio first
+	}
+
+	var performances []*model.Performance
+	for _, s := range stockNos {
+		values := dailyValues(days, s)
+		for _, period := range periods {
+			performances = append(performances, model.NewPerformance(s, period, values, flows[s]))
+		}
+	}
+
+	return performances, nil
+}
+
+// performancePeriods returns the period from the date from to the date to,
+// or the standard periods until to without from. The date to is the last of
+// the days if empty, or today without days.
+func performancePeriods(from, to string, days []*model.PortfolioDay) ([]model.Period, error) {
+	if to == "" {
+		to = time.Now().Format(time.DateOnly)
+		if len(days) > 0 {
+			to = days[len(days)-1].Date
+		}
+	}
+
+	if from != "" {
+		return []model.Period{{Name: "Period", From: from, To: to}}, nil
+	}
+	return model.StandardPeriods(to)
+}
+
+// cashFlows returns the cash flows of each stock, or of stockNo only, until
+// the date to, or all if empty, ordered by date, and the ones of the
+// portfolio by "": the trades of the ledger with the fee and taxes recorded
+// when they were added to the inventory, and the cash received.
+func (serv *service) cashFlows(to, stockNo string) (map[string][]model.CashFlow, error) {
+	entries, err := serv.repo.QueryLedger("", to, stockNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying ledger: %v", err)
+	}
+
+	cashes, err := serv.repo.QueryCashDividendAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying cash dividends: %v", err)
+	}
+
+	byStockNo := map[string][]model.CashFlow{}
+	add := func(stockNo string, flow model.CashFlow) {
+		byStockNo[stockNo] = append(byStockNo[stockNo], flow)
+		byStockNo[""] = append(byStockNo[""], flow)
+	}
+
+	for _, e := range entries {
+		if e.Source.IsCorporateAction() {
+			continue // no cash paid nor received
+		}
+
+		var fee, taxes int // none until the trade is added to the inventory
+		if e.Fee != nil && e.Taxes != nil {
+			fee, taxes = *e.Fee, *e.Taxes
+		}
+		totalAmount := e.UnitPrice.MulInt(e.Quantity)
+		amount := totalAmount.Neg().Sub(model.NewDecimalFromInt(fee))
+		if e.TranType < 0 {
+			amount = totalAmount.Sub(model.NewDecimalFromInt(fee + taxes))
+		}
+		add(e.StockNo, model.CashFlow{Date: e.Date, Amount: amount})
+	}
+
+	for _, cd := range cashes {
+		date := cd.DistributionDate
+		if date == "" {
+			date = cd.ExDividendDate
+		}
+		if (stockNo != "" && cd.StockNo != stockNo) || (to != "" && date > to) || cd.TotalAmount == 0 {
+			continue
+		}
+		add(cd.StockNo, model.CashFlow{Date: date, Amount: model.NewDecimalFromInt(cd.TotalAmount)})
+	}
+
+	// The cash dividends were added after all the trades
+	for _, flows := range byStockNo {
+		sort.SliceStable(flows, func(i, j int) bool {
+			return flows[i].Date < flows[j].Date
+		})
+	}
+
+	return byStockNo, nil
+}
+
+// dailyValues returns the market value of stockNo, or of the portfolio if
+// empty, at the close of each day.
+func dailyValues(days []*model.PortfolioDay, stockNo string) []model.DailyValue {
+	values := make([]model.DailyValue, len(days))
+	for i, d := range days {
+		values[i] = model.DailyValue{Date: d.Date, Value: d.Total.MarketValue}
+		if stockNo == "" {
+			continue
+		}
+
+		values[i].Value = model.DecimalZero
+		for _, v := range d.Stocks {
+			if v.StockNo == stockNo {
+				values[i].Value = v.MarketValue
+				break
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+)
+
+// QueryPortfolioTimeSeries queries the holdings of stockNo, or of all the
+// stocks, at the close of each day between the dates from and to, inclusive,
+// valued at the prices stored. Empty conditions are ignored.
+func (serv *service) QueryPortfolioTimeSeries(from, to, stockNo string) ([]*model.PortfolioDay, error) {
+	// The holdings of from are made up of the entries before it
+	entries, err := serv.repo.QueryLedger("", to, stockNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying ledger: %v", err)
+	}
+
+	pnls, err := serv.repo.QueryRealizedPnL("", to, stockNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying realized pnl: %v", err)
+	}
+
+	prices, err := serv.repo.QueryPrices("", to, stockNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying prices: %v", err)
+	}
+
+	return model.NewPortfolioTimeSeries(entries, pnls, prices, from, to), nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/quote"
+	"fmt"
+)
+
+// ImportPrices stores the daily prices, replacing the prices of a stock on
+// the dates already stored, all or nothing.
+func (serv *service) ImportPrices(prices []*model.Price) error {
+	tx := serv.repo.Begin()
+
+	err := serv.repo.WithTrx(tx).CreatePrices(prices)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return fmt.Errorf("failed to creating prices: %v", err)
+	}
+
+	serv.repo.WithTrx(tx).Commit()
+
+	return nil
+}
+
+// FetchPrices fetches the daily prices of the stock between the dates from
+// and to, inclusive, from the provider, and stores them as ImportPrices does.
+func (serv *service) FetchPrices(provider quote.QuoteProvider, stockNo, from, to string) ([]*model.Price, error) {
+	prices, err := provider.DailyPrices(stockNo, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetching prices of %s: %w", stockNo, err)
+	}
+
+	err = serv.ImportPrices(prices)
+	if err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// QueryInventoryValuation queries the inventory summed up per stock, valued
+// at the latest close of each stock.
+func (serv *service) QueryInventoryValuation() ([]*model.Valuation, error) {
+	inventory, err := serv.repo.QueryTransactionInventory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+
+	prices, err := serv.repo.QueryLatestPriceAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying prices: %v", err)
+	}
+
+	return model.NewValuations(inventory, prices), nil
+}
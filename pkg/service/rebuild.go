@@ -0,0 +1,512 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Parts of the database regenerated by Rebuild.
+const (
+	RebuildRecords   = "records"   // tblTransactionRecordSys, with the records of the corporate actions
+	RebuildInventory = "inventory" // tblTransaction, its history and the realized profit and loss
+	RebuildCash      = "cash"      // tblTransactionCash, the cash dividends and capital reduction refunds
+)
+
+// RebuildParts lists the parts which can be rebuilt alone.
+var RebuildParts = []string{RebuildRecords, RebuildInventory, RebuildCash}
+
+// ValidateRebuildPart returns an error if part is not a part of RebuildParts.
+func ValidateRebuildPart(part string) error {
+	for _, p := range RebuildParts {
+		if p == part {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown part '%s', valid parts are: %s", part, strings.Join(RebuildParts, ", "))
+}
+
+// RebuildReport is the result of a rebuild.
+type RebuildReport struct {
+	Changes   []*RebuildChange // of the stocks changed, ordered by stock number
+	Committed bool
+}
+
+// RebuildChange is a stock before and after a rebuild: the shares and cost in
+// the inventory, the records generated by its corporate actions, and its cash
+// dividends.
+type RebuildChange struct {
+	InventoryChange
+	RecordsBefore int
+	RecordsAfter  int
+	CashBefore    int
+	CashAfter     int
+}
+
+// RebuildScope limits a rebuild to a stock and/or to the records on or after
+// a date. The zero scope rebuilds everything.
+type RebuildScope struct {
+	StockNo string
+	From    string // e.g. 2024-01-02
+}
+
+// Rebuild regenerates the part of the database, or all of them if part is
+// empty, in a database transaction, limited to the scope. The report of the
+// changes is passed to confirm, which commits the rebuild by returning true;
+// otherwise, e.g. for a dry run, it is rolled back.
+func (serv *service) Rebuild(part string, scope RebuildScope, confirm func(*RebuildReport) bool) (*RebuildReport, error) {
+	if part != "" {
+		if err := ValidateRebuildPart(part); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := serv.repo.Begin()
+	s := serv.WithTrx(tx)
+
+	var stockNos []string // of the scope, nil for all the stocks
+	if scope != (RebuildScope{}) {
+		var err error
+		stockNos, err = s.scopeStocks(scope)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, err
+		}
+	}
+
+	before, err := s.summarizeStocks(stockNos)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, err
+	}
+
+	switch {
+	case stockNos != nil:
+		rebuilt := map[string]bool{}
+		for _, stockNo := range stockNos {
+			if rebuilt[stockNo] {
+				continue
+			}
+			var members []string
+			members, err = s.rebuildStock(part, stockNo, scope.From)
+			if err != nil {
+				break
+			}
+			for _, member := range members {
+				rebuilt[member] = true
+			}
+		}
+	case part == "":
+		err = s.rebuild()
+	case part == RebuildRecords:
+		var trs []*model.TransactionRecord
+		trs, _, err = s.calcTransactionRecordSys("")
+		if err == nil {
+			err = s.replaceTransactionRecordSys(trs)
+		}
+	case part == RebuildCash:
+		var cashDividends []*model.ExDividend
+		_, cashDividends, err = s.calcTransactionRecordSys("")
+		if err == nil {
+			err = s.replaceCashDividends(cashDividends)
+		}
+	case part == RebuildInventory:
+		err = s.rebuildTransaction()
+	}
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to rebuild: %w", err)
+	}
+
+	after, err := s.summarizeStocks(stockNos)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, err
+	}
+
+	report := &RebuildReport{Changes: diffStocks(before, after)}
+	if confirm(report) {
+		serv.repo.WithTrx(tx).Commit()
+		report.Committed = true
+	} else {
+		serv.repo.WithTrx(tx).Rollback()
+	}
+
+	return report, nil
+}
+
+// scopeStocks returns the stocks of the scope: its stock, or the stocks with
+// a record, a corporate action or a cash dividend on or after its date, with
+// the stocks they are renamed from or to.
+func (serv *service) scopeStocks(scope RebuildScope) ([]string, error) {
+	crs, err := serv.repo.QueryCapitalReductionAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying capital reductions: %v", err)
+	}
+	families := newStockFamilies(crs)
+
+	if scope.StockNo != "" {
+		return families.members(scope.StockNo), nil
+	}
+
+	traded, err := serv.repo.QueryStockNoTradedFrom(scope.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying stocks: %v", err)
+	}
+	stockNos := map[string]bool{}
+	for _, stockNo := range traded {
+		stockNos[stockNo] = true
+	}
+
+	eds, err := serv.repo.QueryDividendAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying dividends: %v", err)
+	}
+	for _, ed := range eds {
+		if ed.ExDividendDate >= scope.From {
+			stockNos[ed.StockNo] = true
+		}
+	}
+
+	for _, cr := range crs {
+		if cr.CapitalReductionDate >= scope.From {
+			stockNos[cr.StockNo] = true
+		}
+	}
+
+	cashDividends, err := serv.repo.QueryCashDividendAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying cash dividends: %v", err)
+	}
+	for _, cd := range cashDividends {
+		if cd.ExDividendDate >= scope.From {
+			stockNos[cd.StockNo] = true
+		}
+	}
+
+	withMembers := map[string]bool{}
+	for stockNo := range stockNos {
+		for _, member := range families.members(stockNo) {
+			withMembers[member] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(withMembers))
+	for stockNo := range withMembers {
+		sorted = append(sorted, stockNo)
+	}
+	sort.Strings(sorted)
+
+	return sorted, nil
+}
+
+// rebuildStock regenerates the part of the database, or all of them if part
+// is empty, for the stock from the date on, or from its first record if from
+// is empty, in the database transaction of the caller. Only the suffix of
+// the ledger from the date is written again. The stocks it is renamed from or
+// to are rebuilt with it, it returns all of them.
+func (serv *service) rebuildStock(part, stockNo, from string) ([]string, error) {
+	crs, err := serv.repo.QueryCapitalReductionAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying capital reductions: %v", err)
+	}
+	members := newStockFamilies(crs).members(stockNo)
+
+	if part == "" || part == RebuildRecords || part == RebuildCash {
+		trs, cashDividends, err := serv.calcTransactionRecordSys(stockNo)
+		if err != nil {
+			return nil, err
+		}
+
+		if part != RebuildCash {
+			for _, member := range members {
+				err = serv.repo.DeleteTransactionRecordSys(member, from)
+				if err != nil {
+					return nil, fmt.Errorf("failed to deleting records: %v", err)
+				}
+			}
+
+			var suffix []*model.TransactionRecord
+			for _, tr := range trs {
+				if tr.Date >= from {
+					suffix = append(suffix, tr)
+				}
+			}
+			err = serv.repo.CreateTransactionRecordSysBatch(suffix)
+			if err != nil {
+				return nil, fmt.Errorf("failed to creating records: %v", err)
+			}
+		}
+
+		if part != RebuildRecords {
+			for _, member := range members {
+				err = serv.repo.DeleteCashDividendRecords(member, from)
+				if err != nil {
+					return nil, fmt.Errorf("failed to deleting cash dividends: %v", err)
+				}
+			}
+
+			var suffix []*model.ExDividend
+			for _, cd := range cashDividends {
+				if cd.ExDividendDate >= from {
+					suffix = append(suffix, cd)
+				}
+			}
+			err = serv.repo.CreateCashDividendRecords(suffix)
+			if err != nil {
+				return nil, fmt.Errorf("failed to creating cash dividends: %v", err)
+			}
+		}
+	}
+
+	if part == "" || part == RebuildInventory {
+		var familyCrs []*model.CapitalReduction
+		for _, cr := range crs {
+			for _, member := range members {
+				if cr.StockNo == member {
+					familyCrs = append(familyCrs, cr)
+				}
+			}
+		}
+
+		err := serv.replayInventory(members, familyCrs, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuilding inventory: %w", err)
+		}
+	}
+
+	return members, nil
+}
+
+// replayInventory regenerates the inventory of the stocks of a rename chain,
+// and their history and realized profit and loss, by replaying their ledger
+// and capital reductions from the date on, or from their first record if
+// from is empty.
+func (serv *service) replayInventory(stockNos []string, crs []*model.CapitalReduction, from string) error {
+	var trs []*model.LedgerEntry
+	for _, stockNo := range stockNos {
+		entries, err := serv.repo.QueryLedger("", "", stockNo)
+		if err != nil {
+			return fmt.Errorf("failed to querying ledger: %v", err)
+		}
+		trs = append(trs, entries...)
+	}
+	sortLedger(trs)
+
+	// The history of a lot written off doesn't link to the sell, so the
+	// replay starts after the stocks were last flat before the date: the lots
+	// bought before are all written off by then, and the history and the
+	// realized profit and loss up to it stay as they are. The lots of a
+	// capital reduction are held between its date and the distribution of
+	// the shares left, though its records sell them first.
+	var start int
+	var flatDate, flatTime string
+	if from != "" {
+		var position int
+		for i, tr := range trs {
+			if tr.Date >= from {
+				break
+			}
+			position += tr.TranType * tr.Quantity
+			if position != 0 || tr.Source == model.SourceCapitalReduction {
+				continue
+			}
+
+			reducing := false
+			for _, cr := range crs {
+				if cr.CapitalReductionDate <= tr.Date && tr.Date < cr.DistributionDate {
+					reducing = true
+				}
+			}
+			if !reducing {
+				start = i + 1
+				flatDate, flatTime = tr.Date, tr.Time
+			}
+		}
+	}
+
+	for _, stockNo := range stockNos {
+		err := serv.repo.DeleteStockInventory(stockNo, flatDate, flatTime)
+		if err != nil {
+			return fmt.Errorf("failed to deleting inventory: %v", err)
+		}
+	}
+
+	// The capital reductions after the flat point only
+	var pending []*model.CapitalReduction
+	for _, cr := range crs {
+		if cr.CapitalReductionDate > flatDate {
+			pending = append(pending, cr)
+		}
+	}
+
+	return serv.replayRecords(trs[start:], pending)
+}
+
+// stockSummary is a stock in the inventory, the records and the cash
+// dividends.
+type stockSummary struct {
+	inventorySummary
+	records int // generated by the corporate actions
+	cash    int
+}
+
+// summarizeStocks sums up the stocks, or all of them if stockNos is nil, in
+// the tables regenerated by a rebuild.
+func (serv *service) summarizeStocks(stockNos []string) (map[string]stockSummary, error) {
+	if stockNos == nil {
+		return serv.summarizeStock("")
+	}
+
+	summaries := map[string]stockSummary{}
+	for _, stockNo := range stockNos {
+		summary, err := serv.summarizeStock(stockNo)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := summary[stockNo]; ok {
+			summaries[stockNo] = s
+		}
+	}
+
+	return summaries, nil
+}
+
+// summarizeStock sums up the stock, or each stock if stockNo is empty, in the
+// tables regenerated by a rebuild.
+func (serv *service) summarizeStock(stockNo string) (map[string]stockSummary, error) {
+	var transactions []*model.Transaction
+	var err error
+	if stockNo == "" {
+		transactions, err = serv.repo.QueryTransactionAll()
+	} else {
+		transactions, err = serv.repo.QueryTransactionByDetails(stockNo, 0, "")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+
+	summaries := map[string]stockSummary{}
+	for _, t := range transactions {
+		summary := summaries[t.StockNo]
+		summary.quantity += t.TranType * t.Quantity
+		summary.cost = summary.cost.Add(t.TotalAmount)
+		summaries[t.StockNo] = summary
+	}
+
+	ledger, err := serv.repo.QueryLedger("", "", stockNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying ledger: %v", err)
+	}
+	for _, e := range ledger {
+		if e.Source.IsCorporateAction() {
+			summary := summaries[e.StockNo]
+			summary.records++
+			summaries[e.StockNo] = summary
+		}
+	}
+
+	cashDividends, err := serv.repo.QueryCashDividendAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying cash dividends: %v", err)
+	}
+	for _, cd := range cashDividends {
+		if stockNo == "" || cd.StockNo == stockNo {
+			summary := summaries[cd.StockNo]
+			summary.cash += cd.TotalAmount
+			summaries[cd.StockNo] = summary
+		}
+	}
+
+	return summaries, nil
+}
+
+// diffStocks returns the changes of the stocks which differ, ordered by
+// stock number.
+func diffStocks(before, after map[string]stockSummary) []*RebuildChange {
+	stockNos := map[string]bool{}
+	for stockNo := range before {
+		stockNos[stockNo] = true
+	}
+	for stockNo := range after {
+		stockNos[stockNo] = true
+	}
+
+	var changes []*RebuildChange
+	for stockNo := range stockNos {
+		b, a := before[stockNo], after[stockNo]
+		if b.quantity == a.quantity && b.cost.Cmp(a.cost) == 0 && b.records == a.records && b.cash == a.cash {
+			continue
+		}
+		changes = append(changes, &RebuildChange{
+			InventoryChange: InventoryChange{
+				StockNo:        stockNo,
+				QuantityBefore: b.quantity,
+				QuantityAfter:  a.quantity,
+				CostBefore:     b.cost,
+				CostAfter:      a.cost,
+			},
+			RecordsBefore: b.records,
+			RecordsAfter:  a.records,
+			CashBefore:    b.cash,
+			CashAfter:     a.cash,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].StockNo < changes[j].StockNo
+	})
+
+	return changes
+}
+
+// stockFamilies links the stock numbers renamed by the capital reductions:
+// each stock number of a rename chain maps to the first one.
+type stockFamilies map[string]string
+
+// newStockFamilies links the stock numbers renamed by the capital reductions.
+func newStockFamilies(crs []*model.CapitalReduction) stockFamilies {
+	families := stockFamilies{}
+	for _, cr := range crs {
+		newStockNo := cr.DistributedStockNo()
+		if newStockNo == cr.StockNo {
+			continue
+		}
+		oldRoot, newRoot := families.root(cr.StockNo), families.root(newStockNo)
+		if oldRoot == newRoot {
+			continue
+		}
+		families[newRoot] = oldRoot
+		for stockNo, root := range families {
+			if root == newRoot {
+				families[stockNo] = oldRoot
+			}
+		}
+		families[cr.StockNo] = oldRoot
+	}
+	return families
+}
+
+// root returns the first stock number of the rename chain of the stock, or
+// the stock number if it is never renamed.
+func (families stockFamilies) root(stockNo string) string {
+	if root, ok := families[stockNo]; ok {
+		return root
+	}
+	return stockNo
+}
+
+// members returns the stock numbers of the rename chain of the stock, ordered.
+func (families stockFamilies) members(stockNo string) []string {
+	root := families.root(stockNo)
+
+	members := []string{root}
+	for member, r := range families {
+		if r == root && member != root {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+
+	return members
+}
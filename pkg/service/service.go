@@ -2,6 +2,7 @@ package service
 
 import (
 	"HermInvest/pkg/model"
+	"errors"
 	"fmt"
 	"sort"
 	"time"
@@ -10,15 +11,294 @@ import (
 )
 
 type service struct {
-	repo model.Repositorier
+	repo        model.Repositorier
+	feeSchedule model.FeeSchedule
+	taxSchedule model.TaxSchedule
+	lotMatcher  LotMatcher
+	allowShort  bool
 }
 
-func NewService(repository model.Repositorier) *service {
-	return &service{repo: repository}
+// NewService creates a service. Transactions are charged broker commission
+// by feeSchedule and taxes by taxSchedule, or their model defaults if nil.
+// Sells write off lots by lotMatcher, or first in, first out if nil.
+func NewService(repository model.Repositorier, feeSchedule model.FeeSchedule, taxSchedule model.TaxSchedule, lotMatcher LotMatcher) *service {
+	if feeSchedule == nil {
+		feeSchedule = model.DefaultFeeSchedule()
+	}
+	if taxSchedule == nil {
+		taxSchedule = model.DefaultTaxSchedule()
+	}
+	if lotMatcher == nil {
+		lotMatcher = fifoMatcher{}
+	}
+	return &service{repo: repository, feeSchedule: feeSchedule, taxSchedule: taxSchedule, lotMatcher: lotMatcher}
 }
 
 func (serv *service) WithTrx(trxHandle *gorm.DB) *service {
-	return &service{repo: serv.repo.WithTrx(trxHandle)} // return new one
+	s := *serv
+	s.repo = serv.repo.WithTrx(trxHandle)
+	return &s // return new one
+}
+
+// WithAllowShort returns a service that records a sell exceeding the shares
+// held as a short position, rather than rejecting it with an OversellError.
+func (serv *service) WithAllowShort(allowShort bool) *service {
+	s := *serv
+	s.allowShort = allowShort
+	return &s // return new one
+}
+
+// WithLotMatcher returns a service using another cost basis method, e.g. the
+// one given by a command flag. A nil lotMatcher keeps the current one.
+func (serv *service) WithLotMatcher(lotMatcher LotMatcher) *service {
+	if lotMatcher == nil {
+		return serv
+	}
+	s := *serv
+	s.lotMatcher = lotMatcher
+	return &s // return new one
+}
+
+// FeeSchedule returns the fee schedule of the broker in use.
+func (serv *service) FeeSchedule() model.FeeSchedule {
+	return serv.feeSchedule
+}
+
+// TaxSchedule returns the tax schedule in use.
+func (serv *service) TaxSchedule() model.TaxSchedule {
+	return serv.taxSchedule
+}
+
+// markDayTrade marks a sell as a day trade (當沖) if the inventory holds
+// enough shares of the stock bought on the same day.
+func (serv *service) markDayTrade(t *model.Transaction) error {
+	if t.TranType > 0 {
+		return nil
+	}
+
+	buys, err := serv.repo.QueryTransactionByDetails(t.StockNo, 1, t.Date)
+	if err != nil {
+		return fmt.Errorf("failed to querying same-day purchases: %v", err)
+	}
+
+	var boughtQuantity int
+	for _, buy := range buys {
+		boughtQuantity += buy.Quantity
+	}
+
+	if boughtQuantity >= t.Quantity {
+		t.SetDayTrade(true)
+	}
+
+	return nil
+}
+
+// checkOversell rejects a sell exceeding the shares held in the inventory,
+// unless short positions are allowed.
+func (serv *service) checkOversell(t *model.Transaction) error {
+	if t.TranType > 0 || serv.allowShort {
+		return nil
+	}
+
+	lots, err := serv.repo.QueryTransactionByDetails(t.StockNo, 1, "")
+	if err != nil {
+		return fmt.Errorf("failed to querying holdings: %v", err)
+	}
+
+	var held int
+	for _, lot := range lots {
+		held += lot.Quantity
+	}
+
+	if t.Quantity > held {
+		return &model.OversellError{
+			StockNo: t.StockNo, Date: t.Date, Time: t.Time, Held: held, Requested: t.Quantity}
+	}
+
+	return nil
+}
+
+// checkLots checks the lots referenced by a sell are held in the inventory
+// and cover its quantity. It returns their acquisition times, the references
+// recorded on the ledger.
+func (serv *service) checkLots(t *model.Transaction) ([]string, error) {
+	if len(t.LotIDs) == 0 {
+		return nil, nil
+	}
+
+	lots, err := serv.repo.QueryTransactionByDetails(t.StockNo, -t.TranType, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying lots: %v", err)
+	}
+
+	lotByID := map[int]*model.Transaction{}
+	for _, lot := range lots {
+		lotByID[lot.ID] = lot
+	}
+
+	var quantity int
+	var refs []string
+	seen := map[int]bool{}
+	for _, id := range t.LotIDs {
+		lot, ok := lotByID[id]
+		if !ok {
+			return nil, fmt.Errorf("lot %d is not a lot of %s in the inventory", id, t.StockNo)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("lot %d is referenced twice", id)
+		}
+		seen[id] = true
+		quantity += lot.Quantity
+		refs = append(refs, lot.AcquiredAt())
+	}
+
+	if quantity < t.Quantity {
+		return nil, fmt.Errorf("lots %v hold %d shares, less than the %d shares to write off", t.LotIDs, quantity, t.Quantity)
+	}
+
+	return refs, nil
+}
+
+// lotIDsAt returns the IDs of the inventory lots a replayed sell wrote off,
+// by their acquisition times recorded on the ledger. The lots acquired at
+// the same time are all referenced, the ones no longer held are skipped.
+func (serv *service) lotIDsAt(t *model.Transaction, refs []string) ([]int, error) {
+	lots, err := serv.repo.QueryTransactionByDetails(t.StockNo, -t.TranType, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying lots: %v", err)
+	}
+
+	var lotIDs []int
+	for _, ref := range refs {
+		for _, lot := range lots {
+			if lot.AcquiredAt() == ref {
+				lotIDs = append(lotIDs, lot.ID)
+			}
+		}
+	}
+
+	return lotIDs, nil
+}
+
+// matchLot returns the inventory lot the new transaction writes off next, as
+// chosen by the cost basis method. It returns model.ErrNotFound if there is
+// no lot of the stock.
+func (serv *service) matchLot(newTransaction *model.Transaction) (*model.Transaction, error) {
+	transactions, err := serv.repo.QueryTransactionByDetails(newTransaction.StockNo, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return nil, model.ErrNotFound
+	}
+
+	// The lots are all on one side, a transaction on the same side adds to
+	// the inventory without matching.
+	if transactions[0].TranType == newTransaction.TranType {
+		return transactions[0], nil
+	}
+
+	lots := make([]model.Lot, len(transactions))
+	unitPrices := map[int]model.Decimal{}
+	for i, t := range transactions {
+		t.FeeSchedule = serv.feeSchedule
+		t.TaxSchedule = serv.taxSchedule
+		lots[i] = t
+		unitPrices[t.ID] = t.UnitPrice
+	}
+
+	matched, err := serv.lotMatcher.Match(lots, newTransaction.LotIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		return nil, model.ErrNotFound
+	}
+
+	// Persist the lots the cost basis method repriced
+	for _, t := range transactions {
+		if t.UnitPrice.Cmp(unitPrices[t.ID]) != 0 {
+			err := serv.repo.UpdateTransaction(t.ID, t)
+			if err != nil {
+				return nil, fmt.Errorf("failed to repricing lot %d: %v", t.ID, err)
+			}
+		}
+	}
+
+	return matched[0].(*model.Transaction), nil
+}
+
+// calcRemainingTransactionRecords replays the records and returns the lots
+// still held, written off by the cost basis method. The records are left
+// untouched, the returned lots are copies. A sell exceeding the lots is an
+// OversellError, unless short positions are allowed: the excess is then a
+// short lot, a sell written off by the next buys, as the inventory records it
+// (Case F of addTransactionTailRecursion).
+func (serv *service) calcRemainingTransactionRecords(trs []*model.TransactionRecord) ([]*model.TransactionRecord, error) {
+	var remainingLots []model.Lot
+	for _, tr := range trs {
+		lot := *tr
+
+		// The lots are all on one side, a record on the same side adds a lot
+		if len(remainingLots) == 0 || remainingLots[0].(*model.TransactionRecord).TranType == tr.TranType {
+			if len(remainingLots) == 0 && tr.TranType < 0 && !serv.allowShort {
+				return nil, &model.OversellError{
+					StockNo: tr.StockNo, Date: tr.Date, Time: tr.Time, Held: 0, Requested: tr.Quantity}
+			}
+			remainingLots = append(remainingLots, &lot)
+			continue
+		}
+
+		matched, err := serv.lotMatcher.Match(remainingLots, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var held int
+		for _, l := range remainingLots {
+			held += l.LotQuantity()
+		}
+		if tr.TranType < 0 && tr.Quantity > held && !serv.allowShort {
+			return nil, &model.OversellError{
+				StockNo: tr.StockNo, Date: tr.Date, Time: tr.Time, Held: held, Requested: tr.Quantity}
+		}
+
+		qty := tr.Quantity
+		soldOut := map[model.Lot]bool{}
+		for _, l := range matched {
+			if qty == 0 {
+				break
+			}
+			record := l.(*model.TransactionRecord)
+			if record.Quantity <= qty {
+				qty -= record.Quantity
+				soldOut[l] = true
+			} else {
+				record.Quantity -= qty
+				qty = 0
+			}
+		}
+
+		var keptLots []model.Lot
+		for _, l := range remainingLots {
+			if !soldOut[l] {
+				keptLots = append(keptLots, l)
+			}
+		}
+		if qty > 0 {
+			// The excess opens a position on the side of the record
+			lot.Quantity = qty
+			keptLots = append(keptLots, &lot)
+		}
+		remainingLots = keptLots
+	}
+
+	remainingTrs := make([]*model.TransactionRecord, len(remainingLots))
+	for i, lot := range remainingLots {
+		remainingTrs[i] = lot.(*model.TransactionRecord)
+	}
+
+	return remainingTrs, nil
 }
 
 // addTransactionTailRecursion add new transaction records with tail recursion,
@@ -36,36 +316,39 @@ func (serv *service) addTransactionTailRecursion(newTransaction *model.Transacti
 
 	// Cases:
 	// 1. Newly added: If there is no transaction in the inventory (A) or
-	//    the new transaction is the same as the oldest transaction in the
-	//    inventory (B), add it directly to the inventory.
+	//    the new transaction is on the same side as the inventory (B), add
+	//    it directly to the inventory.
 	// 2. Write-off:
 	// 	* Sufficient inventory: If the inventory quantity is sufficient,
 	//    update the inventory quantity (C) or delete the inventory (D), and
 	//    add the corresponding transaction history.
 	// 	* Insufficient inventory: If the inventory quantity can't be Write-off.
 	//    Recurse until success (E). The termination condition is A B C D.
-	//  * Over inventory: Write-off over than inventory (F).
+	//  * Over inventory: Write-off over than inventory (F), the excess opens
+	//    a short position. Sells are checked by checkOversell beforehand, so
+	//    it only happens if short positions are allowed.
+	// The lot to write off is chosen by the cost basis method, see LotMatcher.
 
-	// TODO: This func should be moved to service tier.
-
-	earliestTransaction, err := serv.repo.FindEarliestTransactionByStockNo(newTransaction.StockNo)
+	matchedTransaction, err := serv.matchLot(newTransaction)
 	if err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("failed to finding first purchase: %v", err)
+		if !errors.Is(err, model.ErrNotFound) {
+			return nil, fmt.Errorf("failed to matching lot: %v", err)
 		}
 		// Case A
-		earliestTransaction.TranType = newTransaction.TranType
+		matchedTransaction = &model.Transaction{TranType: newTransaction.TranType}
 	}
+	matchedTransaction.FeeSchedule = serv.feeSchedule
+	matchedTransaction.TaxSchedule = serv.taxSchedule
 
-	if earliestTransaction.TranType == newTransaction.TranType {
+	if matchedTransaction.TranType == newTransaction.TranType {
 		if newTransaction.Quantity != remainingQuantity {
-			// Case F
-			newTransaction.SetQuantity(newTransaction.Quantity - remainingQuantity)
-			_, err = serv.repo.CreateTransactionHistory(newTransaction)
+			// Case F, the part written off and the short lot share the fee
+			closed := newTransaction.Quantity - remainingQuantity
+			_, err = serv.repo.CreateTransactionHistory(newTransaction.Part(0, closed))
 			if err != nil {
 				return nil, fmt.Errorf("Case(F), failed to creating transaction history: %v", err)
 			}
-			newTransaction.SetQuantity(remainingQuantity)
+			newTransaction.WriteOff(closed)
 		}
 
 		// Case B
@@ -80,17 +363,12 @@ func (serv *service) addTransactionTailRecursion(newTransaction *model.Transacti
 
 		return transaction, nil
 	} else {
-		if earliestTransaction.Quantity > remainingQuantity {
+		if matchedTransaction.Quantity > remainingQuantity {
 			// Case C
 
-			// Create a copy for adding stock history
-			stockHistoryAdd := &model.Transaction{}
-			*stockHistoryAdd = *earliestTransaction
-			// var stockHistoryAdd *model.Transaction // why can't use it, study it
-			// *stockHistoryAdd = *earliestTransaction
-
-			// add transaction history
-			stockHistoryAdd.SetQuantity(remainingQuantity)
+			// add transaction history, the part written off and the rest of
+			// the lot share its fee
+			stockHistoryAdd := matchedTransaction.Part(0, remainingQuantity)
 			_, err = serv.repo.CreateTransactionHistory(stockHistoryAdd)
 			if err != nil {
 				return nil, fmt.Errorf("Case(C), failed to creating transaction history: %v", err)
@@ -100,19 +378,26 @@ func (serv *service) addTransactionTailRecursion(newTransaction *model.Transacti
 				return nil, fmt.Errorf("Case(C), failed to creating transaction history: %v", err)
 			}
 
-			// Update stock inventory
-			earliestTransaction.SetQuantity(earliestTransaction.Quantity - remainingQuantity)
-			err := serv.repo.UpdateTransaction(earliestTransaction.ID, earliestTransaction)
+			// add realized profit and loss
+			err = serv.repo.CreateRealizedPnL(model.NewRealizedPnL(matchedTransaction, newTransaction, remainingQuantity,
+				newTransaction.Quantity-remainingQuantity))
+			if err != nil {
+				return nil, fmt.Errorf("Case(C), failed to creating realized pnl: %v", err)
+			}
+
+			// Update stock inventory, the lot keeps the rest of its fee
+			matchedTransaction.WriteOff(remainingQuantity)
+			err := serv.repo.UpdateTransaction(matchedTransaction.ID, matchedTransaction)
 			if err != nil {
 				return nil, fmt.Errorf("Case(C), failed to updating transaction: %v", err)
 			}
 
-			return earliestTransaction, nil
-		} else if earliestTransaction.Quantity == remainingQuantity {
+			return matchedTransaction, nil
+		} else if matchedTransaction.Quantity == remainingQuantity {
 			// Case D
 
 			// add transaction history
-			_, err = serv.repo.CreateTransactionHistory(earliestTransaction)
+			_, err = serv.repo.CreateTransactionHistory(matchedTransaction)
 			if err != nil {
 				return nil, fmt.Errorf("Case(D), failed to creating transaction history: %v", err)
 			}
@@ -120,8 +405,16 @@ func (serv *service) addTransactionTailRecursion(newTransaction *model.Transacti
 			if err != nil {
 				return nil, fmt.Errorf("Case(D), failed to creating transaction history: %v", err)
 			}
+
+			// add realized profit and loss
+			err = serv.repo.CreateRealizedPnL(model.NewRealizedPnL(matchedTransaction, newTransaction, remainingQuantity,
+				newTransaction.Quantity-remainingQuantity))
+			if err != nil {
+				return nil, fmt.Errorf("Case(D), failed to creating realized pnl: %v", err)
+			}
+
 			// delete stock inventory
-			err = serv.repo.DeleteTransaction(earliestTransaction.ID)
+			err = serv.repo.DeleteTransaction(matchedTransaction.ID)
 			if err != nil {
 				return nil, fmt.Errorf("Case(D), failed to deleting transaction: %v", err)
 			}
@@ -129,49 +422,304 @@ func (serv *service) addTransactionTailRecursion(newTransaction *model.Transacti
 			// Or use move
 
 			return nil, nil
-		} else { // earliestTransaction.Quantity < remainingQuantity
+		} else { // matchedTransaction.Quantity < remainingQuantity
 			// Case E
 
 			// add transaction history
-			_, err = serv.repo.CreateTransactionHistory(earliestTransaction)
+			_, err = serv.repo.CreateTransactionHistory(matchedTransaction)
 			if err != nil {
 				return nil, fmt.Errorf("Case(E), failed to creating transaction history: %v", err)
 			}
 
+			// add realized profit and loss
+			err = serv.repo.CreateRealizedPnL(model.NewRealizedPnL(matchedTransaction, newTransaction, matchedTransaction.Quantity,
+				newTransaction.Quantity-remainingQuantity))
+			if err != nil {
+				return nil, fmt.Errorf("Case(E), failed to creating realized pnl: %v", err)
+			}
+
 			// delete stock inventory
-			err = serv.repo.DeleteTransaction(earliestTransaction.ID)
+			err = serv.repo.DeleteTransaction(matchedTransaction.ID)
 			if err != nil {
 				return nil, fmt.Errorf("Case(E), failed to deleting transaction: %v", err)
 			}
 
-			remainingQuantity = remainingQuantity - earliestTransaction.Quantity
+			remainingQuantity = remainingQuantity - matchedTransaction.Quantity
 
 			return serv.addTransactionTailRecursion(newTransaction, remainingQuantity)
 		}
 	}
 }
 
-// AddTransaction add the transaction from the input to the inventory.
-// It will add or update transactions in the inventory and add history.
-// Return the modified transaction record in the inventory
-func (serv *service) AddTransaction(newTransaction *model.Transaction) (*model.Transaction, error) {
+// AddTransaction adds the transaction to the ledger as an entry of source,
+// e.g. model.SourceCLI, and to the inventory, so a rebuild keeps it. It
+// returns the modified transaction record in the inventory. A transaction
+// before the last entry of its stock in the ledger, or before one of its
+// corporate actions, rebuilds the records and the inventory of the stock from
+// the ledger instead, from the date of the transaction, and returns rebuilt
+// with no record.
+func (serv *service) AddTransaction(newTransaction *model.Transaction, source model.RecordSource) (t *model.Transaction, rebuilt bool, err error) {
 	tx := serv.repo.Begin()
+	s := serv.WithTrx(tx)
 
-	remainingQuantity := newTransaction.Quantity
-	ts, err := serv.WithTrx(tx).addTransactionTailRecursion(newTransaction, remainingQuantity)
+	backdated, err := s.isBackdated(newTransaction.StockNo, newTransaction.Date, newTransaction.Time)
 	if err != nil {
 		serv.repo.WithTrx(tx).Rollback()
-		return nil, fmt.Errorf("failed to add transaction: %v", err)
+		return nil, false, fmt.Errorf("failed to add transaction: %w", err)
+	}
+	if backdated && len(newTransaction.LotIDs) > 0 {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, false, fmt.Errorf("lots can't be referenced by a transaction before the last one or a corporate action of %s",
+			newTransaction.StockNo)
+	}
+
+	tr := model.NewTransactionRecord(newTransaction.Date, newTransaction.Time, newTransaction.StockNo,
+		newTransaction.TranType, newTransaction.Quantity, newTransaction.UnitPrice)
+	err = s.addLedgerEntry(tr, source, nil)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, false, fmt.Errorf("failed to add transaction: %w", err)
+	}
+
+	if backdated {
+		_, err = s.rebuildStock("", newTransaction.StockNo, newTransaction.Date)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, false, fmt.Errorf("failed to add transaction: %w", err)
+		}
+		serv.repo.WithTrx(tx).Commit()
+
+		return nil, true, nil
+	}
+
+	t, err = s.addTransaction(newTransaction)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, false, fmt.Errorf("failed to add transaction: %w", err)
 	}
 	serv.repo.WithTrx(tx).Commit()
 
-	return ts, nil
+	return t, false, nil
+}
+
+// addLedgerEntry adds the record to the ledger as an entry of source, named
+// by the stock mapping, and to the records, in the database transaction of
+// the caller. The inventory is left to the caller.
+func (serv *service) addLedgerEntry(tr *model.TransactionRecord, source model.RecordSource, batchID *int) error {
+	// The ledger is keyed by the time of the trades
+	entries, err := serv.repo.QueryLedger(tr.Date, tr.Date, "")
+	if err != nil {
+		return fmt.Errorf("failed to querying ledger: %v", err)
+	}
+	for _, e := range entries {
+		if e.Time == tr.Time && !e.Source.IsCorporateAction() {
+			return fmt.Errorf("the ledger has a transaction of %s on %s %s already", e.StockNo, e.Date, e.Time)
+		}
+	}
+
+	stockName := "N/A"
+	sm, err := serv.repo.FindStockMapping(tr.StockNo)
+	if err == nil {
+		stockName = sm.StockName
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("failed to querying stock mapping: %v", err)
+	}
+
+	entry := model.NewLedgerEntry(tr.Date, tr.Time, tr.StockNo, stockName, tr.TranType, tr.Quantity, tr.UnitPrice, source)
+	entry.BatchID = batchID
+	err = serv.repo.CreateLedgerEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to creating ledger entry: %v", err)
+	}
+
+	err = serv.repo.CreateTransactionRecordSys(&entry.TransactionRecord)
+	if err != nil {
+		return fmt.Errorf("failed to creating transaction record: %v", err)
+	}
+
+	return nil
+}
+
+// isBackdated tells whether a trade of the stock on date and tranTime is
+// before the last entry of the stock in the ledger, including the records of
+// the corporate actions, or before one of its ex-dividend or capital
+// reduction dates, including the capital reductions renaming a stock to it.
+// Adding such a trade to the end of the inventory would differ from replaying
+// the ledger.
+func (serv *service) isBackdated(stockNo, date, tranTime string) (bool, error) {
+	entries, err := serv.repo.QueryLedger(date, "", stockNo)
+	if err != nil {
+		return false, fmt.Errorf("failed to querying ledger: %v", err)
+	}
+	for _, e := range entries {
+		if e.Date > date || (e.Date == date && e.Time > tranTime) {
+			return true, nil
+		}
+	}
+
+	eds, err := serv.repo.QueryDividendAll()
+	if err != nil {
+		return false, fmt.Errorf("failed to querying dividends: %v", err)
+	}
+	for _, ed := range eds {
+		if ed.StockNo == stockNo && ed.ExDividendDate > date {
+			return true, nil
+		}
+	}
+
+	crs, err := serv.repo.QueryCapitalReductionAll()
+	if err != nil {
+		return false, fmt.Errorf("failed to querying capital reductions: %v", err)
+	}
+	for _, cr := range crs {
+		if (cr.StockNo == stockNo || cr.DistributedStockNo() == stockNo) && cr.CapitalReductionDate > date {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// addTransaction adds the transaction to the inventory, in the database
+// transaction of the caller.
+func (serv *service) addTransaction(newTransaction *model.Transaction) (*model.Transaction, error) {
+	err := serv.checkOversell(newTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	lots, err := serv.checkLots(newTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	err = serv.markDayTrade(newTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	err = serv.recordLedgerFee(newTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	err = serv.recordLedgerLots(newTransaction, lots)
+	if err != nil {
+		return nil, err
+	}
+
+	remainingQuantity := newTransaction.Quantity
+	return serv.addTransactionTailRecursion(newTransaction, remainingQuantity)
+}
+
+// recordLedgerFee records the fee and taxes charged on the transaction in its
+// entry of the ledger, in the database transaction of the caller.
+func (serv *service) recordLedgerFee(t *model.Transaction) error {
+	err := serv.repo.UpdateLedgerEntryFee(t.Date, t.Time, t.StockNo, t.Fee, t.Taxes)
+	if err != nil {
+		return fmt.Errorf("failed to updating ledger entry: %v", err)
+	}
+
+	return nil
+}
+
+// recordLedgerLots records the cost basis method of the transaction, and the
+// lots it writes off by their acquisition times, in its entry of the ledger,
+// in the database transaction of the caller.
+func (serv *service) recordLedgerLots(t *model.Transaction, lots []string) error {
+	err := serv.repo.UpdateLedgerEntryLots(t.Date, t.Time, t.StockNo, serv.lotMatcher.Method(), model.FormatLotRefs(lots))
+	if err != nil {
+		return fmt.Errorf("failed to updating ledger entry: %v", err)
+	}
+
+	return nil
 }
 
 // ---
 
-func (serv *service) DeleteTransaction(id int) error {
-	return serv.repo.DeleteTransaction(id)
+// DeleteTransaction deletes the trade of the ledger that opened the lot of
+// the inventory ID, and rebuilds the records and the inventory of its stock
+// from its date, all or nothing, so a later rebuild doesn't undo it. It
+// returns the entry deleted, or model.ErrNotFound if there is no such lot.
+func (serv *service) DeleteTransaction(id int) (*model.LedgerEntry, error) {
+	tx := serv.repo.Begin()
+	s := serv.WithTrx(tx)
+
+	entry, err := s.lotLedgerEntry(id)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, err
+	}
+
+	err = s.repo.DeleteLedgerEntry(entry.Date, entry.Time)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to deleting ledger entry: %w", err)
+	}
+
+	_, err = s.rebuildStock("", entry.StockNo, entry.Date)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to rebuilding %s: %w", entry.StockNo, err)
+	}
+	serv.repo.WithTrx(tx).Commit()
+
+	return entry, nil
+}
+
+// UpdateTransaction sets the unit price of the trade of the ledger that
+// opened the lot of the inventory ID, charged the fee and taxes of the
+// schedules again, and rebuilds the records and the inventory of its stock
+// from its date, all or nothing. It returns the entry before the update, or
+// model.ErrNotFound if there is no such lot.
+func (serv *service) UpdateTransaction(id int, unitPrice model.Decimal) (*model.LedgerEntry, error) {
+	tx := serv.repo.Begin()
+	s := serv.WithTrx(tx)
+
+	entry, err := s.lotLedgerEntry(id)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, err
+	}
+
+	err = s.repo.UpdateLedgerEntryUnitPrice(entry.Date, entry.Time, unitPrice)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to updating ledger entry: %w", err)
+	}
+
+	_, err = s.rebuildStock("", entry.StockNo, entry.Date)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to rebuilding %s: %w", entry.StockNo, err)
+	}
+	serv.repo.WithTrx(tx).Commit()
+
+	return entry, nil
+}
+
+// lotLedgerEntry returns the trade of the ledger that opened the lot of the
+// inventory ID, the one at the acquisition date and time of the lot, which
+// the lots reduced by a capital reduction keep. The lots of a stock dividend
+// have no trade.
+func (serv *service) lotLedgerEntry(id int) (*model.LedgerEntry, error) {
+	lot, err := serv.repo.QueryTransactionByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying lot %d: %w", id, err)
+	}
+
+	entries, err := serv.repo.QueryLedger(lot.Date, lot.Date, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to querying ledger: %v", err)
+	}
+	for _, e := range entries {
+		if e.Time == lot.Time && !e.Source.IsCorporateAction() {
+			return e, nil
+		}
+	}
+
+	return nil, fmt.Errorf("lot %d of %s on %s %s has no trade in the ledger, e.g. shares of a stock dividend",
+		id, lot.StockNo, lot.Date, lot.Time)
 }
 
 func (serv *service) QueryTransactionAll() ([]*model.Transaction, error) {
@@ -179,15 +727,187 @@ func (serv *service) QueryTransactionAll() ([]*model.Transaction, error) {
 }
 
 func (serv *service) QueryTransactionByID(id int) (*model.Transaction, error) {
-	return serv.repo.QueryTransactionByID(id)
+	t, err := serv.repo.QueryTransactionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	t.FeeSchedule = serv.feeSchedule
+	t.TaxSchedule = serv.taxSchedule
+	return t, nil
 }
 
 func (serv *service) QueryTransactionByDetails(stockNo string, tranType int, date string) ([]*model.Transaction, error) {
 	return serv.repo.QueryTransactionByDetails(stockNo, tranType, date)
 }
 
-func (serv *service) UpdateTransaction(id int, t *model.Transaction) error {
-	return serv.repo.UpdateTransaction(id, t)
+// ImportLedgerEntries adds the entries of the file of batch to the
+// transaction ledger, and the names of their stocks to the stock mapping, all
+// or nothing. A file imported before is rejected. The entries timed by the
+// importer are timed after the entries of the ledger on their date, and
+// recorded with the cost basis method of the service; the records and the
+// inventory of their stocks are rebuilt from the earliest entry of each. A
+// dry run reports the same without changing the database.
+func (serv *service) ImportLedgerEntries(batch *model.ImportBatch, entries []*model.LedgerEntry, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Rebuilt: true}
+
+	tx := serv.repo.Begin()
+	s := serv.WithTrx(tx)
+
+	imported, err := s.repo.FindImportBatchByFileHash(batch.FileHash)
+	if err == nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("file already imported as batch %d '%s' at %s", imported.ID, imported.FileName, imported.ImportedAt)
+	}
+	if !errors.Is(err, model.ErrNotFound) {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to querying import batch: %v", err)
+	}
+
+	before, err := s.summarizeInventory()
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+
+	batch.RowCount = len(entries)
+	batchID, err := s.repo.CreateImportBatch(batch)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to creating import batch: %v", err)
+	}
+
+	stockNames := map[string]string{}
+	for _, entry := range entries {
+		stockNames[entry.StockNo] = entry.StockName
+	}
+	for stockNo, stockName := range stockNames {
+		sm := &model.StockMapping{StockNo: stockNo, StockName: stockName, InstrumentType: model.InferInstrumentType(stockNo)}
+		err := s.repo.UpsertStockMapping(sm)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to upserting stock mapping of %s: %v", stockNo, err)
+		}
+	}
+
+	trs := make([]*model.TransactionRecord, len(entries))
+	for i, entry := range entries {
+		trs[i] = &entry.TransactionRecord
+	}
+	err = s.retimeImported(trs)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, err
+	}
+
+	earliest := map[string]string{}
+	for _, entry := range entries {
+		entry.BatchID = &batchID
+		entry.CostBasis = serv.lotMatcher.Method()
+		err := s.repo.CreateLedgerEntry(entry)
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to creating ledger entry of %s on %s %s: %v", entry.StockNo, entry.Date, entry.Time, err)
+		}
+		report.Added = append(report.Added, &entry.TransactionRecord)
+
+		if date, ok := earliest[entry.StockNo]; !ok || entry.Date < date {
+			earliest[entry.StockNo] = entry.Date
+		}
+	}
+
+	stockNos := make([]string, 0, len(earliest))
+	for stockNo := range earliest {
+		stockNos = append(stockNos, stockNo)
+	}
+	sort.Strings(stockNos)
+
+	for _, stockNo := range stockNos {
+		_, err = s.rebuildStock("", stockNo, earliest[stockNo])
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to rebuilding %s: %w", stockNo, err)
+		}
+	}
+
+	for _, stockNo := range stockNos {
+		lots, err := s.repo.QueryTransactionByDetails(stockNo, 0, "")
+		if err != nil {
+			serv.repo.WithTrx(tx).Rollback()
+			return nil, fmt.Errorf("failed to querying inventory: %v", err)
+		}
+		report.Transactions = append(report.Transactions, lots...)
+	}
+
+	after, err := s.summarizeInventory()
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return nil, fmt.Errorf("failed to querying inventory: %v", err)
+	}
+	report.Changes = diffInventory(before, after, report.Added)
+
+	if dryRun {
+		serv.repo.WithTrx(tx).Rollback()
+	} else {
+		serv.repo.WithTrx(tx).Commit()
+	}
+
+	return report, nil
+}
+
+// QueryImportBatchAll queries the import batches in the order imported.
+func (serv *service) QueryImportBatchAll() ([]*model.ImportBatch, error) {
+	return serv.repo.QueryImportBatchAll()
+}
+
+// RevertImportBatch removes the ledger entries imported by the batch and the
+// batch itself, then rebuilds the records and the inventory without them,
+// all or nothing.
+func (serv *service) RevertImportBatch(id int) error {
+	tx := serv.repo.Begin()
+
+	err := serv.repo.WithTrx(tx).DeleteImportBatch(id)
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return fmt.Errorf("failed to deleting import batch %d: %w", id, err)
+	}
+
+	err = serv.WithTrx(tx).rebuild()
+	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
+		return err
+	}
+
+	serv.repo.WithTrx(tx).Commit()
+
+	return nil
+}
+
+// QueryLedger queries the ledger merged with the records generated by the
+// corporate actions, ordered by time, between the dates from and to,
+// inclusive, of stockNo. Empty conditions are ignored.
+func (serv *service) QueryLedger(from, to, stockNo string) ([]*model.LedgerEntry, error) {
+	return serv.repo.QueryLedger(from, to, stockNo)
+}
+
+// ledgerRecords returns the records of the ledger entries, with or without
+// the ones generated by the corporate actions.
+func ledgerRecords(entries []*model.LedgerEntry, withCorporateActions bool) []*model.TransactionRecord {
+	trs := make([]*model.TransactionRecord, 0, len(entries))
+	for _, e := range entries {
+		if e.Source.IsCorporateAction() && !withCorporateActions {
+			continue
+		}
+		tr := e.TransactionRecord
+		trs = append(trs, &tr)
+	}
+	return trs
+}
+
+// QueryRealizedPnL queries the realized profit and loss of the trades closed
+// between the dates from and to, inclusive, of stockNo. Empty conditions are
+// ignored.
+func (serv *service) QueryRealizedPnL(from, to, stockNo string) ([]*model.RealizedPnL, error) {
+	return serv.repo.QueryRealizedPnL(from, to, stockNo)
 }
 
 // ---
@@ -217,25 +937,125 @@ func mergeAndSort(exDividends []*model.ExDividend, capitalReductions []*model.Ca
 	return mergedList
 }
 
+// RebuildTransactionRecordSys regenerates tblTransactionRecordSys and
+// tblTransactionCash from the ledger and the corporate actions.
 func (serv *service) RebuildTransactionRecordSys() error {
+	tx := serv.repo.Begin()
 
-	eds, err := serv.repo.QueryDividendAll()
+	err := serv.WithTrx(tx).rebuildTransactionRecordSys()
 	if err != nil {
+		serv.repo.WithTrx(tx).Rollback()
 		return err
 	}
+	serv.repo.WithTrx(tx).Commit()
 
-	crs, err := serv.repo.QueryCapitalReductionAll()
+	return nil
+}
+
+// rebuildTransactionRecordSys regenerates the records in the database
+// transaction of the caller.
+func (serv *service) rebuildTransactionRecordSys() error {
+	trs, cashDividends, err := serv.calcTransactionRecordSys("")
 	if err != nil {
 		return err
 	}
 
-	trs, err := serv.repo.QueryTransactionRecordAll()
+	err = serv.replaceCashDividends(cashDividends)
 	if err != nil {
 		return err
 	}
 
-	mergedList := mergeAndSort(eds, crs)
+	return serv.replaceTransactionRecordSys(trs)
+}
+
+// calcTransactionRecordSys replays the ledger of the stock, or of all the
+// stocks if stockNo is empty, through the corporate actions, and returns the
+// records, including the ones generated by the capital reductions and stock
+// dividends, and the cash dividends.
+func (serv *service) calcTransactionRecordSys(stockNo string) ([]*model.TransactionRecord, []*model.ExDividend, error) {
+	eds, err := serv.repo.QueryDividendAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crs, err := serv.repo.QueryCapitalReductionAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A stock renamed by a capital reduction is replayed with its new stock
+	// number, the records distributed go on under the new one.
+	families := newStockFamilies(crs)
+
+	var ledger []*model.LedgerEntry
+	if stockNo == "" {
+		ledger, err = serv.repo.QueryLedger("", "", "")
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		for _, member := range families.members(stockNo) {
+			entries, err := serv.repo.QueryLedger("", "", member)
+			if err != nil {
+				return nil, nil, err
+			}
+			ledger = append(ledger, entries...)
+		}
+	}
+
+	// The corporate actions of a stock replay its records only, so each
+	// stock is replayed apart rather than all the records for each action.
+	recordsByStock := map[string][]*model.TransactionRecord{}
+	for _, tr := range ledgerRecords(ledger, false) { // the corporate actions are regenerated
+		root := families.root(tr.StockNo)
+		recordsByStock[root] = append(recordsByStock[root], tr)
+	}
+	actionsByStock := map[string][]*DividendOrReduction{}
+	for _, o := range mergeAndSort(eds, crs) {
+		var actionStockNo string
+		switch obj := o.Obj.(type) {
+		case *model.CapitalReduction:
+			actionStockNo = obj.StockNo
+		case *model.ExDividend:
+			actionStockNo = obj.StockNo
+		}
+		root := families.root(actionStockNo)
+		if stockNo == "" || root == families.root(stockNo) {
+			actionsByStock[root] = append(actionsByStock[root], o)
+		}
+	}
+
+	var trs []*model.TransactionRecord
+	var cashDividends []*model.ExDividend
+	for s, stockTrs := range recordsByStock {
+		if _, ok := actionsByStock[s]; !ok {
+			trs = append(trs, stockTrs...)
+		}
+	}
+	for s, actions := range actionsByStock {
+		sortRecords(recordsByStock[s]) // of the stocks of the family
+		stockTrs, stockCashDividends, err := serv.calcStockRecordSys(recordsByStock[s], actions)
+		if err != nil {
+			return nil, nil, err
+		}
+		trs = append(trs, stockTrs...)
+		cashDividends = append(cashDividends, stockCashDividends...)
+	}
+
+	sortRecords(trs)
+	sort.SliceStable(cashDividends, func(i, j int) bool {
+		if cashDividends[i].ExDividendDate != cashDividends[j].ExDividendDate {
+			return cashDividends[i].ExDividendDate < cashDividends[j].ExDividendDate
+		}
+		return cashDividends[i].StockNo < cashDividends[j].StockNo
+	})
+
+	return trs, cashDividends, nil
+}
 
+// calcStockRecordSys replays the records of a stock through its corporate
+// actions, ordered by date.
+func (serv *service) calcStockRecordSys(trs []*model.TransactionRecord, mergedList []*DividendOrReduction) ([]*model.TransactionRecord, []*model.ExDividend, error) {
 	var cashDividends []*model.ExDividend
 	for _, o := range mergedList {
 		var filteredRecords []*model.TransactionRecord
@@ -251,16 +1071,20 @@ func (serv *service) RebuildTransactionRecordSys() error {
 				}
 			}
 
-			remainingTrs, err := model.CalcRemainingTransactionRecords(filteredRecords)
+			remainingTrs, err := serv.calcRemainingTransactionRecords(filteredRecords)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
+			remainingTrs = longLots(remainingTrs) // a short position is not reduced
 
-			totalQuantity, avgUnitPrice := model.SumQuantityUnitPrice(remainingTrs)
-
-			capitalReductionRecord, distributionRecord := cr.CalcTransactionRecords(totalQuantity, avgUnitPrice)
+			// Each lot is reduced apart, keeping its cost
+			trs = append(trs, cr.CalcTransactionRecords(remainingTrs)...)
 
-			trs = append(trs, capitalReductionRecord, distributionRecord)
+			quantities := make([]int, len(remainingTrs))
+			for i, lot := range remainingTrs {
+				quantities[i] = lot.Quantity
+			}
+			cashDividends = append(cashDividends, cr.CalcCashRecord(quantities))
 		case *model.ExDividend:
 			ed := obj
 			for _, record := range trs {
@@ -271,100 +1095,278 @@ func (serv *service) RebuildTransactionRecordSys() error {
 				}
 			}
 
-			remainingTrs, err := model.CalcRemainingTransactionRecords(filteredRecords)
+			remainingTrs, err := serv.calcRemainingTransactionRecords(filteredRecords)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 
-			totalQuantity, _ := model.SumQuantityUnitPrice(remainingTrs)
+			// A short position is paid no dividend
+			totalQuantity, _ := model.SumQuantityUnitPrice(longLots(remainingTrs))
 
-			// TODO: need to calc stock dividend record and append to newTrs
 			cd := ed.CalcCashDividendRecord(totalQuantity)
 
 			cashDividends = append(cashDividends, cd)
+
+			distributionRecord := ed.CalcTransactionRecords(totalQuantity)
+			if distributionRecord != nil {
+				trs = append(trs, distributionRecord)
+			}
 		}
 
-		sort.Slice(trs, func(i, j int) bool {
-			date1, _ := time.Parse("2006-01-02", trs[i].Date)
-			date2, _ := time.Parse("2006-01-02", trs[j].Date)
-			return date1.Before(date2)
-		})
+		sortRecords(trs)
 	}
 
-	tx := serv.repo.Begin()
+	return trs, cashDividends, nil
+}
 
-	err = serv.repo.WithTrx(tx).DropTable("tblTransactionCash")
-	if err != nil {
-		serv.repo.WithTrx(tx).Rollback()
-		return err
+// longLots returns the lots if they are long, or none if they are short.
+func longLots(lots []*model.TransactionRecord) []*model.TransactionRecord {
+	if len(lots) > 0 && lots[0].TranType < 0 {
+		return nil
 	}
+	return lots
+}
 
-	for _, cd := range cashDividends {
-		err = serv.repo.WithTrx(tx).CreateCashDividendRecord(cd)
-		if err != nil {
-			serv.repo.WithTrx(tx).Rollback()
-			return err
+// sortRecords sorts the records by time. It keeps the order of the records
+// on the same day, a sell must not be replayed before the buy it writes off.
+func sortRecords(trs []*model.TransactionRecord) {
+	sort.SliceStable(trs, func(i, j int) bool {
+		if trs[i].Date != trs[j].Date {
+			return trs[i].Date < trs[j].Date
+		}
+		return trs[i].Time < trs[j].Time
+	})
+}
+
+// sortLedger sorts the entries of the ledger by time, as sortRecords does.
+func sortLedger(entries []*model.LedgerEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
 		}
+		return entries[i].Time < entries[j].Time
+	})
+}
+
+// replaceCashDividends replaces the cash dividends of tblTransactionCash.
+func (serv *service) replaceCashDividends(cashDividends []*model.ExDividend) error {
+	err := serv.repo.DropTable("tblTransactionCash")
+	if err != nil {
+		return err
 	}
 
-	err = serv.repo.WithTrx(tx).DropTable("tblTransactionRecordSys")
+	return serv.repo.CreateCashDividendRecords(cashDividends)
+}
+
+// replaceTransactionRecordSys replaces the records of tblTransactionRecordSys.
+func (serv *service) replaceTransactionRecordSys(trs []*model.TransactionRecord) error {
+	err := serv.repo.DropTable("tblTransactionRecordSys")
 	if err != nil {
-		serv.repo.WithTrx(tx).Rollback()
 		return err
 	}
 
-	for _, tr := range trs {
-		err = serv.repo.WithTrx(tx).CreateTransactionRecordSys(tr)
-		if err != nil {
-			serv.repo.WithTrx(tx).Rollback()
-			return err
-		}
+	return serv.repo.CreateTransactionRecordSysBatch(trs)
+}
+
+// rebuild regenerates the records and the inventory from the ledger, in the
+// database transaction of the caller.
+func (serv *service) rebuild() error {
+	err := serv.rebuildTransactionRecordSys()
+	if err != nil {
+		return fmt.Errorf("failed to rebuilding records: %w", err)
 	}
 
-	serv.repo.WithTrx(tx).Commit()
+	err = serv.rebuildTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to rebuilding inventory: %w", err)
+	}
 
 	return nil
 }
 
+// RebuildTransaction regenerates the inventory, tblTransaction, and its
+// history and realized profit and loss from tblTransactionRecordSys.
 func (serv *service) RebuildTransaction() error {
 	tx := serv.repo.Begin()
 
-	err := serv.repo.WithTrx(tx).DropTable("sqlite_sequence")
+	err := serv.WithTrx(tx).rebuildTransaction()
 	if err != nil {
 		serv.repo.WithTrx(tx).Rollback()
+		return err
+	}
+	serv.repo.WithTrx(tx).Commit()
+
+	return nil
+}
+
+// rebuildTransaction regenerates the inventory in the database transaction
+// of the caller.
+func (serv *service) rebuildTransaction() error {
+	err := serv.repo.DropTable("sqlite_sequence")
+	if err != nil {
 		return fmt.Errorf("failed to deleting SQLiteSequence: %v", err)
 	}
 
-	err = serv.repo.WithTrx(tx).DropTable("tblTransaction")
+	err = serv.repo.DropTable("tblTransaction")
 	if err != nil {
-		serv.repo.WithTrx(tx).Rollback()
 		return fmt.Errorf("failed to deleting tblTransaction: %v", err)
 	}
 
-	err = serv.repo.WithTrx(tx).DropTable("tblTransactionHistory")
+	err = serv.repo.DropTable("tblTransactionHistory")
 	if err != nil {
-		serv.repo.WithTrx(tx).Rollback()
 		return fmt.Errorf("failed to deleting tblTransactionHistory: %v", err)
 	}
 
-	trs, err := serv.repo.WithTrx(tx).QueryTransactionRecordSysAll()
+	err = serv.repo.DropTable("tblRealizedPnL")
 	if err != nil {
-		serv.repo.WithTrx(tx).Rollback()
-		return fmt.Errorf("failed to querying TransactionRecord: %v", err)
+		return fmt.Errorf("failed to deleting tblRealizedPnL: %v", err)
+	}
+
+	ledger, err := serv.repo.QueryLedger("", "", "")
+	if err != nil {
+		return fmt.Errorf("failed to querying ledger: %v", err)
 	}
 
+	crs, err := serv.repo.QueryCapitalReductionAll()
+	if err != nil {
+		return fmt.Errorf("failed to querying capital reductions: %v", err)
+	}
+
+	return serv.replayRecords(ledger, crs)
+}
+
+// replayRecords adds the entries of the ledger to the inventory in order, in
+// the database transaction of the caller. The capital reductions are applied
+// to the lots held in place, before the entries on their date, and the
+// records generated from them are skipped.
+func (serv *service) replayRecords(trs []*model.LedgerEntry, crs []*model.CapitalReduction) error {
+	crs = append([]*model.CapitalReduction(nil), crs...)
+	sort.SliceStable(crs, func(i, j int) bool {
+		return crs[i].CapitalReductionDate < crs[j].CapitalReductionDate
+	})
+
+	var next int
 	for _, tr := range trs {
-		newTransaction := model.NewTransactionFromInput(
-			tr.Date, tr.Time, tr.StockNo, tr.TranType, tr.Quantity, tr.UnitPrice)
-		remainingQuantity := newTransaction.Quantity
-		_, err := serv.WithTrx(tx).addTransactionTailRecursion(newTransaction, remainingQuantity)
+		for ; next < len(crs) && crs[next].CapitalReductionDate <= tr.Date; next++ {
+			err := serv.applyCapitalReduction(crs[next])
+			if err != nil {
+				return err
+			}
+		}
+
+		if tr.Source == model.SourceCapitalReduction {
+			continue
+		}
+		err := serv.replayRecord(tr)
 		if err != nil {
-			serv.repo.WithTrx(tx).Rollback()
-			return fmt.Errorf("failed to adding transaction in tail recursion: %v", err)
+			return err
 		}
 	}
 
-	serv.repo.WithTrx(tx).Commit()
+	for ; next < len(crs); next++ {
+		err := serv.applyCapitalReduction(crs[next])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyCapitalReduction reduces the lots of the stock held in the inventory
+// in place, so each lot keeps its ID and acquisition date: its shares left
+// and cost less the cash refunded, under the new stock number if the stock is
+// renamed. The lot before is added to the history, linking the old stock
+// number to the lot. A lot with no share left is deleted.
+func (serv *service) applyCapitalReduction(cr *model.CapitalReduction) error {
+	lots, err := serv.repo.QueryTransactionByDetails(cr.StockNo, 1, "")
+	if err != nil {
+		return fmt.Errorf("failed to querying lots: %v", err)
+	}
+
+	quantities := make([]int, len(lots))
+	for i, lot := range lots {
+		quantities[i] = lot.Quantity
+	}
+	reduced, _ := cr.ReduceLots(quantities)
+
+	for i, lot := range lots {
+		_, err = serv.repo.CreateTransactionHistory(lot)
+		if err != nil {
+			return fmt.Errorf("failed to creating transaction history: %v", err)
+		}
+
+		if reduced[i] == 0 {
+			err = serv.repo.DeleteTransaction(lot.ID)
+			if err != nil {
+				return fmt.Errorf("failed to deleting transaction: %v", err)
+			}
+			continue
+		}
+
+		// The lot keeps the fee and taxes paid for it
+		lot.StockNo = cr.DistributedStockNo()
+		lot.Quantity = reduced[i]
+		lot.Reprice(cr.ReduceUnitPrice(lot.UnitPrice))
+		err = serv.repo.UpdateTransaction(lot.ID, lot)
+		if err != nil {
+			return fmt.Errorf("failed to updating transaction: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// replayRecord adds the entry of the ledger to the inventory, in the database
+// transaction of the caller. The trade is charged the fee and taxes recorded
+// on the entry, the ones of the schedules are only recorded if it has none,
+// and writes off the lots by the cost basis method and the lots recorded on
+// it, or by the one of the service if it has none.
+func (serv *service) replayRecord(tr *model.LedgerEntry) error {
+	newTransaction := model.NewTransactionFromInput(
+		tr.Date, tr.Time, tr.StockNo, tr.TranType, tr.Quantity, tr.UnitPrice, serv.feeSchedule, serv.taxSchedule)
+
+	err := serv.checkOversell(newTransaction)
+	if err != nil {
+		return fmt.Errorf("failed to rebuilding transaction: %w", err)
+	}
+
+	err = serv.markDayTrade(newTransaction)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case tr.Source.IsCorporateAction():
+	case tr.Fee != nil && tr.Taxes != nil:
+		newTransaction.Fee, newTransaction.Taxes = *tr.Fee, *tr.Taxes
+	default:
+		err = serv.recordLedgerFee(newTransaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	s := serv
+	if tr.CostBasis != "" {
+		lotMatcher, err := NewLotMatcher(tr.CostBasis)
+		if err != nil {
+			return fmt.Errorf("failed to rebuilding transaction: %w", err)
+		}
+		s = serv.WithLotMatcher(lotMatcher)
+	}
+	if refs := tr.LotRefs(); len(refs) > 0 {
+		newTransaction.LotIDs, err = serv.lotIDsAt(newTransaction, refs)
+		if err != nil {
+			return err
+		}
+	}
+
+	remainingQuantity := newTransaction.Quantity
+	_, err = s.addTransactionTailRecursion(newTransaction, remainingQuantity)
+	if err != nil {
+		return fmt.Errorf("failed to adding transaction in tail recursion: %v", err)
+	}
 
 	return nil
 }
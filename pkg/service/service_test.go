@@ -0,0 +1,1333 @@
+package service
+
+import (
+	"HermInvest/pkg/model"
+	"HermInvest/pkg/quote"
+	"HermInvest/pkg/repository"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService creates a service on a migrated database in a temporary
+// directory.
+func newTestService(t *testing.T) (*service, *gorm.DB) {
+	t.Helper()
+
+	db, err := repository.OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	if _, err := repository.Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	return NewService(repository.NewRepository(db), nil, nil, nil), db
+}
+
+// newTestBatch creates an import batch of the CSV file.
+func newTestBatch(fileName string) *model.ImportBatch {
+	return &model.ImportBatch{FileName: fileName, FileHash: fileName, Format: "csv", ImportedAt: "2024-12-31 12:00:00"}
+}
+
+func TestRebuildWithCashAndStockDividends(t *testing.T) {
+	serv, db := newTestService(t)
+
+	err := db.Exec(`INSERT INTO tblTransactionRecord (date, time, stockNo, stockName, tranType, quantity, unitPrice, source) VALUES
+		('2024-01-02', '09:00:00', '2330', '台積電', 1, 1000, 500, 1),
+		('2024-03-01', '09:00:00', '2330', '台積電', 1, 500, 600, 1),
+		('2024-08-01', '09:00:00', '2330', '台積電', -1, 1000, 700, 1)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert records: %v", err)
+	}
+	err = db.Exec(`INSERT INTO tblDividend VALUES
+		('2024Q2', '2330', '2024-06-13', '2024-07-11', 3, 0.5),
+		('2024Q3', '2330', '2024-09-01', '2024-09-20', 1.5, 0.3)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert dividends: %v", err)
+	}
+
+	if err := serv.RebuildTransactionRecordSys(); err != nil {
+		t.Fatalf("RebuildTransactionRecordSys() error = %v", err)
+	}
+	if err := serv.RebuildTransaction(); err != nil {
+		t.Fatalf("RebuildTransaction() error = %v", err)
+	}
+
+	// 1500 shares: 75 shares and 4500 in cash. After selling the first 1000
+	// shares, 575 shares: 17.25 shares and 862.5 in cash, the 0.25 share is
+	// paid 2 at par value.
+	var cashDividends []*model.ExDividend
+	if err := db.Table("tblTransactionCash").Order("exDividendDate").Find(&cashDividends).Error; err != nil {
+		t.Fatalf("failed to query cash dividends: %v", err)
+	}
+	wantCash := []struct{ quantity, totalAmount int }{{1500, 4500}, {575, 864}}
+	if len(cashDividends) != len(wantCash) {
+		t.Fatalf("got %d cash dividends, want %d", len(cashDividends), len(wantCash))
+	}
+	for i, want := range wantCash {
+		if cashDividends[i].Quantity != want.quantity || cashDividends[i].TotalAmount != want.totalAmount {
+			t.Errorf("cash dividend %d = %d for %d shares, want %d for %d shares", i,
+				cashDividends[i].TotalAmount, cashDividends[i].Quantity, want.totalAmount, want.quantity)
+		}
+	}
+
+	inventory, err := serv.QueryTransactionByDetails("2330", 0, "")
+	if err != nil {
+		t.Fatalf("QueryTransactionByDetails() error = %v", err)
+	}
+	quantity, totalAmount := 0, model.DecimalZero
+	for _, lot := range inventory {
+		quantity += lot.Quantity
+		totalAmount = totalAmount.Add(lot.TotalAmount)
+	}
+
+	// The distributed shares cost nothing, the 500 shares bought at 600 keep
+	// the cost of the holding.
+	if quantity != 592 || totalAmount.Cmp(model.NewDecimalFromInt(300000)) != 0 {
+		t.Errorf("inventory = %d shares costing %s, want 592 shares costing 300000", quantity, totalAmount)
+	}
+
+	// The stock dividends are merged into the ledger in time order.
+	ledger, err := serv.QueryLedger("", "", "2330")
+	if err != nil {
+		t.Fatalf("QueryLedger() error = %v", err)
+	}
+	wantSources := []model.RecordSource{
+		model.SourceManual, model.SourceManual, model.SourceCorporateAction, model.SourceManual, model.SourceCorporateAction,
+	}
+	if len(ledger) != len(wantSources) {
+		t.Fatalf("got %d ledger entries, want %d", len(ledger), len(wantSources))
+	}
+	for i, want := range wantSources {
+		if ledger[i].Source != want {
+			t.Errorf("ledger entry %d on %s from %s, want %s", i, ledger[i].Date, ledger[i].Source, want)
+		}
+	}
+	if ledger[2].Quantity != 75 {
+		t.Errorf("ledger entry 2 = %d shares, want 75 shares", ledger[2].Quantity)
+	}
+}
+
+func TestStockDividendCostBasis(t *testing.T) {
+	// 1000 shares at 500, a stock dividend of 1 distributes 100 shares at
+	// zero cost, then 100 shares are sold
+	for _, tc := range []struct {
+		matcher  LotMatcher
+		buyDate  string
+		wantCost string
+	}{
+		{fifoMatcher{}, "2024-01-02", "50000.00"},
+		{lifoMatcher{}, "2024-07-11", "0.00"},
+		{averageMatcher{}, "2024-01-02", "45454.55"},
+	} {
+		t.Run(tc.matcher.Method(), func(t *testing.T) {
+			serv, db := newTestService(t)
+			serv = serv.WithLotMatcher(tc.matcher)
+
+			err := db.Exec(`INSERT INTO tblTransactionRecord (date, time, stockNo, stockName, tranType, quantity, unitPrice, source) VALUES
+				('2024-01-02', '09:00:00', '2330', '台積電', 1, 1000, 500, 1),
+				('2024-08-01', '09:00:00', '2330', '台積電', -1, 100, 600, 1)`).Error
+			if err != nil {
+				t.Fatalf("failed to insert records: %v", err)
+			}
+			err = db.Exec(`INSERT INTO tblDividend VALUES ('2024Q2', '2330', '2024-06-13', '2024-07-11', 0, 1)`).Error
+			if err != nil {
+				t.Fatalf("failed to insert dividends: %v", err)
+			}
+			if err := serv.RebuildTransactionRecordSys(); err != nil {
+				t.Fatalf("RebuildTransactionRecordSys() error = %v", err)
+			}
+			if err := serv.RebuildTransaction(); err != nil {
+				t.Fatalf("RebuildTransaction() error = %v", err)
+			}
+
+			pnls, err := serv.QueryRealizedPnL("", "", "2330")
+			if err != nil || len(pnls) != 1 {
+				t.Fatalf("QueryRealizedPnL() = %d, %v, want 1", len(pnls), err)
+			}
+			if pnl := pnls[0]; pnl.BuyDate != tc.buyDate || pnl.Cost.StringFixed(2) != tc.wantCost {
+				t.Errorf("realized = %d shares of %s costing %s, want of %s costing %s",
+					pnl.Quantity, pnl.BuyDate, pnl.Cost.StringFixed(2), tc.buyDate, tc.wantCost)
+			}
+		})
+	}
+}
+
+func TestAddTransactionOversell(t *testing.T) {
+	serv, db := newTestService(t)
+
+	buy := model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil)
+	if _, _, err := serv.AddTransaction(buy, model.SourceCLI); err != nil {
+		t.Fatalf("AddTransaction(buy) error = %v", err)
+	}
+
+	sell := model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", -1, 1500, model.NewDecimalFromInt(600), nil, nil)
+	_, _, err := serv.AddTransaction(sell, model.SourceCLI)
+	var oversellErr *model.OversellError
+	if !errors.As(err, &oversellErr) || oversellErr.Held != 1000 || oversellErr.Requested != 1500 {
+		t.Fatalf("AddTransaction(oversell) error = %v, want an OversellError of 1500 held 1000", err)
+	}
+
+	inconsistencies, err := serv.CheckConsistency()
+	if err != nil || len(inconsistencies) != 0 {
+		t.Fatalf("CheckConsistency() = %v, %v, want none after a rejected oversell", inconsistencies, err)
+	}
+
+	short, _, err := serv.WithAllowShort(true).AddTransaction(sell, model.SourceCLI)
+	if err != nil {
+		t.Fatalf("AddTransaction(short) error = %v", err)
+	}
+	if short == nil || short.TranType != -1 || short.Quantity != 500 {
+		t.Fatalf("AddTransaction(short) = %+v, want a short lot of 500 shares", short)
+	}
+
+	// The short sale is in the inventory and the ledger
+	inconsistencies, err = serv.CheckConsistency()
+	if err != nil || len(inconsistencies) != 2 || inconsistencies[0].Table != "tblTransaction" || inconsistencies[0].ID != short.ID ||
+		inconsistencies[1].Table != "tblTransactionRecord" {
+		t.Fatalf("CheckConsistency() = %v, %v, want the short lot %d and its record", inconsistencies, err, short.ID)
+	}
+
+	// A buy covers the short lot first, the dividend after it is paid for the
+	// 300 shares left in the inventory, not for the 800 bought
+	cover := model.NewTransactionFromInput("2024-01-05", "09:00:00", "2330", 1, 800, model.NewDecimalFromInt(550), nil, nil)
+	if _, _, err := serv.AddTransaction(cover, model.SourceCLI); err != nil {
+		t.Fatalf("AddTransaction(cover) error = %v", err)
+	}
+	err = db.Exec(`INSERT INTO tblDividend VALUES ('2024Q1', '2330', '2024-01-10', '2024-01-20', 3, 0)`).Error
+	if err != nil {
+		t.Fatalf("insert dividend error = %v", err)
+	}
+	if _, err := serv.WithAllowShort(true).Rebuild("", RebuildScope{}, func(*RebuildReport) bool { return true }); err != nil {
+		t.Fatalf("Rebuild(allow short) error = %v", err)
+	}
+
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 1 || inventory[0].TranType != 1 || inventory[0].Quantity != 300 {
+		t.Fatalf("QueryTransactionAll() = %+v, %v, want a lot of 300 shares", inventory, err)
+	}
+	cashDividends, err := serv.repo.QueryCashDividendAll()
+	if err != nil || len(cashDividends) != 1 || cashDividends[0].Quantity != 300 || cashDividends[0].TotalAmount != 900 {
+		t.Fatalf("QueryCashDividendAll() = %+v, %v, want 900 for the 300 shares held", cashDividends, err)
+	}
+	inconsistencies, err = serv.CheckConsistency()
+	if err != nil || len(inconsistencies) != 1 || inconsistencies[0].Table != "tblTransactionRecord" {
+		t.Fatalf("CheckConsistency() = %v, %v, want the record of the short sale only", inconsistencies, err)
+	}
+}
+
+func TestAddTransactionToLedger(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	buy := model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil)
+	lot, _, err := serv.AddTransaction(buy, model.SourceCLI)
+	if err != nil || lot == nil {
+		t.Fatalf("AddTransaction(buy) = %+v, %v, want a lot", lot, err)
+	}
+
+	// A back-dated sell rebuilds the inventory: the lot of the earlier buy
+	// is written off first.
+	earlier := model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(400), nil, nil)
+	sell := model.NewTransactionFromInput("2024-01-02", "10:00:00", "2330", -1, 1000, model.NewDecimalFromInt(450), nil, nil)
+	for _, tr := range []*model.Transaction{earlier, sell} {
+		_, rebuilt, err := serv.AddTransaction(tr, model.SourceWeb)
+		if err != nil || !rebuilt {
+			t.Fatalf("AddTransaction(%s %s) = %v, %v, want a rebuild", tr.Date, tr.Time, rebuilt, err)
+		}
+	}
+
+	dup := model.NewTransactionFromInput("2024-01-02", "09:00:00", "0050", 1, 1000, model.NewDecimalFromInt(100), nil, nil)
+	if _, _, err := serv.AddTransaction(dup, model.SourceCLI); err == nil {
+		t.Fatalf("AddTransaction() at the time of another transaction succeeded, want an error")
+	}
+
+	if err := serv.RebuildTransactionRecordSys(); err != nil {
+		t.Fatalf("RebuildTransactionRecordSys() error = %v", err)
+	}
+	if err := serv.RebuildTransaction(); err != nil {
+		t.Fatalf("RebuildTransaction() error = %v", err)
+	}
+
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 1 || inventory[0].Date != "2024-01-03" || inventory[0].Quantity != 1000 {
+		t.Fatalf("inventory after a rebuild = %+v, %v, want the 1000 shares bought on 2024-01-03", inventory, err)
+	}
+
+	ledger, err := serv.QueryLedger("", "", "")
+	if err != nil || len(ledger) != 3 || ledger[0].Source != model.SourceWeb || ledger[2].Source != model.SourceCLI {
+		t.Fatalf("QueryLedger() = %+v, %v, want 2 entries from the web and 1 from the CLI", ledger, err)
+	}
+}
+
+func TestRebuildRecordedLots(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	for i, price := range []int{10, 20, 30} {
+		buy := model.NewTransactionFromInput(fmt.Sprintf("2024-01-0%d", i+2), "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(price), nil, nil)
+		if _, _, err := serv.AddTransaction(buy, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", buy.Date, err)
+		}
+	}
+	lots, err := serv.QueryTransactionAll()
+	if err != nil || len(lots) != 3 {
+		t.Fatalf("QueryTransactionAll() = %d lots, %v, want 3", len(lots), err)
+	}
+
+	// A sell of the lot bought at 20, and one of the latest lot
+	sell := model.NewTransactionFromInput("2024-01-05", "09:00:00", "2330", -1, 500, model.NewDecimalFromInt(40), nil, nil)
+	sell.LotIDs = []int{lots[1].ID}
+	if _, _, err := serv.WithLotMatcher(specificMatcher{}).AddTransaction(sell, model.SourceCLI); err != nil {
+		t.Fatalf("AddTransaction(specific lot) error = %v", err)
+	}
+	sell = model.NewTransactionFromInput("2024-01-08", "09:00:00", "2330", -1, 500, model.NewDecimalFromInt(40), nil, nil)
+	if _, _, err := serv.WithLotMatcher(lifoMatcher{}).AddTransaction(sell, model.SourceCLI); err != nil {
+		t.Fatalf("AddTransaction(lifo) error = %v", err)
+	}
+
+	snapshot := func() ([]string, []string) {
+		t.Helper()
+		inventory, err := serv.QueryTransactionAll()
+		if err != nil {
+			t.Fatalf("QueryTransactionAll() error = %v", err)
+		}
+		var gotLots []string
+		for _, lot := range inventory {
+			gotLots = append(gotLots, fmt.Sprintf("%s %d@%s fee %d", lot.Date, lot.Quantity, lot.UnitPrice, lot.Fee))
+		}
+		pnls, err := serv.QueryRealizedPnL("", "", "")
+		if err != nil {
+			t.Fatalf("QueryRealizedPnL() error = %v", err)
+		}
+		var gotPnLs []string
+		for _, pnl := range pnls {
+			gotPnLs = append(gotPnLs, fmt.Sprintf("%s %d@%s gain %s", pnl.BuyDate, pnl.Quantity, pnl.BuyUnitPrice, pnl.Gain))
+		}
+		return gotLots, gotPnLs
+	}
+	wantLots, wantPnLs := snapshot()
+	if len(wantLots) != 3 || !strings.HasPrefix(wantLots[1], "2024-01-03 500@20") || !strings.HasPrefix(wantLots[2], "2024-01-04 500@30") {
+		t.Fatalf("inventory = %v, want 500 shares left of the lots at 20 and 30", wantLots)
+	}
+
+	// The rebuild by first in, first out writes off the lots recorded
+	for _, rebuild := range []struct {
+		name string
+		run  func() error
+	}{
+		{"full", serv.RebuildTransaction},
+		{"from a date", func() error {
+			_, err := serv.Rebuild("", RebuildScope{From: "2024-01-02"}, func(*RebuildReport) bool { return true })
+			return err
+		}},
+	} {
+		if err := rebuild.run(); err != nil {
+			t.Fatalf("rebuild %s error = %v", rebuild.name, err)
+		}
+		gotLots, gotPnLs := snapshot()
+		if !reflect.DeepEqual(gotLots, wantLots) || !reflect.DeepEqual(gotPnLs, wantPnLs) {
+			t.Errorf("rebuild %s = %v, %v, want %v, %v", rebuild.name, gotLots, gotPnLs, wantLots, wantPnLs)
+		}
+	}
+}
+
+func TestAddTransactionAverageCostKeepsFee(t *testing.T) {
+	serv, _ := newTestService(t)
+	serv = serv.WithLotMatcher(averageMatcher{})
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(600), nil, nil),
+		model.NewTransactionFromInput("2024-01-04", "09:00:00", "2330", -1, 500, model.NewDecimalFromInt(700), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+
+	// Both lots are repriced to 550, the second one keeps the fee of 855
+	// paid at 600, and the first one the half of its 712 not written off
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 2 {
+		t.Fatalf("QueryTransactionAll() = %+v, %v, want 2 lots", inventory, err)
+	}
+	for i, want := range []struct{ quantity, fee int }{{500, 356}, {1000, 855}} {
+		lot := inventory[i]
+		if lot.UnitPrice.Cmp(model.NewDecimalFromInt(550)) != 0 || lot.Quantity != want.quantity || lot.Fee != want.fee {
+			t.Errorf("lot %d = %d shares at %s, fee %d, want %d shares at 550, fee %d",
+				i, lot.Quantity, lot.UnitPrice, lot.Fee, want.quantity, want.fee)
+		}
+	}
+}
+
+func TestAddTransactionPartialWriteOffFee(t *testing.T) {
+	serv, db := newTestService(t)
+	serv = serv.WithAllowShort(true)
+
+	// The buy of 1000 is charged the minimum fee of 20, the sell of 100 writes
+	// a tenth of it off. The short sale of 1000 is charged 20 too, 900 of it
+	// close the lot and the rest of 100 is a short lot.
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(10), nil, nil),
+		model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", -1, 100, model.NewDecimalFromInt(10), nil, nil),
+		model.NewTransactionFromInput("2024-01-04", "09:00:00", "2330", -1, 1000, model.NewDecimalFromInt(10), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+
+	var history []*model.Transaction
+	if err := db.Table("tblTransactionHistory").Order("id").Find(&history).Error; err != nil {
+		t.Fatalf("failed to query history: %v", err)
+	}
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 1 {
+		t.Fatalf("QueryTransactionAll() = %+v, %v, want the short lot", inventory, err)
+	}
+
+	// The buy: 100 written off on 01-03, 900 on 01-04. The short sale: 900
+	// written off, 100 held.
+	fees := map[string]int{}
+	for _, h := range history {
+		if h.TranType > 0 {
+			fees["buy"] += h.Fee
+		} else if h.Date == "2024-01-04" {
+			fees["short sale"] += h.Fee
+		}
+	}
+	fees["short sale"] += inventory[0].Fee
+	for _, name := range []string{"buy", "short sale"} {
+		if fees[name] != 20 {
+			t.Errorf("fee of the %s in the history and the inventory = %d, want the 20 paid", name, fees[name])
+		}
+	}
+	if short := inventory[0]; short.TranType != -1 || short.Quantity != 100 || short.Fee != 2 {
+		t.Errorf("short lot = %d shares of type %d, fee %d, want 100 shorted, fee 2", short.Quantity, short.TranType, short.Fee)
+	}
+}
+
+func TestImportTransactions(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	trs := []*model.TransactionRecord{
+		model.NewTransactionRecord("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500)),
+		model.NewTransactionRecord("2024-01-03", "09:00:00", "2330", -1, 400, model.NewDecimalFromInt(600)),
+		model.NewTransactionRecord("2024-01-03", "09:00:10", "0050", 1, 100, model.NewDecimalFromInt(120)),
+	}
+
+	report, err := serv.ImportTransactions(newTestBatch("a.csv"), trs, true)
+	if err != nil {
+		t.Fatalf("ImportTransactions(dry run) error = %v", err)
+	}
+	if len(report.Added) != 3 || len(report.Changes) != 2 || report.Changes[1].QuantityAfter != 600 {
+		t.Fatalf("ImportTransactions(dry run) = %+v, want 3 records added leaving 600 shares of 2330", report)
+	}
+	if inventory, _ := serv.QueryTransactionAll(); len(inventory) != 0 {
+		t.Fatalf("inventory after a dry run = %d lots, want none", len(inventory))
+	}
+
+	if _, err := serv.ImportTransactions(newTestBatch("a.csv"), trs, false); err != nil {
+		t.Fatalf("ImportTransactions() error = %v", err)
+	}
+	report, err = serv.ImportTransactions(newTestBatch("a.csv"), trs, false)
+	if err != nil || len(report.Added) != 0 || len(report.Skipped) != 3 {
+		t.Fatalf("ImportTransactions(again) = %+v, %v, want the 3 records skipped", report, err)
+	}
+
+	// Reverting the batch forgets its rows, and a rebuild keeps the rest
+	batches, err := serv.QueryImportBatchAll()
+	if err != nil || len(batches) != 1 || batches[0].RowCount != 3 {
+		t.Fatalf("QueryImportBatchAll() = %+v, %v, want a batch of 3 rows", batches, err)
+	}
+	if err := serv.RevertImportBatch(batches[0].ID); err != nil {
+		t.Fatalf("RevertImportBatch() error = %v", err)
+	}
+	if inventory, _ := serv.QueryTransactionAll(); len(inventory) != 0 {
+		t.Fatalf("inventory after reverting = %d lots, want none", len(inventory))
+	}
+	report, err = serv.ImportTransactions(newTestBatch("a.csv"), trs, false)
+	if err != nil || len(report.Added) != 3 || report.Rebuilt {
+		t.Fatalf("ImportTransactions(after revert) = %+v, %v, want 3 records added", report, err)
+	}
+	if err := serv.RebuildTransaction(); err != nil {
+		t.Fatalf("RebuildTransaction() error = %v", err)
+	}
+	if inventory, _ := serv.QueryTransactionAll(); len(inventory) != 2 {
+		t.Fatalf("inventory after a rebuild = %d lots, want 2", len(inventory))
+	}
+
+	// The buy is rolled back with the oversell
+	bad := []*model.TransactionRecord{
+		model.NewTransactionRecord("2024-01-04", "09:00:00", "0050", 1, 100, model.NewDecimalFromInt(121)),
+		model.NewTransactionRecord("2024-01-05", "09:00:00", "2330", -1, 1000, model.NewDecimalFromInt(600)),
+	}
+	if _, err := serv.ImportTransactions(newTestBatch("bad.csv"), bad, false); !errors.Is(err, model.ErrOversell) {
+		t.Fatalf("ImportTransactions(oversell) error = %v, want ErrOversell", err)
+	}
+	inventory, err := serv.QueryTransactionByDetails("0050", 0, "")
+	if err != nil || len(inventory) != 1 {
+		t.Fatalf("lots of 0050 = %d, %v, want 1 after a failed import", len(inventory), err)
+	}
+
+	// The ledger has one trade at a time, a file with the same row twice is
+	// rejected
+	twice := []*model.TransactionRecord{
+		model.NewTransactionRecord("2024-01-08", "09:00:00", "0050", 1, 100, model.NewDecimalFromInt(122)),
+		model.NewTransactionRecord("2024-01-08", "09:00:00", "0050", 1, 100, model.NewDecimalFromInt(122)),
+	}
+	if _, err := serv.ImportTransactions(newTestBatch("twice.csv"), twice, false); err == nil {
+		t.Fatalf("ImportTransactions(the same row twice) succeeded, want an error")
+	}
+	if entries, _ := serv.QueryLedger("2024-01-08", "", ""); len(entries) != 0 {
+		t.Fatalf("ledger after a failed import = %d entries, want none", len(entries))
+	}
+}
+
+func TestImportGeneratedTimes(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	buy := model.NewTransactionFromInput("2024-01-02", "09:00:00", "0050", 1, 1000, model.NewDecimalFromInt(100), nil, nil)
+	if _, _, err := serv.AddTransaction(buy, model.SourceCLI); err != nil {
+		t.Fatalf("AddTransaction() error = %v", err)
+	}
+
+	// The rows of a file without time, as the importer times them
+	records := func() []*model.TransactionRecord {
+		trs := []*model.TransactionRecord{
+			model.NewTransactionRecord("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500)),
+			model.NewTransactionRecord("2024-01-02", "09:00:10", "2330", 1, 1000, model.NewDecimalFromInt(510)),
+		}
+		for _, tr := range trs {
+			tr.TimeGenerated = true
+		}
+		return trs
+	}
+	report, err := serv.ImportTransactions(newTestBatch("a.csv"), records(), false)
+	if err != nil || len(report.Added) != 2 {
+		t.Fatalf("ImportTransactions() = %+v, %v, want 2 records added", report, err)
+	}
+	again, err := serv.ImportTransactions(newTestBatch("a copy.csv"), records(), false)
+	if err != nil || len(again.Added) != 0 || len(again.Skipped) != 2 {
+		t.Fatalf("ImportTransactions(again) = %+v, %v, want the 2 records skipped", again, err)
+	}
+
+	entry := model.NewLedgerEntry("2024-01-02", "09:00:00", "2330", "台積電", -1, 500, model.NewDecimalFromInt(520), model.SourceManual)
+	entry.TimeGenerated = true
+	batch := &model.ImportBatch{FileName: "b.csv", FileHash: "b", Format: "manual-excel"}
+	if _, err := serv.ImportLedgerEntries(batch, []*model.LedgerEntry{entry}, false); err != nil {
+		t.Fatalf("ImportLedgerEntries() error = %v", err)
+	}
+
+	ledger, err := serv.QueryLedger("", "", "")
+	if err != nil {
+		t.Fatalf("QueryLedger() error = %v", err)
+	}
+	var times []string
+	for _, e := range ledger {
+		times = append(times, e.StockNo+" "+e.Time)
+	}
+	if want := []string{"0050 09:00:00", "2330 09:00:10", "2330 09:00:20", "2330 09:00:30"}; !reflect.DeepEqual(times, want) {
+		t.Errorf("ledger = %v, want %v", times, want)
+	}
+}
+
+func TestRevertImportBatch(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	batches := []struct {
+		batch   *model.ImportBatch
+		entries []*model.LedgerEntry
+	}{
+		{
+			batch: &model.ImportBatch{FileName: "a.csv", FileHash: "a", Format: "manual-excel"},
+			entries: []*model.LedgerEntry{
+				model.NewLedgerEntry("2024-01-02", "09:00:00", "2330", "台積電", 1, 1000, model.NewDecimalFromInt(500), model.SourceManual),
+			},
+		},
+		{
+			batch: &model.ImportBatch{FileName: "b.csv", FileHash: "b", Format: "manual-excel"},
+			entries: []*model.LedgerEntry{
+				model.NewLedgerEntry("2024-01-03", "09:00:00", "2330", "台積電", 1, 2000, model.NewDecimalFromInt(510), model.SourceManual),
+				model.NewLedgerEntry("2024-01-04", "09:00:00", "2330", "台積電", -1, 500, model.NewDecimalFromInt(520), model.SourceManual),
+			},
+		},
+	}
+	for _, b := range batches {
+		if _, err := serv.ImportLedgerEntries(b.batch, b.entries, false); err != nil {
+			t.Fatalf("ImportLedgerEntries(%s) error = %v", b.batch.FileName, err)
+		}
+	}
+	again := &model.ImportBatch{FileName: "a copy.csv", FileHash: "a", Format: "manual-excel"}
+	if _, err := serv.ImportLedgerEntries(again, nil, false); err == nil {
+		t.Fatalf("ImportLedgerEntries(same file) succeeded, want an error")
+	}
+
+	// The inventory is updated by the import
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 2 || inventory[0].Quantity != 500 || inventory[1].Quantity != 2000 {
+		t.Fatalf("inventory = %v, %v, want the 500 and 2000 shares left", inventory, err)
+	}
+
+	if err := serv.RevertImportBatch(batches[1].batch.ID); err != nil {
+		t.Fatalf("RevertImportBatch() error = %v", err)
+	}
+	if err := serv.RevertImportBatch(batches[1].batch.ID); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("RevertImportBatch(reverted) error = %v, want ErrNotFound", err)
+	}
+
+	imported, err := serv.QueryImportBatchAll()
+	if err != nil || len(imported) != 1 || imported[0].RowCount != 1 {
+		t.Fatalf("QueryImportBatchAll() = %v, %v, want the batch of a.csv", imported, err)
+	}
+	inventory, err = serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 1 || inventory[0].Quantity != 1000 {
+		t.Fatalf("inventory = %v, %v, want the 1000 shares of a.csv", inventory, err)
+	}
+}
+
+func TestImportLedgerEntries(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	entries := func() []*model.LedgerEntry {
+		return []*model.LedgerEntry{
+			model.NewLedgerEntry("2024-01-02", "09:00:00", "2330", "台積電", 1, 1000, model.NewDecimalFromInt(500), model.SourceBroker),
+			model.NewLedgerEntry("2024-01-03", "09:00:00", "2330", "台積電", -1, 1500, model.NewDecimalFromInt(520), model.SourceBroker),
+		}
+	}
+	batch := func() *model.ImportBatch {
+		return &model.ImportBatch{FileName: "a.csv", FileHash: "a", Format: "broker-commission"}
+	}
+
+	// The sell exceeds the shares held
+	if _, err := serv.ImportLedgerEntries(batch(), entries(), false); !errors.Is(err, model.ErrOversell) {
+		t.Fatalf("ImportLedgerEntries(oversell) error = %v, want ErrOversell", err)
+	}
+
+	// A dry run reports the short position without importing it
+	report, err := serv.WithAllowShort(true).ImportLedgerEntries(batch(), entries(), true)
+	if err != nil {
+		t.Fatalf("ImportLedgerEntries(dry run) error = %v", err)
+	}
+	if len(report.Added) != 2 || len(report.Changes) != 1 || report.Changes[0].QuantityAfter != -500 {
+		t.Fatalf("report = %d added, changes %+v, want 2 added and 500 shares shorted", len(report.Added), report.Changes)
+	}
+	if ledger, _ := serv.QueryLedger("", "", ""); len(ledger) != 0 {
+		t.Fatalf("ledger after a dry run = %d entries, want none", len(ledger))
+	}
+	if batches, _ := serv.QueryImportBatchAll(); len(batches) != 0 {
+		t.Fatalf("import batches after a dry run = %d, want none", len(batches))
+	}
+
+	if _, err := serv.WithAllowShort(true).WithLotMatcher(lifoMatcher{}).ImportLedgerEntries(batch(), entries(), false); err != nil {
+		t.Fatalf("ImportLedgerEntries() error = %v", err)
+	}
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 1 || inventory[0].TranType != -1 || inventory[0].Quantity != 500 {
+		t.Fatalf("inventory = %+v, %v, want 500 shares shorted", inventory, err)
+	}
+	ledger, err := serv.QueryLedger("", "", "")
+	if err != nil || len(ledger) != 2 || ledger[1].CostBasis != "lifo" || ledger[1].Fee == nil {
+		t.Fatalf("ledger = %+v, %v, want 2 entries by lifo with their fee", ledger, err)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	serv, db := newTestService(t)
+
+	err := db.Exec(`INSERT INTO tblTransactionRecord (date, time, stockNo, stockName, tranType, quantity, unitPrice, source) VALUES
+		('2024-01-02', '09:00:00', '2330', '台積電', 1, 1000, 500, 1),
+		('2024-01-02', '09:00:10', '0050', '元大台灣50', 1, 1000, 130, 1)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert records: %v", err)
+	}
+	err = db.Exec(`INSERT INTO tblDividend VALUES ('2024Q2', '2330', '2024-06-13', '2024-07-11', 3, 0.5)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert dividends: %v", err)
+	}
+
+	if _, err := serv.Rebuild("shares", RebuildScope{}, func(*RebuildReport) bool { return true }); err == nil {
+		t.Fatalf("Rebuild(shares) succeeded, want an error of unknown part")
+	}
+
+	// A dry run reports the changes and rolls them back
+	report, err := serv.Rebuild("", RebuildScope{}, func(*RebuildReport) bool { return false })
+	if err != nil {
+		t.Fatalf("Rebuild(dry run) error = %v", err)
+	}
+	if report.Committed || len(report.Changes) != 2 {
+		t.Fatalf("Rebuild(dry run) = %+v, want 2 stocks changed, not committed", report)
+	}
+	c := report.Changes[1]
+	if c.StockNo != "2330" || c.QuantityBefore != 0 || c.QuantityAfter != 1050 || c.RecordsAfter != 1 || c.CashAfter != 3000 {
+		t.Errorf("change of 2330 = %+v, want 1050 shares, 1 record and 3000 in cash", c)
+	}
+	if inventory, _ := serv.QueryTransactionAll(); len(inventory) != 0 {
+		t.Fatalf("inventory after a dry run = %d lots, want none", len(inventory))
+	}
+
+	// The cash dividends alone
+	report, err = serv.Rebuild(RebuildCash, RebuildScope{}, func(*RebuildReport) bool { return true })
+	if err != nil || !report.Committed || len(report.Changes) != 1 || report.Changes[0].CashAfter != 3000 || report.Changes[0].QuantityAfter != 0 {
+		t.Fatalf("Rebuild(cash) = %+v, %v, want the cash dividend of 2330 only", report, err)
+	}
+
+	report, err = serv.Rebuild("", RebuildScope{}, func(*RebuildReport) bool { return true })
+	if err != nil || !report.Committed || len(report.Changes) != 2 {
+		t.Fatalf("Rebuild() = %+v, %v, want 2 stocks changed", report, err)
+	}
+	report, err = serv.Rebuild("", RebuildScope{}, func(*RebuildReport) bool { return true })
+	if err != nil || len(report.Changes) != 0 {
+		t.Fatalf("Rebuild(again) = %+v, %v, want no change", report, err)
+	}
+}
+
+// snapshotDerived reads the tables regenerated by a rebuild, without the IDs
+// which differ between a full and a scoped rebuild.
+func snapshotDerived(t *testing.T, db *gorm.DB) map[string][]string {
+	t.Helper()
+
+	snapshot := map[string][]string{}
+	for _, table := range []string{"tblTransaction", "tblTransactionHistory", "tblRealizedPnL", "tblTransactionRecordSys", "tblTransactionCash"} {
+		var rows []map[string]interface{}
+		if err := db.Table(table).Find(&rows).Error; err != nil {
+			t.Fatalf("failed to query %s: %v", table, err)
+		}
+		for _, row := range rows {
+			delete(row, "id")
+			snapshot[table] = append(snapshot[table], fmt.Sprint(row))
+		}
+		sort.Strings(snapshot[table])
+	}
+
+	return snapshot
+}
+
+func TestRebuildScoped(t *testing.T) {
+	serv, db := newTestService(t)
+
+	err := db.Exec(`INSERT INTO tblTransactionRecord (date, time, stockNo, stockName, tranType, quantity, unitPrice, source) VALUES
+		('2024-01-02', '09:00:00', '2330', '台積電', 1, 1000, 500, 1),
+		('2024-02-01', '09:00:00', '2330', '台積電', -1, 1000, 550, 1),
+		('2024-03-01', '09:00:00', '2330', '台積電', 1, 500, 600, 1),
+		('2024-04-01', '09:00:00', '2330', '台積電', 1, 500, 620, 1),
+		('2024-08-01', '09:00:00', '2330', '台積電', -1, 300, 700, 1),
+		('2024-01-02', '09:00:10', '0050', '元大台灣50', 1, 1000, 130, 1)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert records: %v", err)
+	}
+	err = db.Exec(`INSERT INTO tblDividend VALUES ('2024Q2', '2330', '2024-06-13', '2024-07-11', 3, 0.5)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert dividends: %v", err)
+	}
+
+	commit := func(*RebuildReport) bool { return true }
+	if _, err := serv.Rebuild("", RebuildScope{}, commit); err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+
+	// A trade of 2330 before its dividend, rebuilt from its date
+	err = db.Exec(`INSERT INTO tblTransactionRecord (date, time, stockNo, stockName, tranType, quantity, unitPrice, source) VALUES
+		('2024-05-02', '09:00:00', '2330', '台積電', 1, 200, 650, 1)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert records: %v", err)
+	}
+
+	report, err := serv.Rebuild("", RebuildScope{From: "2024-05-02"}, commit)
+	if err != nil {
+		t.Fatalf("Rebuild(from) error = %v", err)
+	}
+	if len(report.Changes) != 1 {
+		t.Fatalf("Rebuild(from) changed %d stocks, want 2330 only", len(report.Changes))
+	}
+	if c := report.Changes[0]; c.StockNo != "2330" || c.QuantityAfter != 960 || c.CashAfter != 3600 {
+		t.Fatalf("Rebuild(from) change = %+v, want 2330 with 960 shares and 3600 in cash", c)
+	}
+	scoped := snapshotDerived(t, db)
+
+	report, err = serv.Rebuild("", RebuildScope{}, commit)
+	if err != nil || len(report.Changes) != 0 {
+		t.Fatalf("Rebuild() after a scoped rebuild = %+v, %v, want no change", report, err)
+	}
+	if full := snapshotDerived(t, db); !reflect.DeepEqual(scoped, full) {
+		t.Errorf("scoped rebuild = %v, want the full rebuild %v", scoped, full)
+	}
+
+	// A stock alone, from a date after it was flat
+	report, err = serv.Rebuild(RebuildInventory, RebuildScope{StockNo: "2330", From: "2024-03-01"}, commit)
+	if err != nil || len(report.Changes) != 0 {
+		t.Fatalf("Rebuild(2330 from 2024-03-01) = %+v, %v, want no change", report, err)
+	}
+	if again := snapshotDerived(t, db); !reflect.DeepEqual(again, scoped) {
+		t.Errorf("rebuild of 2330 = %v, want %v", again, scoped)
+	}
+}
+
+// newBenchService creates a service on a migrated database with a generated
+// ledger of stocks×records records, rebuilt. The stocks are bought twice and
+// sold twice in turn, and pay a dividend every 250 records.
+func newBenchService(b *testing.B, stocks, records int) *service {
+	b.Helper()
+
+	db, err := repository.OpenDB(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("OpenDB() error = %v", err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	if _, err := repository.Migrate(db); err != nil {
+		b.Fatalf("Migrate() error = %v", err)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ledger []*model.LedgerEntry
+	for s := 0; s < stocks; s++ {
+		stockNo := fmt.Sprintf("S%03d", s)
+		tranTime := start.Add(9*time.Hour + time.Duration(s)*time.Second).Format(time.TimeOnly)
+		for i := 0; i < records; i++ {
+			date := start.AddDate(0, 0, i).Format(time.DateOnly)
+			tranType := 1
+			if i%4 >= 2 {
+				tranType = -1
+			}
+			ledger = append(ledger, model.NewLedgerEntry(date, tranTime, stockNo, stockNo, tranType, 1000,
+				model.NewDecimalFromInt(100+i%50), model.SourceCLI))
+
+			if i%250 == 125 {
+				err := db.Exec(`INSERT INTO tblDividend VALUES (?, ?, ?, ?, 1, 0)`,
+					fmt.Sprintf("Q%d", i/250), stockNo, date, date).Error
+				if err != nil {
+					b.Fatalf("failed to insert dividends: %v", err)
+				}
+			}
+		}
+	}
+	if err := db.CreateInBatches(ledger, 500).Error; err != nil {
+		b.Fatalf("failed to insert records: %v", err)
+	}
+
+	serv := NewService(repository.NewRepository(db), nil, nil, nil)
+	if _, err := serv.Rebuild("", RebuildScope{}, func(*RebuildReport) bool { return true }); err != nil {
+		b.Fatalf("Rebuild() error = %v", err)
+	}
+
+	return serv
+}
+
+// BenchmarkRebuild compares the full rebuild of a 100k records ledger with
+// the rebuilds scoped by stock and by date, rolled back after each run, e.g.
+//
+//	go test ./pkg/service -run '^$' -bench Rebuild -benchtime 3x
+func BenchmarkRebuild(b *testing.B) {
+	serv := newBenchService(b, 100, 1000)
+	rollback := func(*RebuildReport) bool { return false }
+
+	scopes := []struct {
+		name  string
+		scope RebuildScope
+	}{
+		{"full", RebuildScope{}},
+		{"stock", RebuildScope{StockNo: "S050"}},
+		{"stock-from", RebuildScope{StockNo: "S050", From: "2022-08-01"}},
+		{"from", RebuildScope{From: "2022-08-01"}},
+	}
+	for _, sc := range scopes {
+		b.Run(sc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := serv.Rebuild("", sc.scope, rollback); err != nil {
+					b.Fatalf("Rebuild(%+v) error = %v", sc.scope, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRebuildCapitalReduction(t *testing.T) {
+	serv, db := newTestService(t)
+
+	err := db.Exec(`INSERT INTO tblTransactionRecord (date, time, stockNo, stockName, tranType, quantity, unitPrice, source) VALUES
+		('2024-01-02', '09:00:00', '2888', '新光金', 1, 1000, 50, 1),
+		('2024-02-01', '09:00:00', '2888', '新光金', 1, 555, 36, 1),
+		('2024-08-01', '09:00:00', '2888A', '新光金', -1, 500, 80, 1)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert records: %v", err)
+	}
+	err = db.Exec(`INSERT INTO tblCapitalReduction VALUES ('2024Q1', '2888', '2024-03-01', '2024-03-20', 1, 0.3, '2888A')`).Error
+	if err != nil {
+		t.Fatalf("failed to insert capital reductions: %v", err)
+	}
+	err = db.Exec(`INSERT INTO tblDividend VALUES ('2024Q2', '2888A', '2024-06-13', '2024-07-11', 2, 0)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert dividends: %v", err)
+	}
+
+	commit := func(*RebuildReport) bool { return true }
+	if _, err := serv.Rebuild("", RebuildScope{}, commit); err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+
+	// Each lot keeps its acquisition date, scaled and renamed, and the sale
+	// writes off the first one
+	lots, err := serv.QueryTransactionAll()
+	if err != nil || len(lots) != 2 {
+		t.Fatalf("inventory = %d lots, %v, want 2", len(lots), err)
+	}
+	// The lots keep the fee paid, 71 for 1000 shares at 50 and 28 for 555
+	// at 36, the first one less the part of the 500 shares sold
+	want := []struct {
+		date      string
+		quantity  int
+		unitPrice string
+		fee       int
+	}{{"2024-01-02", 200, "70", 21}, {"2024-02-01", 388, "50", 28}}
+	for i, w := range want {
+		if lots[i].StockNo != "2888A" || lots[i].Date != w.date || lots[i].Quantity != w.quantity ||
+			lots[i].UnitPrice.Cmp(model.MustParseDecimal(w.unitPrice)) != 0 || lots[i].Fee != w.fee {
+			t.Errorf("lot %d = %+v, want %d shares of 2888A at %s bought on %s, fee %d", i, lots[i], w.quantity, w.unitPrice, w.date, w.fee)
+		}
+	}
+
+	// The records of the shares distributed keep the acquisition of the lots
+	ledger, err := serv.QueryLedger("2024-03-20", "2024-03-20", "2888A")
+	if err != nil || len(ledger) != 2 || ledger[0].AcquiredAt() != "2024-01-02 09:00:00" || ledger[1].AcquiredAt() != "2024-02-01 09:00:00" {
+		t.Fatalf("records of the distribution = %+v, %v, want the lots bought on 2024-01-02 and 2024-02-01", ledger, err)
+	}
+
+	pnls, err := serv.QueryRealizedPnL("", "", "2888A")
+	if err != nil || len(pnls) != 1 || pnls[0].BuyDate != "2024-01-02" || pnls[0].Quantity != 500 {
+		t.Fatalf("realized pnl = %v, %v, want 500 shares bought on 2024-01-02", pnls, err)
+	}
+
+	// The refund and the cash in lieu, then the dividend of the 1088 shares left
+	cashDividends, err := serv.repo.QueryCashDividendAll()
+	if err != nil || len(cashDividends) != 2 {
+		t.Fatalf("cash = %v, %v, want the capital reduction and the dividend", cashDividends, err)
+	}
+	if cd := cashDividends[0]; cd.Kind != model.CashKindCapitalReduction || cd.StockNo != "2888" || cd.TotalAmount != 1560 {
+		t.Errorf("cash of the capital reduction = %+v, want 1560 for 2888", cd)
+	}
+	if cd := cashDividends[1]; cd.Kind != model.CashKindDividend || cd.Quantity != 1088 || cd.TotalAmount != 2176 {
+		t.Errorf("cash dividend = %+v, want 2176 for 1088 shares of 2888A", cd)
+	}
+
+	// The history keeps the lots of the old stock number
+	var history []*model.Transaction
+	if err := db.Table("tblTransactionHistory").Where("stockNo = ?", "2888").Order("date").Find(&history).Error; err != nil {
+		t.Fatalf("failed to query history: %v", err)
+	}
+	if len(history) != 2 || history[0].Quantity != 1000 || history[1].Quantity != 555 {
+		t.Errorf("history of 2888 = %d rows, want the lots of 1000 and 555 shares", len(history))
+	}
+
+	// A trade of the old stock before the capital reduction rebuilds both
+	// stock numbers from its date, as a full rebuild does
+	_, rebuilt, err := serv.AddTransaction(model.NewTransactionFromInput(
+		"2024-02-15", "09:00:00", "2888", 1, 100, model.MustParseDecimal("43"), nil, nil), model.SourceCLI)
+	if err != nil || !rebuilt {
+		t.Fatalf("AddTransaction(before the capital reduction) = %v, %v, want rebuilt", rebuilt, err)
+	}
+	if lots, _ := serv.QueryTransactionByDetails("2888A", 0, ""); len(lots) != 3 || lots[2].Quantity != 70 {
+		t.Fatalf("inventory of 2888A = %d lots, want 3 with the 70 shares bought on 2024-02-15", len(lots))
+	}
+	scoped := snapshotDerived(t, db)
+
+	report, err := serv.Rebuild("", RebuildScope{}, commit)
+	if err != nil || len(report.Changes) != 0 {
+		t.Fatalf("Rebuild() after a scoped rebuild = %+v, %v, want no change", report, err)
+	}
+	if full := snapshotDerived(t, db); !reflect.DeepEqual(scoped, full) {
+		t.Errorf("scoped rebuild = %v, want the full rebuild %v", scoped, full)
+	}
+}
+
+func TestQueryInventoryValuation(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(580), nil, nil),
+		model.NewTransactionFromInput("2024-01-02", "09:00:10", "0050", 1, 2000, model.NewDecimalFromInt(130), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.StockNo, err)
+		}
+	}
+
+	// The price imported again replaces the one stored
+	for _, prices := range [][]*model.Price{
+		{
+			{StockNo: "2330", Date: "2024-01-02", Close: model.NewDecimalFromInt(593)},
+			{StockNo: "2330", Date: "2024-01-03", Close: model.NewDecimalFromInt(570)},
+		},
+		{
+			{StockNo: "2330", Date: "2024-01-03", Close: model.NewDecimalFromInt(600)},
+		},
+	} {
+		if err := serv.ImportPrices(prices); err != nil {
+			t.Fatalf("ImportPrices() error = %v", err)
+		}
+	}
+
+	valuations, err := serv.QueryInventoryValuation()
+	if err != nil || len(valuations) != 2 {
+		t.Fatalf("QueryInventoryValuation() = %+v, %v, want 2 stocks", valuations, err)
+	}
+	sort.Slice(valuations, func(i, j int) bool { return valuations[i].StockNo < valuations[j].StockNo })
+
+	if v := valuations[0]; v.StockNo != "0050" || v.LastClose != nil {
+		t.Errorf("valuation of 0050 = %+v, want no price", v)
+	}
+	v := valuations[1]
+	if v.StockNo != "2330" || v.CloseDate != "2024-01-03" || v.MarketValue.Cmp(model.NewDecimalFromInt(600000)) != 0 ||
+		v.UnrealizedGain.Cmp(model.NewDecimalFromInt(20000)) != 0 {
+		t.Errorf("valuation of 2330 = %s %v %v, want the close 600 on 2024-01-03", v.CloseDate, v.MarketValue, v.UnrealizedGain)
+	}
+}
+
+func TestFetchPrices(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	prices, err := serv.FetchPrices(quote.NewFileProvider("../quote/testdata"), "2330", "2024-01-03", "2024-02-01")
+	if err != nil || len(prices) != 3 {
+		t.Fatalf("FetchPrices() = %d prices, %v, want 3", len(prices), err)
+	}
+
+	latest, err := serv.repo.QueryLatestPriceAll()
+	if err != nil || len(latest) != 1 || latest[0].Date != "2024-02-01" || latest[0].Close.Cmp(model.NewDecimalFromInt(628)) != 0 {
+		t.Fatalf("QueryLatestPriceAll() = %+v, %v, want the close 628 on 2024-02-01", latest, err)
+	}
+
+	if _, err := serv.FetchPrices(quote.NewFileProvider("../quote/testdata"), "2330", "2024-02-01", "2024-01-01"); err == nil {
+		t.Errorf("FetchPrices() from after to succeeded, want an error")
+	}
+}
+
+func TestQueryPortfolioTimeSeries(t *testing.T) {
+	serv, _ := newTestService(t)
+	serv = serv.WithLotMatcher(lifoMatcher{})
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(600), nil, nil),
+		model.NewTransactionFromInput("2024-01-04", "09:00:00", "2330", -1, 1500, model.NewDecimalFromInt(650), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+	err := serv.ImportPrices([]*model.Price{{StockNo: "2330", Date: "2024-01-05", Close: model.NewDecimalFromInt(640)}})
+	if err != nil {
+		t.Fatalf("ImportPrices() error = %v", err)
+	}
+
+	days, err := serv.QueryPortfolioTimeSeries("", "", "")
+	if err != nil || len(days) != 4 {
+		t.Fatalf("QueryPortfolioTimeSeries() = %d days, %v, want 4", len(days), err)
+	}
+
+	// The last lot is written off first, the 500 shares of the first one are
+	// left
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil || len(inventory) != 1 {
+		t.Fatalf("QueryTransactionAll() = %+v, %v, want 1 lot", inventory, err)
+	}
+	last := days[3].Total
+	if last.Cost.Cmp(inventory[0].TotalAmount) != 0 || last.MarketValue.Cmp(model.NewDecimalFromInt(320000)) != 0 {
+		t.Errorf("last day = cost %s value %s, want the cost %s of the inventory and the value 320000",
+			last.Cost, last.MarketValue, inventory[0].TotalAmount)
+	}
+}
+
+func TestQueryPerformance(t *testing.T) {
+	serv, _ := newTestService(t)
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-07-01", "09:00:00", "2330", -1, 500, model.NewDecimalFromInt(600), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+	err := serv.ImportPrices([]*model.Price{
+		{StockNo: "2330", Date: "2024-01-02", Close: model.NewDecimalFromInt(500)},
+		{StockNo: "2330", Date: "2024-07-01", Close: model.NewDecimalFromInt(600)},
+		{StockNo: "2330", Date: "2024-12-31", Close: model.NewDecimalFromInt(550)},
+	})
+	if err != nil {
+		t.Fatalf("ImportPrices() error = %v", err)
+	}
+
+	// The default fee, 712 of the buy and 427 of the sell, and the tax, 900,
+	// are paid, then up 20% to the sell and down 1/12
+	wantTWR := 500000.0/500712*(600000-427-900)/500000*275000/300000 - 1
+	performances, err := serv.QueryPerformance("", "", "")
+	if err != nil || len(performances) != 6 {
+		t.Fatalf("QueryPerformance() = %d rows, %v, want 6", len(performances), err)
+	}
+	wantXIRR, err := model.XIRR([]model.CashFlow{
+		{Date: "2024-01-02", Amount: model.NewDecimalFromInt(-500712)},
+		{Date: "2024-07-01", Amount: model.NewDecimalFromInt(300000 - 427 - 900)},
+		{Date: "2024-12-31", Amount: model.NewDecimalFromInt(275000)},
+	})
+	if err != nil {
+		t.Fatalf("XIRR() error = %v", err)
+	}
+	for i, p := range performances {
+		wantStockNo := ""
+		if i >= 3 {
+			wantStockNo = "2330"
+		}
+		if p.StockNo != wantStockNo || p.To != "2024-12-31" || p.TWR == nil || p.XIRR == nil {
+			t.Fatalf("performances[%d] = %+v, want %q until 2024-12-31", i, p, wantStockNo)
+		}
+		if math.Abs(*p.TWR-wantTWR) > 1e-9 || math.Abs(*p.XIRR-wantXIRR) > 1e-9 {
+			t.Errorf("performances[%d] %s = TWR %v XIRR %v, want %v and %v", i, p.Period, *p.TWR, *p.XIRR, wantTWR, wantXIRR)
+		}
+	}
+	if p := performances[2]; p.Period != "Inception" || p.From != "2024-01-02" {
+		t.Errorf("performances[2] = %s from %s, want Inception from 2024-01-02", p.Period, p.From)
+	}
+
+	// Held at 500000 before the period, the fee of the buy is not in it
+	wantTWR = (600000-427-900)/500000.0*275000/300000 - 1
+	performances, err = serv.QueryPerformance("2024-07-01", "2024-12-31", "2330")
+	if err != nil || len(performances) != 1 {
+		t.Fatalf("QueryPerformance(2330) = %d rows, %v, want 1", len(performances), err)
+	}
+	if p := performances[0]; p.Period != "Period" || p.TWR == nil || math.Abs(*p.TWR-wantTWR) > 1e-9 {
+		t.Errorf("performances[0] = %+v, want the TWR %v over the period", p, wantTWR)
+	}
+}
+
+func TestCashFlowsRecordedFee(t *testing.T) {
+	serv, db := newTestService(t)
+
+	// A day trade, the sell is taxed 0.15% instead of 0.3%
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-01-02", "13:00:00", "2330", -1, 1000, model.NewDecimalFromInt(510), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Time, err)
+		}
+	}
+	want := []model.CashFlow{
+		{Date: "2024-01-02", Amount: model.NewDecimalFromInt(-500000 - 712)},
+		{Date: "2024-01-02", Amount: model.NewDecimalFromInt(510000 - 726 - 765)},
+	}
+
+	// The fee and taxes recorded are kept by a service of another schedule
+	for _, s := range []*service{
+		serv,
+		NewService(repository.NewRepository(db), model.NewBrokerFeeSchedule(model.DefaultFeeRate, model.MustParseDecimal("0.6"), 1), nil, nil),
+	} {
+		flows, err := s.cashFlows("", "")
+		if err != nil || len(flows["2330"]) != len(want) {
+			t.Fatalf("cashFlows() = %+v, %v, want %d flows of 2330", flows, err, len(want))
+		}
+		for i, f := range flows["2330"] {
+			if f.Date != want[i].Date || f.Amount.Cmp(want[i].Amount) != 0 {
+				t.Errorf("flows[%d] = %s %s, want %s %s", i, f.Date, f.Amount, want[i].Date, want[i].Amount)
+			}
+		}
+	}
+}
+
+func TestRebuildRecordedFee(t *testing.T) {
+	serv, db := newTestService(t)
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-01-03", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+	// The fee of the second buy is missing, as recorded before 0013
+	if err := db.Exec("UPDATE tblTransactionRecord SET fee = NULL, taxes = NULL WHERE date = '2024-01-03'").Error; err != nil {
+		t.Fatalf("clearing the fee error = %v", err)
+	}
+
+	// A rebuild under another schedule keeps the fee recorded, and records
+	// its own for the missing one
+	other := NewService(repository.NewRepository(db), model.NewBrokerFeeSchedule(model.DefaultFeeRate, model.MustParseDecimal("0.6"), 1), nil, nil)
+	if err := other.RebuildTransaction(); err != nil {
+		t.Fatalf("RebuildTransaction() error = %v", err)
+	}
+
+	ledger, err := other.QueryLedger("", "", "2330")
+	if err != nil || len(ledger) != 2 {
+		t.Fatalf("QueryLedger() = %d entries, %v, want 2", len(ledger), err)
+	}
+	inventory, err := other.QueryTransactionAll()
+	if err != nil || len(inventory) != 2 {
+		t.Fatalf("QueryTransaction() = %d lots, %v, want 2", len(inventory), err)
+	}
+	for i, want := range []int{712, 427} {
+		if e := ledger[i]; e.Fee == nil || *e.Fee != want || e.Taxes == nil || *e.Taxes != 0 {
+			t.Errorf("ledger[%d] fee = %v, taxes = %v, want %d and 0", i, e.Fee, e.Taxes, want)
+		}
+		if lot := inventory[i]; lot.Fee != want {
+			t.Errorf("inventory[%d].Fee = %d, want %d", i, lot.Fee, want)
+		}
+	}
+}
+
+func TestDeleteUpdateTransaction(t *testing.T) {
+	serv, db := newTestService(t)
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-03-01", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(520), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+	err := db.Exec(`INSERT INTO tblDividend VALUES ('2024Q2', '2330', '2024-06-13', '2024-07-11', 0, 0.5)`).Error
+	if err != nil {
+		t.Fatalf("failed to insert dividends: %v", err)
+	}
+	if err := serv.RebuildTransactionRecordSys(); err != nil {
+		t.Fatalf("RebuildTransactionRecordSys() error = %v", err)
+	}
+	if err := serv.RebuildTransaction(); err != nil {
+		t.Fatalf("RebuildTransaction() error = %v", err)
+	}
+
+	// The IDs of the lots change as the inventory is rebuilt
+	lotID := func(date string) int {
+		inventory, err := serv.QueryTransactionAll()
+		if err != nil {
+			t.Fatalf("QueryTransactionAll() error = %v", err)
+		}
+		for _, lot := range inventory {
+			if lot.Date == date {
+				return lot.ID
+			}
+		}
+		t.Fatalf("no lot on %s", date)
+		return 0
+	}
+
+	// The shares of the stock dividend have no trade to edit
+	if _, err := serv.DeleteTransaction(lotID("2024-07-11")); err == nil || errors.Is(err, model.ErrNotFound) {
+		t.Errorf("DeleteTransaction(stock dividend lot) error = %v, want a corporate action error", err)
+	}
+	if _, err := serv.DeleteTransaction(9999); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("DeleteTransaction(9999) error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := serv.UpdateTransaction(lotID("2024-03-01"), model.NewDecimalFromInt(510)); err != nil {
+		t.Fatalf("UpdateTransaction() error = %v", err)
+	}
+	if _, err := serv.DeleteTransaction(lotID("2024-01-02")); err != nil {
+		t.Fatalf("DeleteTransaction() error = %v", err)
+	}
+
+	// A full rebuild keeps the edits, they are on the ledger
+	if err := serv.RebuildTransaction(); err != nil {
+		t.Fatalf("RebuildTransaction() error = %v", err)
+	}
+
+	ledger, err := serv.QueryLedger("", "", "2330")
+	if err != nil || len(ledger) != 2 {
+		t.Fatalf("QueryLedger() = %d entries, %v, want 2", len(ledger), err)
+	}
+	if e := ledger[0]; e.Date != "2024-03-01" || e.UnitPrice.Cmp(model.NewDecimalFromInt(510)) != 0 || e.Fee == nil || *e.Fee != 726 {
+		t.Errorf("ledger[0] = %s at %s, fee %v, want 2024-03-01 at 510, fee 726", e.Date, e.UnitPrice, e.Fee)
+	}
+	if e := ledger[1]; e.Source != model.SourceCorporateAction || e.Quantity != 50 {
+		t.Errorf("ledger[1] = %d shares from %s, want 50 shares from a corporate action", e.Quantity, e.Source)
+	}
+
+	inventory, err := serv.QueryTransactionAll()
+	if err != nil {
+		t.Fatalf("QueryTransactionAll() error = %v", err)
+	}
+	quantity, totalAmount := 0, model.DecimalZero
+	for _, lot := range inventory {
+		quantity += lot.Quantity
+		totalAmount = totalAmount.Add(lot.TotalAmount)
+	}
+	if quantity != 1050 || totalAmount.Cmp(model.NewDecimalFromInt(510000)) != 0 {
+		t.Errorf("inventory = %d shares costing %s, want 1050 shares costing 510000", quantity, totalAmount)
+	}
+}
+
+func TestQueryBenchmark(t *testing.T) {
+	serv, db := newTestService(t)
+
+	for _, tr := range []*model.Transaction{
+		model.NewTransactionFromInput("2024-01-02", "09:00:00", "2330", 1, 1000, model.NewDecimalFromInt(500), nil, nil),
+		model.NewTransactionFromInput("2024-07-01", "09:00:00", "2330", -1, 500, model.NewDecimalFromInt(600), nil, nil),
+	} {
+		if _, _, err := serv.AddTransaction(tr, model.SourceCLI); err != nil {
+			t.Fatalf("AddTransaction(%s) error = %v", tr.Date, err)
+		}
+	}
+	var prices []*model.Price
+	for _, p := range []struct {
+		date           string
+		close2330, etf int
+	}{
+		{"2024-01-02", 500, 100},
+		{"2024-07-01", 600, 100},
+		{"2024-12-31", 550, 110},
+	} {
+		prices = append(prices,
+			&model.Price{StockNo: "2330", Date: p.date, Close: model.NewDecimalFromInt(p.close2330)},
+			&model.Price{StockNo: "0050", Date: p.date, Close: model.NewDecimalFromInt(p.etf)})
+	}
+	if err := serv.ImportPrices(prices); err != nil {
+		t.Fatalf("ImportPrices() error = %v", err)
+	}
+	err := db.Exec(`INSERT INTO tblDividend VALUES ('2024Q2', '0050', '2024-07-01', '2024-07-20', 2, 0)`).Error
+	if err != nil {
+		t.Fatalf("insert dividend error = %v", err)
+	}
+
+	// 5007.12 shares bought with the 500712 paid, 2% more of the dividend
+	// reinvested, and 2986.73 sold for the 298673 received: 2120.5324 shares
+	values, err := serv.QueryBenchmarkTimeSeries("0050", "2024-07-01", "", "")
+	if err != nil || len(values) != 2 {
+		t.Fatalf("QueryBenchmarkTimeSeries() = %+v, %v, want 2 days", values, err)
+	}
+	if want := model.MustParseDecimal("233258.564"); values[1].Value.Cmp(want) != 0 {
+		t.Errorf("value of %s = %s, want %s", values[1].Date, values[1].Value, want)
+	}
+
+	comparisons, err := serv.QueryBenchmark("0050", "", "", "")
+	if err != nil || len(comparisons) != 3 {
+		t.Fatalf("QueryBenchmark() = %d periods, %v, want 3", len(comparisons), err)
+	}
+	wantXIRR, err := model.XIRR([]model.CashFlow{
+		{Date: "2024-01-02", Amount: model.NewDecimalFromInt(-500712)},
+		{Date: "2024-07-01", Amount: model.NewDecimalFromInt(298673)},
+		{Date: "2024-12-31", Amount: model.MustParseDecimal("233258.564")},
+	})
+	if err != nil {
+		t.Fatalf("XIRR() error = %v", err)
+	}
+	inception := comparisons[2]
+	if b := inception.Benchmark; b.StockNo != "0050" || b.TWR == nil || math.Abs(*b.TWR-0.122) > 1e-9 ||
+		b.XIRR == nil || math.Abs(*b.XIRR-wantXIRR) > 1e-9 {
+		t.Fatalf("benchmark = %+v, want the TWR 0.122 and the XIRR %v", b, wantXIRR)
+	}
+	if diff := inception.TWRDiff(); diff == nil || math.Abs(*diff-(*inception.Portfolio.TWR-0.122)) > 1e-9 {
+		t.Errorf("TWRDiff() = %v, want the TWR of the portfolio less 0.122", diff)
+	}
+
+	if _, err := serv.QueryBenchmark("006208", "", "", ""); err == nil {
+		t.Errorf("QueryBenchmark() of a benchmark without prices succeeded, want an error")
+	}
+}